@@ -7,10 +7,13 @@ import (
 	"github.com/turanoo/bitebattle/internal/account"
 	"github.com/turanoo/bitebattle/internal/agentic"
 	"github.com/turanoo/bitebattle/internal/auth"
+	"github.com/turanoo/bitebattle/internal/favorite"
 	"github.com/turanoo/bitebattle/internal/head2head"
+	"github.com/turanoo/bitebattle/internal/notification"
 	"github.com/turanoo/bitebattle/internal/poll"
 	"github.com/turanoo/bitebattle/internal/restaurant"
 	"github.com/turanoo/bitebattle/internal/user"
+	"github.com/turanoo/bitebattle/internal/visit"
 	"github.com/turanoo/bitebattle/pkg/config"
 )
 
@@ -54,21 +57,64 @@ func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config) {
 	protected.POST("/polls/:pollId/options", pollHandler.AddOption)
 	protected.POST("/polls/:pollId/vote", pollHandler.CastVote)
 	protected.POST("/polls/:pollId/unvote", pollHandler.UncastVote)
+	protected.POST("/polls/:pollId/close", pollHandler.ClosePoll)
 	protected.GET("/polls/:pollId/results", pollHandler.GetResults)
 
-	restaurantService := restaurant.NewService(cfg)
+	favoriteService := favorite.NewService(db, pollService)
+	favoriteHandler := favorite.NewHandler(favoriteService)
+	protected.GET("/favorites", favoriteHandler.GetFavorites)
+	protected.POST("/favorites", favoriteHandler.SaveRestaurant)
+	protected.DELETE("/favorites/:restaurantId", favoriteHandler.RemoveFavorite)
+	protected.GET("/lists", favoriteHandler.GetLists)
+	protected.POST("/lists", favoriteHandler.CreateList)
+	protected.GET("/lists/:listId", favoriteHandler.GetList)
+	protected.PUT("/lists/:listId", favoriteHandler.RenameList)
+	protected.DELETE("/lists/:listId", favoriteHandler.DeleteList)
+	protected.POST("/lists/:listId/restaurants", favoriteHandler.AddToList)
+	protected.DELETE("/lists/:listId/restaurants/:restaurantId", favoriteHandler.RemoveFromList)
+	protected.POST("/lists/:listId/add-to-poll", favoriteHandler.AddListToPoll)
+
+	visitService := visit.NewService(db)
+	visitHandler := visit.NewHandler(visitService)
+	protected.POST("/visits", visitHandler.CreateVisit)
+	protected.GET("/visits", visitHandler.GetVisits)
+	protected.PUT("/visits/:id", visitHandler.UpdateVisit)
+	protected.DELETE("/visits/:id", visitHandler.DeleteVisit)
+	protected.GET("/visits/team-rating/:restaurantId", visitHandler.GetTeamRating)
+
+	restaurantService := restaurant.NewService(db, cfg, visitService)
 	restaurantHandler := restaurant.NewHandler(restaurantService)
+	// Photos are loaded straight into image views, which can't send auth
+	// headers, and their URLs are stored with poll options and favorites.
+	api.GET("/restaurants/photos/:ref", restaurantHandler.GetPhoto)
 	protected.GET("/restaurants/search", restaurantHandler.SearchRestaurants)
+	protected.GET("/restaurants/cache/stats", restaurantHandler.GetCacheStats)
+	protected.GET("/restaurants/:placeId", restaurantHandler.GetDetails)
+
+	notificationService := notification.NewService(db, notification.NewHub())
+	notificationHandler := notification.NewHandler(notificationService)
+	notifier := notification.NewNotifier(notificationService)
+	protected.GET("/notifications/stream", notificationHandler.Stream)
 
-	h2hService := head2head.NewService(db, cfg)
+	h2hService := head2head.NewService(db, cfg, notifier, userService)
 	h2hHandler := head2head.NewHandler(h2hService)
+	api.GET("/h2h/invites/:token", h2hHandler.PreviewInvite)
+	protected.POST("/h2h/invites/:token/claim", h2hHandler.ClaimInvite)
 	protected.POST("/h2h/match", h2hHandler.CreateMatch)
+	protected.GET("/h2h/match/:id", h2hHandler.GetMatch)
 	protected.POST("/h2h/match/:id/accept", h2hHandler.AcceptMatch)
+	protected.POST("/h2h/match/:id/decline", h2hHandler.DeclineMatch)
 	protected.POST("/h2h/match/:id/swipe", h2hHandler.SubmitSwipe)
 	protected.GET("/h2h/match/:id/results", h2hHandler.GetMatchResults)
+	protected.POST("/h2h/match/:id/rematch", h2hHandler.Rematch)
+	protected.POST("/h2h/match/:id/invites", h2hHandler.CreateInvite)
+	protected.GET("/h2h/stats/:userId", h2hHandler.GetPairStats)
 
-	agenticVertex := agentic.NewVertexAIClient(cfg)
-	agenticService := agentic.NewService(agenticVertex, *pollService, *restaurantService)
+	agenticModel := agentic.NewModel(cfg, restaurantService.Geocoder)
+	agenticService := agentic.NewService(db, cfg, agenticModel, pollService, restaurantService, h2hService)
 	agenticHandler := agentic.NewHandler(agenticService)
 	protected.POST("/agentic/command", agenticHandler.Command)
+	protected.POST("/agentic/command/stream", agenticHandler.StreamCommand)
+	protected.POST("/agentic/confirm", agenticHandler.Confirm)
+	protected.GET("/agentic/history", agenticHandler.History)
 }
@@ -0,0 +1,86 @@
+// Command agent-eval scores an agent backend against a corpus of commands
+// and the tool calls they should produce.
+//
+//	go run ./cmd/agent-eval                          # rules backend, offline
+//	go run ./cmd/agent-eval -backend openai -out head.json -compare base.json
+//
+// Backends other than rules are configured like the server, from
+// config/$APP_ENV.yaml.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/turanoo/bitebattle/internal/agentic"
+	"github.com/turanoo/bitebattle/internal/agentic/eval"
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+func main() {
+	corpus := flag.String("corpus", "cmd/agent-eval/corpus.json", "JSON file of commands and expected tool calls")
+	backend := flag.String("backend", agentic.BackendRules, "backend to score: rules, openai or vertex")
+	tolerance := flag.Float64("tolerance-km", eval.DefaultToleranceKM, "how far a location may be off and still count as correct")
+	out := flag.String("out", "", "write the report as JSON to this file")
+	compare := flag.String("compare", "", "compare with a report written by an earlier run")
+	minExact := flag.Float64("min-exact", 0, "fail if fewer than this share of cases match exactly, from 0 to 1")
+	failOnRegression := flag.Bool("fail-on-regression", false, "fail if any field is less accurate than in -compare")
+	flag.Parse()
+
+	logger.Init()
+	logger.Log.SetLevel(logrus.WarnLevel)
+	ctx := context.Background()
+
+	cases, err := eval.LoadCorpus(*corpus)
+	if err != nil {
+		fail(err)
+	}
+
+	cfg := &config.Config{}
+	if *backend != agentic.BackendRules {
+		if cfg, err = config.LoadConfig(ctx, "config"); err != nil {
+			fail(fmt.Errorf("failed to load config: %w", err))
+		}
+	}
+	cfg.Agent.Backend = *backend
+
+	report := eval.Evaluate(ctx, *backend, agentic.NewModel(cfg, nil), cases, *tolerance)
+	report.Print(os.Stdout)
+
+	if *out != "" {
+		if err := report.WriteJSON(*out); err != nil {
+			fail(err)
+		}
+	}
+
+	failed := false
+	if *compare != "" {
+		base, err := eval.LoadReport(*compare)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println()
+		eval.PrintComparison(os.Stdout, base, report)
+		if regressions := eval.Regressions(eval.Compare(base, report)); *failOnRegression && len(regressions) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d fields regressed\n", len(regressions))
+			failed = true
+		}
+	}
+	if rate := report.ExactMatchRate(); rate < *minExact {
+		fmt.Fprintf(os.Stderr, "\nexact match rate %.1f%% is below the required %.1f%%\n", 100*rate, 100**minExact)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "agent-eval:", err)
+	os.Exit(2)
+}
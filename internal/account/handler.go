@@ -53,7 +53,7 @@ func (h *Handler) UpdateProfile(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	err = h.Service.UpdateProfile(ctx, userID, req.Name, req.Email)
+	err = h.Service.UpdateProfile(ctx, userID, req.Name, req.Email, req.DietaryPreferences)
 	if err != nil {
 		if errors.Is(err, ErrEmailExists) {
 			utils.ErrorResponse(c, http.StatusConflict, "User with this email already exists.")
@@ -1,9 +1,24 @@
 package account
 
+// Dietary preferences a user can set on their profile. The agent leaves
+// restaurants that don't suit a group's diets out of its recommendations.
+const (
+	DietVegetarian  = "vegetarian"
+	DietVegan       = "vegan"
+	DietPescatarian = "pescatarian"
+	DietGlutenFree  = "gluten_free"
+	DietDairyFree   = "dairy_free"
+	DietHalal       = "halal"
+	DietKosher      = "kosher"
+)
+
 type UpdateProfileRequest struct {
 	Name          string  `json:"name" binding:"required,min=2,max=50"`
 	Email         string  `json:"email" binding:"required,email"`
 	PhoneNumber   *string `json:"phone_number,omitempty" binding:"omitempty,e164"`
 	ProfilePicURL *string `json:"profile_pic_url,omitempty" binding:"omitempty,url"`
 	Bio           *string `json:"bio,omitempty" binding:"omitempty,max=160"`
+	// DietaryPreferences replaces the user's diets when set; an empty list
+	// clears them.
+	DietaryPreferences []string `json:"dietary_preferences,omitempty" binding:"omitempty,max=7,dive,oneof=vegetarian vegan pescatarian gluten_free dairy_free halal kosher"`
 }
@@ -43,24 +43,28 @@ type UserProfile struct {
 	ProfilePicURL *string   `json:"profile_pic_url,omitempty"`
 	Bio           *string   `json:"bio,omitempty"`
 	LastLoginAt   *string   `json:"last_login_at,omitempty"`
+	// DietaryPreferences are the user's diets, such as "vegetarian".
+	DietaryPreferences []string `json:"dietary_preferences"`
 }
 
 func (s *Service) GetUserProfile(userID uuid.UUID) (*UserProfile, error) {
-	row := s.DB.QueryRow(`SELECT id, name, email, phone_number, profile_pic_url, bio, last_login_at FROM users WHERE id = $1`, userID)
+	row := s.DB.QueryRow(`SELECT id, name, email, phone_number, profile_pic_url, bio, last_login_at, dietary_preferences FROM users WHERE id = $1`, userID)
 
 	var profile UserProfile
-	err := db.ScanOne(row, &profile.ID, &profile.Name, &profile.Email, &profile.PhoneNumber, &profile.ProfilePicURL, &profile.Bio, &profile.LastLoginAt)
+	err := db.ScanOne(row, &profile.ID, &profile.Name, &profile.Email, &profile.PhoneNumber, &profile.ProfilePicURL, &profile.Bio, &profile.LastLoginAt, pq.Array(&profile.DietaryPreferences))
 	if err != nil {
 		return nil, err
 	}
 	return &profile, nil
 }
 
-func (s *Service) UpdateProfile(ctx context.Context, userID uuid.UUID, name, email string) error {
+// UpdateProfile changes the user's name and email, and their dietary
+// preferences unless diets is nil.
+func (s *Service) UpdateProfile(ctx context.Context, userID uuid.UUID, name, email string, diets []string) error {
 	_, err := s.DB.ExecContext(ctx, `
-		UPDATE users SET name = $1, email = $2, updated_at = NOW()
+		UPDATE users SET name = $1, email = $2, dietary_preferences = COALESCE($4, dietary_preferences), updated_at = NOW()
 		WHERE id = $3
-	`, name, email, userID)
+	`, name, email, userID, pq.Array(diets))
 
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
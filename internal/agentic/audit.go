@@ -0,0 +1,308 @@
+package agentic
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+var ErrQuotaExceeded = errors.New("daily agent quota used up")
+
+// Kinds of audited commands.
+const (
+	KindCommand      = "command"
+	KindConfirmation = "confirmation"
+)
+
+// Outcomes of audited commands.
+const (
+	OutcomeRunning              = "running"
+	OutcomeSucceeded            = "succeeded"
+	OutcomeAwaitingConfirmation = "awaiting_confirmation"
+	OutcomeFailed               = "failed"
+	OutcomeOverQuota            = "over_quota"
+)
+
+// defaultDailyCommandLimit and defaultDailyTokenLimit are each user's daily
+// quotas unless the config sets agent.daily_command_limit and
+// agent.daily_token_limit.
+const (
+	defaultDailyCommandLimit = 200
+	defaultDailyTokenLimit   = 200000
+)
+
+// defaultHistoryLimit and maxHistoryLimit size a page of command history.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// Usage is the model tokens spent on a command.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+}
+
+// CommandRecord is the audit record of a command or confirmation: what the
+// user asked, the tool calls the model made and what came of them.
+type CommandRecord struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.UUID       `json:"-"`
+	SessionID *uuid.UUID      `json:"session_id,omitempty"`
+	Kind      string          `json:"kind"`
+	Command   string          `json:"command"`
+	Intent    json.RawMessage `json:"intent"` // the tool calls, with arguments
+	Steps     []Step          `json:"steps"`
+	Action    string          `json:"action,omitempty"`
+	Outcome   string          `json:"outcome"`
+	Error     string          `json:"error,omitempty"`
+	LatencyMS int64           `json:"latency_ms"`
+	Usage
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QuotaUsage is how much of their daily quotas a user has spent. Days start
+// at midnight UTC.
+type QuotaUsage struct {
+	Commands     int       `json:"commands"`
+	CommandLimit int       `json:"command_limit"`
+	Tokens       int       `json:"tokens"`
+	TokenLimit   int       `json:"token_limit"`
+	ResetsAt     time.Time `json:"resets_at"`
+}
+
+// QuotaError reports a command refused because the user is over a daily
+// quota. It wraps ErrQuotaExceeded.
+type QuotaError struct {
+	Usage *QuotaUsage
+}
+
+func (e *QuotaError) Error() string {
+	if e.Usage.Commands >= e.Usage.CommandLimit {
+		return fmt.Sprintf("%v: %d of %d commands today, resets at %s",
+			ErrQuotaExceeded, e.Usage.Commands, e.Usage.CommandLimit, e.Usage.ResetsAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%v: %d of %d tokens today, resets at %s",
+		ErrQuotaExceeded, e.Usage.Tokens, e.Usage.TokenLimit, e.Usage.ResetsAt.Format(time.RFC3339))
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// History is a page of the user's command history, newest first.
+type History struct {
+	Commands []CommandRecord `json:"commands"`
+	Usage    *QuotaUsage     `json:"usage"`
+	// NextBefore fetches the next page when passed as before.
+	NextBefore *time.Time `json:"next_before,omitempty"`
+}
+
+// queryRower is a *sql.DB or *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// QuotaUsage reports what the user has spent today. Commands refused for
+// being over quota and confirmations don't count; running commands do.
+func (s *Service) QuotaUsage(userID uuid.UUID) (*QuotaUsage, error) {
+	return s.quotaUsage(s.DB, userID)
+}
+
+func (s *Service) quotaUsage(db queryRower, userID uuid.UUID) (*QuotaUsage, error) {
+	dayStart := time.Now().UTC().Truncate(24 * time.Hour)
+	usage := &QuotaUsage{
+		CommandLimit: s.DailyCommandLimit,
+		TokenLimit:   s.DailyTokenLimit,
+		ResetsAt:     dayStart.Add(24 * time.Hour),
+	}
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(prompt_tokens + completion_tokens), 0)
+		FROM agent_commands
+		WHERE user_id = $1 AND created_at >= $2 AND kind = $3 AND outcome <> $4
+	`, userID, dayStart, KindCommand, OutcomeOverQuota).Scan(&usage.Commands, &usage.Tokens)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// reserveCommand records a command as running before it runs, so it counts
+// against the daily quota straight away. The user's commands are counted and
+// reserved under a lock held for the transaction, so concurrent commands
+// can't all pass the check. It returns a *QuotaError once the user has spent
+// either of their daily quotas.
+func (s *Service) reserveCommand(ctx context.Context, userID uuid.UUID, command string, start time.Time) (uuid.UUID, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, userID.String()); err != nil {
+		rollback(tx)
+		return uuid.Nil, err
+	}
+	usage, err := s.quotaUsage(tx, userID)
+	if err != nil {
+		rollback(tx)
+		return uuid.Nil, err
+	}
+	if usage.Commands >= usage.CommandLimit || usage.Tokens >= usage.TokenLimit {
+		rollback(tx)
+		return uuid.Nil, &QuotaError{Usage: usage}
+	}
+	id := uuid.New()
+	_, err = tx.Exec(`
+		INSERT INTO agent_commands (id, user_id, kind, command, outcome, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, userID, KindCommand, command, OutcomeRunning, start.UTC())
+	if err != nil {
+		rollback(tx)
+		return uuid.Nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// newRecord describes how a command went. result may be nil, or hold what
+// was done before err.
+func newRecord(userID uuid.UUID, kind, command string, start time.Time, result *Result, err error) *CommandRecord {
+	record := &CommandRecord{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Kind:      kind,
+		Command:   command,
+		Outcome:   OutcomeSucceeded,
+		LatencyMS: time.Since(start).Milliseconds(),
+		CreatedAt: start.UTC(),
+	}
+	var calls []ToolCall
+	if result != nil {
+		if result.SessionID != uuid.Nil {
+			record.SessionID = &result.SessionID
+		}
+		calls, record.Steps, record.Action, record.Usage = result.Calls, result.Steps, result.Action, result.Usage
+		if result.Confirmation != nil {
+			record.Outcome = OutcomeAwaitingConfirmation
+		}
+	}
+	if calls == nil {
+		calls = []ToolCall{}
+	}
+	if record.Steps == nil {
+		record.Steps = []Step{}
+	}
+	record.Intent, _ = json.Marshal(calls)
+	if err != nil {
+		record.Outcome, record.Error = OutcomeFailed, err.Error()
+		if errors.Is(err, ErrQuotaExceeded) {
+			record.Outcome = OutcomeOverQuota
+		}
+	}
+	return record
+}
+
+// audit stores a command record. The command has already run, so a failure
+// is logged rather than reported.
+func (s *Service) audit(record *CommandRecord) {
+	steps, err := json.Marshal(record.Steps)
+	if err == nil {
+		_, err = s.DB.Exec(`
+			INSERT INTO agent_commands (id, user_id, session_id, kind, command, intent, steps, action, outcome, error,
+				latency_ms, prompt_tokens, completion_tokens, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		`, record.ID, record.UserID, record.SessionID, record.Kind, record.Command, []byte(record.Intent), steps,
+			record.Action, record.Outcome, record.Error, record.LatencyMS, record.PromptTokens, record.CompletionTokens,
+			record.CreatedAt)
+	}
+	if err != nil {
+		logger.Log.WithError(err).Errorf("Failed to audit agent command of user %s", record.UserID)
+	}
+}
+
+// finishCommand fills in the record of a command reserved by reserveCommand
+// with how it went. Like audit, a failure is logged rather than reported.
+func (s *Service) finishCommand(record *CommandRecord) {
+	steps, err := json.Marshal(record.Steps)
+	if err == nil {
+		_, err = s.DB.Exec(`
+			UPDATE agent_commands
+			SET session_id = $2, intent = $3, steps = $4, action = $5, outcome = $6, error = $7,
+				latency_ms = $8, prompt_tokens = $9, completion_tokens = $10
+			WHERE id = $1
+		`, record.ID, record.SessionID, []byte(record.Intent), steps, record.Action, record.Outcome, record.Error,
+			record.LatencyMS, record.PromptTokens, record.CompletionTokens)
+	}
+	if err != nil {
+		logger.Log.WithError(err).Errorf("Failed to audit agent command of user %s", record.UserID)
+	}
+}
+
+// History returns up to limit of the user's commands created before the
+// given time, newest first, with their quota usage today.
+func (s *Service) History(userID uuid.UUID, limit int, before time.Time) (*History, error) {
+	if limit <= 0 || limit > maxHistoryLimit {
+		limit = defaultHistoryLimit
+	}
+	rows, err := s.DB.Query(`
+		SELECT id, session_id, kind, command, intent, steps, action, outcome, error,
+			latency_ms, prompt_tokens, completion_tokens, created_at
+		FROM agent_commands
+		WHERE user_id = $1 AND created_at < $2
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, userID, before.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	history := &History{Commands: []CommandRecord{}}
+	for rows.Next() {
+		var record CommandRecord
+		var sessionID uuid.NullUUID
+		var intent, steps []byte
+		if err := rows.Scan(&record.ID, &sessionID, &record.Kind, &record.Command, &intent, &steps, &record.Action,
+			&record.Outcome, &record.Error, &record.LatencyMS, &record.PromptTokens, &record.CompletionTokens,
+			&record.CreatedAt); err != nil {
+			return nil, err
+		}
+		if sessionID.Valid {
+			record.SessionID = &sessionID.UUID
+		}
+		record.Intent = intent
+		if err := json.Unmarshal(steps, &record.Steps); err != nil {
+			return nil, err
+		}
+		history.Commands = append(history.Commands, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(history.Commands) == limit {
+		next := history.Commands[limit-1].CreatedAt
+		history.NextBefore = &next
+	}
+
+	history.Usage, err = s.QuotaUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
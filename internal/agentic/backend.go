@@ -0,0 +1,64 @@
+package agentic
+
+import (
+	"context"
+
+	"github.com/turanoo/bitebattle/internal/geocode"
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+const (
+	BackendVertex = "vertex"
+	BackendOpenAI = "openai"
+	BackendRules  = "rules"
+)
+
+// defaultLocation is used when a command names no location, matching the
+// instructions given to model backends (New York City).
+const defaultLocation = "40.7128,-74.0060"
+
+const defaultRadius = 10000 // meters
+
+// Model drives the agent loop. Given the conversation so far and the tools
+// it may call, it returns its next assistant turn: tool calls to run, or a
+// final reply. Tool arguments are validated later, by ToolCall.Decode.
+type Model interface {
+	Next(ctx context.Context, messages []Message, tools []Tool) (*Message, error)
+}
+
+// Summarizer is implemented by backends that can condense conversation
+// history or word the recap of a poll or match. Other backends keep a plain
+// summary or the recap templates instead.
+type Summarizer interface {
+	Summarize(ctx context.Context, transcript string) (string, error)
+}
+
+const summaryPrompt = `Instead of carrying out a command, summarize the text in the user_command block in at most five sentences. It is either a conversation between the user and the assistant, or the results of a poll or head-to-head match. Keep poll names, restaurant names, people's names, vote counts, locations and anything the user asked to change. Reply with the summary only.`
+
+// summarizeWith asks a model, without tools, to summarize a transcript. The
+// transcript is sent as user text, so it is delimited like a command.
+func summarizeWith(ctx context.Context, m Model, transcript string) (string, error) {
+	reply, err := m.Next(ctx, []Message{{Role: RoleSystem, Content: summaryPrompt}, {Role: RoleUser, Content: transcript}}, nil)
+	if err != nil {
+		return "", err
+	}
+	return reply.Content, nil
+}
+
+// NewModel returns the backend selected in the agent config section,
+// defaulting to Vertex AI. The rule-based backend resolves locations with
+// geocoder.
+func NewModel(cfg *config.Config, geocoder geocode.Geocoder) Model {
+	switch cfg.Agent.Backend {
+	case BackendVertex, "":
+		return NewVertexAIClient(cfg)
+	case BackendOpenAI:
+		return NewOpenAIClient(cfg)
+	case BackendRules:
+		return NewRuleParser(geocoder)
+	default:
+		logger.Warnf("Unknown agent backend %q, falling back to Vertex AI", cfg.Agent.Backend)
+		return NewVertexAIClient(cfg)
+	}
+}
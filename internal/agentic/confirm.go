@@ -0,0 +1,146 @@
+package agentic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/pkg/logger"
+	"github.com/turanoo/bitebattle/pkg/utils"
+)
+
+// ConfirmationTTL is how long an action waits for the user to confirm it.
+const ConfirmationTTL = 10 * time.Minute
+
+const confirmationTokenBytes = 24
+
+// confirmationNeeded describes the effect on other people of an action that
+// must be confirmed, or returns "" if it can run straight away. Starting a
+// match invites someone, closing a poll ends voting for its other members,
+// and adding options changes a poll someone else owns. Poll names are
+// replaced with the ID of the poll they resolve to, so that a held action
+// runs against the poll the user confirmed even if names change meanwhile.
+func (s *Service) confirmationNeeded(userID uuid.UUID, decoded interface{}) (string, error) {
+	switch args := decoded.(type) {
+	case *StartMatchArgs:
+		return fmt.Sprintf("Starting a head-to-head match invites %s.", args.Friend), nil
+	case *ClosePollArgs:
+		p, err := s.findPoll(userID, args.Poll)
+		if err != nil {
+			return "", err
+		}
+		args.Poll = p.ID.String()
+		others := 0
+		for _, member := range p.Members {
+			if member != userID {
+				others++
+			}
+		}
+		if others > 0 {
+			return fmt.Sprintf("Closing %q ends voting for its %d other members.", p.Name, others), nil
+		}
+	case *AddOptionsArgs:
+		p, err := s.findPoll(userID, args.Poll)
+		if err != nil {
+			return "", err
+		}
+		args.Poll = p.ID.String()
+		if p.CreatedBy != userID {
+			return fmt.Sprintf("Adding options changes %q, which someone else owns.", p.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// holdForConfirmation stores the call under a single-use token.
+func (s *Service) holdForConfirmation(userID uuid.UUID, call ToolCall, message string) (*Confirmation, error) {
+	token, err := utils.GenerateSecureToken(confirmationTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ConfirmationTTL)
+
+	// Expired confirmations are only ever looked up by their owner, so they
+	// are cleared out here rather than by a background job.
+	if _, err := s.DB.Exec(`DELETE FROM agent_confirmations WHERE user_id = $1 AND expires_at <= $2`, userID, now); err != nil {
+		return nil, err
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO agent_confirmations (token, user_id, tool, args, message, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, token, userID, call.Name, []byte(call.Args), message, expiresAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Confirmation{Token: token, Action: call.Name, Message: message, ExpiresAt: expiresAt}, nil
+}
+
+// Confirm carries out the action a confirmation token holds. The token is
+// claimed while the action runs and consumed if it succeeds; a failed action
+// can be confirmed again. The outcome is audited like a command.
+// Tokens belong to the user they were issued to.
+func (s *Service) Confirm(ctx context.Context, userID uuid.UUID, token string) (*Result, error) {
+	start := time.Now()
+	message, result, err := s.confirm(ctx, userID, token)
+	if !errors.Is(err, ErrConfirmationInvalid) {
+		s.audit(newRecord(userID, KindConfirmation, message, start, result, err))
+	}
+	return result, err
+}
+
+func (s *Service) confirm(ctx context.Context, userID uuid.UUID, token string) (string, *Result, error) {
+	// Claiming the token first means a token confirmed twice at once runs
+	// its action only once, without holding a transaction open meanwhile.
+	var call ToolCall
+	var message string
+	var args []byte
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE agent_confirmations SET claimed_at = $3
+		WHERE token = $1 AND user_id = $2 AND expires_at > $3 AND claimed_at IS NULL
+		RETURNING tool, args, message
+	`, token, userID, time.Now()).Scan(&call.Name, &args, &message)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrConfirmationInvalid
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	call.Args = args
+
+	decoded, err := call.Decode()
+	var out *ToolResult
+	if err == nil {
+		out, err = s.execute(ctx, userID, decoded)
+	}
+	if err != nil {
+		// The action failed, so the token can be confirmed again.
+		if _, releaseErr := s.DB.Exec(`UPDATE agent_confirmations SET claimed_at = NULL WHERE token = $1`, token); releaseErr != nil {
+			logger.Log.WithError(releaseErr).Error("Failed to release agent confirmation")
+		}
+		return message, nil, err
+	}
+
+	// The action has run, so a failure to delete the token is logged; the
+	// claim keeps it from running again.
+	if _, err := s.DB.Exec(`DELETE FROM agent_confirmations WHERE token = $1`, token); err != nil {
+		logger.Log.WithError(err).Error("Failed to delete used agent confirmation")
+	}
+	return message, &Result{
+		Action:  call.Name,
+		Message: out.Message,
+		Data:    out.Data,
+		Steps:   []Step{{Tool: call.Name, Message: out.Message}},
+		Calls:   []ToolCall{call},
+	}, nil
+}
+
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil {
+		logger.Log.WithError(err).Error("failed to rollback transaction")
+	}
+}
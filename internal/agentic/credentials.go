@@ -0,0 +1,257 @@
+package agentic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+// Credential sources for Vertex AI, set with agent.vertex.credentials.
+const (
+	CredentialsAuto     = "auto"
+	CredentialsMetadata = "metadata"
+	CredentialsADC      = "adc"
+	CredentialsToken    = "token"
+)
+
+// MetadataTokenURL is where the metadata server of GCE and Cloud Run hands
+// out tokens for the instance's service account.
+const MetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// vertexScope is the OAuth scope Vertex AI requests need.
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// tokenExpiryMargin is how long before its expiry a token is replaced, so a
+// request doesn't leave with a token that lapses on the way.
+const tokenExpiryMargin = time.Minute
+
+var ErrNoToken = errors.New("credentials returned no access token")
+
+// AccessToken is an OAuth access token. A zero Expiry never expires.
+type AccessToken struct {
+	Value  string
+	Expiry time.Time
+}
+
+func (t *AccessToken) valid(now time.Time) bool {
+	return t != nil && t.Value != "" && (t.Expiry.IsZero() || t.Expiry.After(now.Add(tokenExpiryMargin)))
+}
+
+// Credentials fetch access tokens for Google APIs. Implementations needn't
+// cache tokens; wrap them in a TokenCache.
+type Credentials interface {
+	Token(ctx context.Context) (*AccessToken, error)
+}
+
+// StaticCredentials always return the same token, as printed by
+// `gcloud auth print-access-token`. For development only: the token lapses
+// after an hour.
+type StaticCredentials string
+
+func (s StaticCredentials) Token(ctx context.Context) (*AccessToken, error) {
+	if s == "" {
+		return nil, ErrNoToken
+	}
+	return &AccessToken{Value: string(s)}, nil
+}
+
+// MetadataCredentials fetch the service account token of the GCE or Cloud
+// Run instance from its metadata server.
+type MetadataCredentials struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewMetadataCredentials(client *http.Client) *MetadataCredentials {
+	return &MetadataCredentials{URL: MetadataTokenURL, Client: client}
+}
+
+func (m *MetadataCredentials) Token(ctx context.Context) (*AccessToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("metadata server error: %s: %s", resp.Status, string(body))
+	}
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+	return &AccessToken{
+		Value:  tokenResp.AccessToken,
+		Expiry: time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// ADCCredentials use Application Default Credentials: the service account
+// key named by GOOGLE_APPLICATION_CREDENTIALS, gcloud's user credentials, or
+// the metadata server. With File set, that service account key is used
+// instead. The credentials are looked up on first use.
+type ADCCredentials struct {
+	File   string
+	Client *http.Client
+
+	mu     sync.Mutex
+	source oauth2.TokenSource
+}
+
+func (a *ADCCredentials) Token(ctx context.Context) (*AccessToken, error) {
+	source, err := a.tokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := source.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &AccessToken{Value: token.AccessToken, Expiry: token.Expiry}, nil
+}
+
+func (a *ADCCredentials) tokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.source != nil {
+		return a.source, nil
+	}
+
+	// The token source keeps the context for later refreshes.
+	ctx = context.WithoutCancel(ctx)
+	if a.Client != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, a.Client)
+	}
+	var creds *google.Credentials
+	var err error
+	if a.File != "" {
+		var data []byte
+		if data, err = os.ReadFile(a.File); err != nil {
+			return nil, fmt.Errorf("failed to read credentials file: %w", err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, vertexScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, vertexScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Google credentials: %w", err)
+	}
+	a.source = creds.TokenSource
+	return a.source, nil
+}
+
+// TokenCache keeps the token of its credentials until shortly before it
+// expires. It is safe for concurrent use, and concurrent callers that find
+// the token missing or stale share a single fetch.
+type TokenCache struct {
+	Credentials Credentials
+
+	mu    sync.Mutex
+	token *AccessToken
+	group singleflight.Group
+}
+
+func NewTokenCache(creds Credentials) *TokenCache {
+	return &TokenCache{Credentials: creds}
+}
+
+func (c *TokenCache) Token(ctx context.Context) (*AccessToken, error) {
+	if token := c.cached(); token != nil {
+		return token, nil
+	}
+
+	v, err, _ := c.group.Do("token", func() (interface{}, error) {
+		// Another fetch may have finished since the check above.
+		if token := c.cached(); token != nil {
+			return token, nil
+		}
+		// Waiters share this fetch, so one caller going away must not
+		// cancel it.
+		token, err := c.Credentials.Token(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.token = token
+		c.mu.Unlock()
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*AccessToken), nil
+}
+
+// cached returns the cached token unless it is missing or about to expire.
+func (c *TokenCache) cached() *AccessToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token.valid(time.Now()) {
+		return c.token
+	}
+	return nil
+}
+
+// Invalidate drops the cached token, for when a request using it was
+// rejected.
+func (c *TokenCache) Invalidate() {
+	c.mu.Lock()
+	c.token = nil
+	c.mu.Unlock()
+}
+
+// NewCredentials returns the credentials selected in the agent.vertex
+// config section, cached. The default, auto, uses the configured auth_token
+// if there is one and Application Default Credentials otherwise.
+func NewCredentials(cfg *config.Config, client *http.Client) Credentials {
+	vertex := cfg.Agent.Vertex
+	var creds Credentials
+	switch vertex.Credentials {
+	case CredentialsToken:
+		creds = StaticCredentials(vertex.AuthToken)
+	case CredentialsMetadata:
+		creds = NewMetadataCredentials(client)
+	case CredentialsADC:
+		creds = &ADCCredentials{File: vertex.CredentialsFile, Client: client}
+	case CredentialsAuto, "":
+		if vertex.AuthToken != "" {
+			creds = StaticCredentials(vertex.AuthToken)
+		} else {
+			creds = &ADCCredentials{File: vertex.CredentialsFile, Client: client}
+		}
+	default:
+		logger.Warnf("Unknown Vertex AI credentials %q, using Application Default Credentials", vertex.Credentials)
+		creds = &ADCCredentials{File: vertex.CredentialsFile, Client: client}
+	}
+	return NewTokenCache(creds)
+}
@@ -0,0 +1,408 @@
+// Package eval scores an agent model's first tool call for each command in
+// a corpus against the call expected, so parser and prompt changes can be
+// compared run to run.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/turanoo/bitebattle/internal/agentic"
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+// FieldTool and FieldValid are scored for every case: whether the expected
+// tool was called, and whether its arguments passed validation.
+const (
+	FieldTool  = "tool"
+	FieldValid = "valid"
+)
+
+// DefaultToleranceKM is how far a location may be from the expected one
+// and still count as correct.
+const DefaultToleranceKM = 5.0
+
+// Case is a command and the tool call it should produce. Only the fields in
+// Args are scored; a "lat,lng" location is compared by distance.
+type Case struct {
+	Command string                 `json:"command"`
+	Tool    string                 `json:"tool"`
+	Args    map[string]interface{} `json:"args"`
+}
+
+// LoadCorpus reads a JSON array of cases.
+func LoadCorpus(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("invalid corpus %s: %w", path, err)
+	}
+	for i, c := range cases {
+		if c.Command == "" || c.Tool == "" {
+			return nil, fmt.Errorf("invalid corpus %s: case %d needs a command and a tool", path, i)
+		}
+	}
+	return cases, nil
+}
+
+// Score is how often a field was right.
+type Score struct {
+	Correct  int     `json:"correct"`
+	Total    int     `json:"total"`
+	Accuracy float64 `json:"accuracy"`
+}
+
+// LocationError summarizes how far predicted coordinates were from the
+// expected ones. Missing counts cases where no coordinates came back.
+type LocationError struct {
+	Count    int     `json:"count"`
+	Missing  int     `json:"missing"`
+	MeanKM   float64 `json:"mean_km"`
+	MedianKM float64 `json:"median_km"`
+	MaxKM    float64 `json:"max_km"`
+}
+
+// CaseResult is how the model did on one case.
+type CaseResult struct {
+	Command    string          `json:"command"`
+	Tool       string          `json:"tool,omitempty"`
+	Args       json.RawMessage `json:"args,omitempty"`
+	Mismatches []string        `json:"mismatches,omitempty"`
+	ErrorKM    *float64        `json:"error_km,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Backend       string            `json:"backend"`
+	PromptVersion string            `json:"prompt_version"`
+	StartedAt     time.Time         `json:"started_at"`
+	Cases         int               `json:"cases"`
+	ExactMatches  int               `json:"exact_matches"`
+	Fields        map[string]*Score `json:"fields"`
+	Location      LocationError     `json:"location"`
+	Results       []CaseResult      `json:"results"`
+}
+
+// ExactMatchRate is the share of cases with every field right.
+func (r *Report) ExactMatchRate() float64 {
+	if r.Cases == 0 {
+		return 0
+	}
+	return float64(r.ExactMatches) / float64(r.Cases)
+}
+
+// Evaluate sends each command to the model as the start of a conversation
+// and scores the first tool call it makes. toleranceKM is how far off a
+// location may be; DefaultToleranceKM is used when it is zero.
+func Evaluate(ctx context.Context, backend string, model agentic.Model, cases []Case, toleranceKM float64) *Report {
+	if toleranceKM <= 0 {
+		toleranceKM = DefaultToleranceKM
+	}
+	report := &Report{
+		Backend:       backend,
+		PromptVersion: agentic.PromptVersion(),
+		StartedAt:     time.Now().UTC(),
+		Cases:         len(cases),
+		Fields:        map[string]*Score{},
+	}
+	var distances []float64
+
+	for _, c := range cases {
+		result := CaseResult{Command: c.Command}
+		var got map[string]interface{}
+		valid := false
+
+		reply, err := model.Next(ctx, []agentic.Message{{Role: agentic.RoleUser, Content: c.Command}}, agentic.Tools)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case len(reply.ToolCalls) == 0:
+			result.Error = "no tool call"
+		default:
+			call := reply.ToolCalls[0]
+			result.Tool, result.Args = call.Name, call.Args
+			if err := json.Unmarshal(call.Args, &got); err != nil {
+				result.Error = "arguments are not a JSON object"
+			}
+			if _, err := call.Decode(); err != nil {
+				result.Error = err.Error()
+			} else {
+				valid = true
+			}
+		}
+
+		toolRight := result.Tool == c.Tool
+		report.score(FieldTool, toolRight, &result)
+		report.score(FieldValid, valid, &result)
+
+		names := make([]string, 0, len(c.Args))
+		for name := range c.Args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			want := c.Args[name]
+			if name == "location" {
+				if point, err := parseLocation(want); err == nil {
+					km, ok := distanceKM(point, got["location"])
+					if toolRight && ok {
+						distances = append(distances, km)
+						result.ErrorKM = &km
+					} else {
+						report.Location.Missing++
+					}
+					report.score(name, toolRight && ok && km <= toleranceKM, &result)
+					continue
+				}
+			}
+			report.score(name, toolRight && equal(want, got[name]), &result)
+		}
+
+		if len(result.Mismatches) == 0 {
+			report.ExactMatches++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	for _, s := range report.Fields {
+		s.Accuracy = float64(s.Correct) / float64(s.Total)
+	}
+	report.Location.summarize(distances)
+	return report
+}
+
+func (r *Report) score(field string, correct bool, result *CaseResult) {
+	s := r.Fields[field]
+	if s == nil {
+		s = &Score{}
+		r.Fields[field] = s
+	}
+	s.Total++
+	if correct {
+		s.Correct++
+	} else {
+		result.Mismatches = append(result.Mismatches, field)
+	}
+}
+
+func (l *LocationError) summarize(distances []float64) {
+	l.Count = len(distances)
+	if l.Count == 0 {
+		return
+	}
+	sort.Float64s(distances)
+	sum := 0.0
+	for _, d := range distances {
+		sum += d
+	}
+	l.MeanKM = sum / float64(l.Count)
+	l.MaxKM = distances[l.Count-1]
+	if l.Count%2 == 1 {
+		l.MedianKM = distances[l.Count/2]
+	} else {
+		l.MedianKM = (distances[l.Count/2-1] + distances[l.Count/2]) / 2
+	}
+}
+
+func parseLocation(v interface{}) (geo.Point, error) {
+	s, ok := v.(string)
+	if !ok {
+		return geo.Point{}, geo.ErrInvalidLatLng
+	}
+	return geo.ParseLatLng(s)
+}
+
+// distanceKM is the distance from want to a predicted location, if that
+// location is "lat,lng".
+func distanceKM(want geo.Point, got interface{}) (float64, bool) {
+	point, err := parseLocation(got)
+	if err != nil {
+		return 0, false
+	}
+	return geo.DistanceMeters(want, point) / 1000, true
+}
+
+// equal compares expected and predicted values. Strings are compared
+// without regard to case or surrounding space, and lists without regard to
+// order.
+func equal(want, got interface{}) bool {
+	switch w := want.(type) {
+	case string:
+		g, ok := got.(string)
+		return ok && strings.EqualFold(strings.TrimSpace(w), strings.TrimSpace(g))
+	case float64:
+		g, ok := got.(float64)
+		return ok && math.Abs(w-g) < 1e-9
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(w) != len(g) {
+			return false
+		}
+		used := make([]bool, len(g))
+	next:
+		for _, item := range w {
+			for i := range g {
+				if !used[i] && equal(item, g[i]) {
+					used[i] = true
+					continue next
+				}
+			}
+			return false
+		}
+		return true
+	}
+	return want == got
+}
+
+// Delta is the change in a field's accuracy between two runs.
+type Delta struct {
+	Field string  `json:"field"`
+	Base  float64 `json:"base"`
+	Head  float64 `json:"head"`
+}
+
+func (d Delta) Change() float64 {
+	return d.Head - d.Base
+}
+
+// Compare lists the change in every field's accuracy from base to head,
+// exact matches first. Fields scored in only one run count as 0 in the
+// other.
+func Compare(base, head *Report) []Delta {
+	deltas := []Delta{{Field: "exact_match", Base: base.ExactMatchRate(), Head: head.ExactMatchRate()}}
+	names := map[string]bool{}
+	for name := range base.Fields {
+		names[name] = true
+	}
+	for name := range head.Fields {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		d := Delta{Field: name}
+		if s := base.Fields[name]; s != nil {
+			d.Base = s.Accuracy
+		}
+		if s := head.Fields[name]; s != nil {
+			d.Head = s.Accuracy
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// Regressions are the deltas where accuracy dropped.
+func Regressions(deltas []Delta) []Delta {
+	var worse []Delta
+	for _, d := range deltas {
+		if d.Change() < -1e-9 {
+			worse = append(worse, d)
+		}
+	}
+	return worse
+}
+
+// LoadReport reads a report written by WriteJSON.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// WriteJSON saves the report for a later run to compare against.
+func (r *Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Print writes the report as tables: accuracy per field, location error and
+// the cases that missed.
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "backend %s, prompt %s: %d/%d cases exact (%.1f%%)\n\n",
+		r.Backend, r.PromptVersion, r.ExactMatches, r.Cases, 100*r.ExactMatchRate())
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tCORRECT\tTOTAL\tACCURACY")
+	for _, name := range r.fieldNames() {
+		s := r.Fields[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\n", name, s.Correct, s.Total, 100*s.Accuracy)
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintf(w, "\nlocation error: %d located, %d missing, mean %.2f km, median %.2f km, max %.2f km\n",
+		r.Location.Count, r.Location.Missing, r.Location.MeanKM, r.Location.MedianKM, r.Location.MaxKM)
+
+	var misses []CaseResult
+	for _, result := range r.Results {
+		if len(result.Mismatches) > 0 {
+			misses = append(misses, result)
+		}
+	}
+	if len(misses) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nmisses:")
+	for _, result := range misses {
+		fmt.Fprintf(w, "  %q: wrong %s; got %s %s", result.Command, strings.Join(result.Mismatches, ", "), result.Tool, result.Args)
+		if result.Error != "" {
+			fmt.Fprintf(w, " (%s)", result.Error)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// PrintComparison writes the accuracy of each field in both runs.
+func PrintComparison(w io.Writer, base, head *Report) {
+	fmt.Fprintf(w, "compared with %s (prompt %s, %s):\n\n", base.Backend, base.PromptVersion, base.StartedAt.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tBASE\tHEAD\tCHANGE")
+	for _, d := range Compare(base, head) {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\t%+.1f\n", d.Field, 100*d.Base, 100*d.Head, 100*d.Change())
+	}
+	fmt.Fprintf(tw, "mean location error\t%.2f km\t%.2f km\t%+.2f\n",
+		base.Location.MeanKM, head.Location.MeanKM, head.Location.MeanKM-base.Location.MeanKM)
+	_ = tw.Flush()
+}
+
+// fieldNames lists the tool and validity fields first, then the arguments
+// alphabetically.
+func (r *Report) fieldNames() []string {
+	names := []string{}
+	for name := range r.Fields {
+		if name != FieldTool && name != FieldValid {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range []string{FieldValid, FieldTool} {
+		if r.Fields[name] != nil {
+			names = append([]string{name}, names...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package agentic
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrScriptExhausted is returned by FakeModel once every step has been used.
+var ErrScriptExhausted = errors.New("fake model script exhausted")
+
+// FakeStep is one scripted FakeModel turn.
+type FakeStep struct {
+	Reply *Message
+	Err   error
+}
+
+// FakeModel replays a script of turns in order, for tests. Calls records
+// the conversation it was given on each turn.
+type FakeModel struct {
+	mu     sync.Mutex
+	Script []FakeStep
+	Calls  [][]Message
+}
+
+func NewFakeModel(steps ...FakeStep) *FakeModel {
+	return &FakeModel{Script: steps}
+}
+
+func (f *FakeModel) Next(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls = append(f.Calls, append([]Message(nil), messages...))
+	if len(f.Calls) > len(f.Script) {
+		return nil, ErrScriptExhausted
+	}
+	step := f.Script[len(f.Calls)-1]
+	if step.Err != nil {
+		return nil, step.Err
+	}
+	reply := *step.Reply
+	reply.Role = RoleAssistant
+	return &reply, nil
+}
@@ -0,0 +1,165 @@
+package agentic
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+// maxTextLength caps free text in tool arguments, such as the food of a
+// poll or a restaurant name.
+const maxTextLength = 100
+
+// ParseError reports tool arguments from the model that failed validation.
+// It is returned to the client as is, and wraps ErrInvalidCommand.
+type ParseError struct {
+	Tool     string   `json:"tool"`
+	Problems []string `json:"problems"`
+}
+
+func (e *ParseError) Error() string {
+	if e.Tool == "" {
+		return fmt.Sprintf("%v: %s", ErrInvalidCommand, strings.Join(e.Problems, "; "))
+	}
+	return fmt.Sprintf("%v: %s arguments: %s", ErrInvalidCommand, e.Tool, strings.Join(e.Problems, "; "))
+}
+
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidCommand
+}
+
+var delimiterTag = regexp.MustCompile(`(?i)<\s*/?\s*(user_command|session_context)\s*>`)
+
+// guardUserText delimits text the user wrote before it goes to a model, so
+// the system prompt can tell it apart from instructions. Delimiters in the
+// text itself are removed so it can't close the block early.
+func guardUserText(text string) string {
+	return "<user_command>\n" + delimiterTag.ReplaceAllString(text, "") + "\n</user_command>"
+}
+
+// guardContext delimits session context the same way. The context is built
+// from earlier commands, summaries of them and poll names, all of which the
+// user wrote.
+func guardContext(text string) string {
+	return "<session_context>\n" + delimiterTag.ReplaceAllString(text, "") + "\n</session_context>"
+}
+
+// cleanText drops control and invisible formatting characters, which have
+// no place in a restaurant search, and collapses whitespace.
+func cleanText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (unicode.IsControl(r) && !unicode.IsSpace(r)) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// checkText cleans a required free text argument in place and describes
+// what is wrong with it, if anything.
+func checkText(field string, s *string) []string {
+	*s = cleanText(*s)
+	switch {
+	case *s == "":
+		return []string{field + " is empty"}
+	case len([]rune(*s)) > maxTextLength:
+		return []string{fmt.Sprintf("%s must be at most %d characters", field, maxTextLength)}
+	}
+	return nil
+}
+
+// checkLatLng checks a "lat,lng" argument is in range.
+func checkLatLng(field string, s *string) []string {
+	*s = strings.TrimSpace(*s)
+	if _, err := geo.ParseLatLng(*s); err != nil {
+		return []string{field + ": " + err.Error()}
+	}
+	return nil
+}
+
+// looksLikeLatLng reports whether s is two numbers separated by a comma,
+// whether or not they are in range.
+func looksLikeLatLng(s string) bool {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizer is implemented by tool arguments that need checks beyond their
+// binding tags. sanitize cleans the arguments in place and describes what
+// is still wrong with them.
+type sanitizer interface {
+	sanitize() []string
+}
+
+func (a *SearchRestaurantsArgs) sanitize() []string {
+	problems := checkText("query", &a.Query)
+	problems = append(problems, checkText("location", &a.Location)...)
+	if looksLikeLatLng(a.Location) {
+		problems = append(problems, checkLatLng("location", &a.Location)...)
+	}
+	return problems
+}
+
+func (a *CreatePollArgs) sanitize() []string {
+	problems := checkText("food", &a.Food)
+	return append(problems, checkLatLng("location", &a.Location)...)
+}
+
+func (a *AddOptionsArgs) sanitize() []string {
+	problems := checkText("poll", &a.Poll)
+	for i := range a.Restaurants {
+		problems = append(problems, checkText(fmt.Sprintf("restaurants[%d]", i), &a.Restaurants[i])...)
+	}
+	if strings.TrimSpace(a.Location) != "" {
+		problems = append(problems, checkLatLng("location", &a.Location)...)
+	}
+	return problems
+}
+
+func (a *VoteArgs) sanitize() []string {
+	problems := checkText("poll", &a.Poll)
+	return append(problems, checkText("option", &a.Option)...)
+}
+
+func (a *ClosePollArgs) sanitize() []string {
+	return checkText("poll", &a.Poll)
+}
+
+func (a *StartMatchArgs) sanitize() []string {
+	var problems []string
+	for i := range a.Categories {
+		problems = append(problems, checkText(fmt.Sprintf("categories[%d]", i), &a.Categories[i])...)
+	}
+	return problems
+}
+
+func (a *SummarizeArgs) sanitize() []string {
+	return checkText("poll", &a.Poll)
+}
+
+func (a *RecommendArgs) sanitize() []string {
+	var problems []string
+	if strings.TrimSpace(a.Poll) != "" {
+		problems = append(problems, checkText("poll", &a.Poll)...)
+	}
+	if strings.TrimSpace(a.Food) != "" {
+		problems = append(problems, checkText("food", &a.Food)...)
+	}
+	if strings.TrimSpace(a.Location) != "" {
+		problems = append(problems, checkLatLng("location", &a.Location)...)
+	}
+	return problems
+}
@@ -1,12 +1,23 @@
 package agentic
 
 import (
-	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"github.com/turanoo/bitebattle/internal/auth"
+	"github.com/turanoo/bitebattle/internal/head2head"
+	"github.com/turanoo/bitebattle/internal/poll"
+	"github.com/turanoo/bitebattle/internal/restaurant"
 	"github.com/turanoo/bitebattle/pkg/logger"
+	"github.com/turanoo/bitebattle/pkg/utils"
 )
 
 type Handler struct {
@@ -18,8 +29,102 @@ func NewHandler(service *Service) *Handler {
 }
 
 func (h *Handler) Command(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, req, ok := bindCommand(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.Service.OrchestrateCommand(c.Request.Context(), userID, req.sessionID(), req.Command)
+	if err != nil {
+		writeAgenticError(c, err)
+		return
+	}
+	log.Infof("command succeeded in %d steps: %s", len(result.Steps), result.Action)
+	writeResult(c, result)
+}
+
+// StreamCommand runs a command like Command, sending progress as
+// server-sent events and the response as a final done or error event. The
+// command is cancelled if the client disconnects.
+func (h *Handler) StreamCommand(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, req, ok := bindCommand(c)
+	if !ok {
+		return
+	}
+
+	type event struct {
+		name string
+		data interface{}
+	}
+	ctx := c.Request.Context()
+	events := make(chan event, 16)
+	send := func(name string, data interface{}) {
+		select {
+		case events <- event{name, data}:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(events)
+		result, err := h.Service.OrchestrateCommand(WithProgress(ctx, send), userID, req.sessionID(), req.Command)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Info("command stream cancelled by client")
+				return
+			}
+			status := errorStatus(err)
+			logCommandError(log.WithError(err), status)
+			event := gin.H{"status": status, "message": err.Error()}
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				event["error"] = parseErr
+			}
+			send(EventError, event)
+			return
+		}
+		log.Infof("streamed command succeeded in %d steps: %s", len(result.Steps), result.Action)
+		send(EventDone, newResponse(result))
+	}()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		e, ok := <-events
+		if !ok {
+			return false
+		}
+		c.SSEvent(e.name, e.data)
+		return true
+	})
+}
+
+// bindCommand reads a command request, responding with an error if it is
+// invalid.
+func bindCommand(c *gin.Context) (uuid.UUID, AgenticRequest, bool) {
 	log := logger.FromContext(c)
 	var req AgenticRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.WithError(err).Warn("invalid request")
+		c.JSON(http.StatusBadRequest, AgenticResponse{Success: false, Message: "invalid request: " + err.Error()})
+		return uuid.Nil, req, false
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("unauthorized")
+		c.JSON(http.StatusUnauthorized, AgenticResponse{Success: false, Message: "unauthorized: " + err.Error()})
+		return uuid.Nil, req, false
+	}
+	return userID, req, true
+}
+
+// Confirm carries out an action the agent left waiting for confirmation.
+func (h *Handler) Confirm(c *gin.Context) {
+	log := logger.FromContext(c)
+	var req ConfirmRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.WithError(err).Warn("invalid request")
 		c.JSON(http.StatusBadRequest, AgenticResponse{Success: false, Message: "invalid request: " + err.Error()})
@@ -33,12 +138,120 @@ func (h *Handler) Command(c *gin.Context) {
 		return
 	}
 
-	result, err := h.Service.OrchestrateCommand(context.Background(), userID, req.Command)
+	result, err := h.Service.Confirm(c.Request.Context(), userID, req.Token)
 	if err != nil {
-		log.WithError(err).Error("command failed")
-		c.JSON(http.StatusInternalServerError, AgenticResponse{Success: false, Message: err.Error()})
+		writeAgenticError(c, err)
 		return
 	}
-	log.Info("command succeeded")
-	c.JSON(http.StatusOK, AgenticResponse{Success: true, Message: "ok", Data: result})
+	log.Infof("confirmed action: %s", result.Action)
+	writeResult(c, result)
+}
+
+// History lists the caller's commands, newest first, with their quota usage
+// today. Pass next_before from a page as before to get the next one.
+func (h *Handler) History(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("unauthorized")
+		utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized: "+err.Error())
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxHistoryLimit {
+			utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+	}
+	before := time.Now()
+	if v := c.Query("before"); v != "" {
+		if before, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "before must be an RFC 3339 time")
+			return
+		}
+	}
+
+	history, err := h.Service.History(userID, limit, before)
+	if err != nil {
+		log.WithError(err).Error("failed to fetch command history")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "could not fetch command history")
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// writeResult responds 202 Accepted while an action waits for confirmation.
+func writeResult(c *gin.Context, result *Result) {
+	status := http.StatusOK
+	if result.Confirmation != nil {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, newResponse(result))
+}
+
+func newResponse(result *Result) AgenticResponse {
+	sessionID := ""
+	if result.SessionID != uuid.Nil {
+		sessionID = result.SessionID.String()
+	}
+	return AgenticResponse{
+		Success:      true,
+		SessionID:    sessionID,
+		Action:       result.Action,
+		Message:      result.Message,
+		Data:         result.Data,
+		Steps:        result.Steps,
+		Confirmation: result.Confirmation,
+	}
+}
+
+// writeAgenticError responds with the status for err, keeping the agent's
+// response shape.
+func writeAgenticError(c *gin.Context, err error) {
+	status := errorStatus(err)
+	logCommandError(logger.FromContext(c).WithError(err), status)
+	response := AgenticResponse{Success: false, Message: err.Error()}
+	errors.As(err, &response.Error)
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		retryAfter := int(time.Until(quotaErr.Usage.ResetsAt).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+	c.JSON(status, response)
+}
+
+func logCommandError(log *logrus.Entry, status int) {
+	if status == http.StatusInternalServerError {
+		log.Error("command failed")
+	} else {
+		log.Warn("command rejected")
+	}
+}
+
+// errorStatus maps the errors of the services a command drives to a status.
+func errorStatus(err error) int {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidCommand), errors.Is(err, ErrAmbiguousPoll), errors.Is(err, ErrAmbiguousOption),
+		errors.Is(err, poll.ErrInvalidInviteCode), errors.Is(err, head2head.ErrNoInvitees),
+		errors.Is(err, head2head.ErrTooManyPlayers), errors.Is(err, restaurant.ErrInvalidSearch):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrPollNotFound), errors.Is(err, ErrOptionNotFound), errors.Is(err, sql.ErrNoRows),
+		errors.Is(err, ErrConfirmationInvalid), errors.Is(err, ErrSessionNotFound),
+		errors.Is(err, ErrNoRestaurants):
+		status = http.StatusNotFound
+	case errors.Is(err, poll.ErrNotPollOwner):
+		status = http.StatusForbidden
+	case errors.Is(err, poll.ErrPollClosed), errors.Is(err, poll.ErrAlreadyMember):
+		status = http.StatusConflict
+	case errors.Is(err, ErrStepLimit):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, ErrQuotaExceeded), errors.Is(err, restaurant.ErrRateLimited):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, restaurant.ErrProviderUnavailable):
+		status = http.StatusServiceUnavailable
+	}
+	return status
 }
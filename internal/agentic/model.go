@@ -1,17 +1,252 @@
 package agentic
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
 type AgenticRequest struct {
-	Command string `json:"command" binding:"required"`
+	Command string `json:"command" binding:"required,max=500"`
+	// SessionID continues an earlier conversation. Without it a new session
+	// is started.
+	SessionID string `json:"session_id" binding:"omitempty,uuid"`
 }
 
 type AgenticResponse struct {
-	Success bool        `json:"success"`
+	Success   bool   `json:"success"`
+	SessionID string `json:"session_id,omitempty"`
+	// Action is the last action that was carried out, such as "cast_vote".
+	Action  string      `json:"action,omitempty"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	// Steps lists every tool the agent called, in order.
+	Steps []Step `json:"steps,omitempty"`
+	// Confirmation is set when an action waits for the user to confirm it.
+	Confirmation *Confirmation `json:"confirmation,omitempty"`
+	// Error describes tool arguments the agent couldn't get right.
+	Error *ParseError `json:"error,omitempty"`
+}
+
+// sessionID returns the session to continue, or uuid.Nil for a new one.
+func (r AgenticRequest) sessionID() uuid.UUID {
+	id, err := uuid.Parse(r.SessionID) // validated by binding
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// ConfirmRequest carries out an action the agent left pending.
+type ConfirmRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Tools the agent can call.
+const (
+	ToolSearchRestaurants = "search_restaurants"
+	ToolCreatePoll        = "create_poll"
+	ToolJoinPoll          = "join_poll"
+	ToolAddOptions        = "add_options"
+	ToolCastVote          = "cast_vote"
+	ToolClosePoll         = "close_poll"
+	ToolStartMatch        = "start_match"
+	ToolSummarizePoll     = "summarize_poll"
+	ToolSummarizeMatch    = "summarize_match"
+	ToolRecommendOptions  = "recommend_options"
+)
+
+// Conversation roles. System messages carry fixed instructions only.
+// Context messages carry session state, such as the summary of earlier turns
+// and the current poll; they hold user text, so backends send them delimited
+// like a command rather than as instructions.
+const (
+	RoleSystem    = "system"
+	RoleContext   = "context"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is one turn of a conversation with the model. An assistant turn
+// either calls tools or, with none, is the final reply. A tool turn carries
+// the result of the call named by ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Name       string     `json:"name,omitempty"` // the tool, on tool turns
+	// Usage is what the model spent on this reply, when the backend reports
+	// it.
+	Usage Usage `json:"-"`
+}
+
+// ToolCall is a call the model asked for. The shape of Args depends on the
+// tool; see Decode.
+type ToolCall struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+// NewToolCall builds a call from one of the typed argument structs.
+func NewToolCall(name string, args interface{}) *ToolCall {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		// The argument structs only hold strings and numbers.
+		panic(fmt.Sprintf("agentic: cannot marshal %s args: %v", name, err))
+	}
+	return &ToolCall{Name: name, Args: raw}
+}
+
+// ToolResult is what a tool call returns to the model.
+type ToolResult struct {
+	Message      string        `json:"message,omitempty"`
+	Data         interface{}   `json:"data,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Confirmation *Confirmation `json:"confirmation,omitempty"`
+	// PollID and MatchID are what the call touched, remembered by the
+	// session so later commands can refer back to them.
+	PollID  uuid.UUID `json:"-"`
+	MatchID uuid.UUID `json:"-"`
+}
+
+// Step records a tool call made while running a command.
+type Step struct {
+	Tool    string `json:"tool"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Confirmation is an action that changes other people's data, held until
+// the user confirms it with the token.
+type Confirmation struct {
+	Token     string    `json:"token"`
+	Action    string    `json:"action"`
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type SearchRestaurantsArgs struct {
+	Query    string `json:"query" binding:"required"`
+	Location string `json:"location" binding:"required"`                          // "lat,lng" or a place name
+	Radius   int    `json:"radius,omitempty" binding:"omitempty,min=1,max=50000"` // meters
 }
 
-type ParsedPrompt struct {
-	Food     string
-	Location string
-	Radius   string
+// SearchHit is the summary of a restaurant returned to the model.
+type SearchHit struct {
+	PlaceID string  `json:"place_id"`
+	Name    string  `json:"name"`
+	Address string  `json:"address"`
+	Rating  float64 `json:"rating,omitempty"`
+}
+
+type CreatePollArgs struct {
+	Food     string `json:"food" binding:"required"`
+	Location string `json:"location" binding:"required"`               // "lat,lng"
+	Radius   int    `json:"radius" binding:"required,min=1,max=50000"` // meters
+}
+
+type JoinPollArgs struct {
+	InviteCode string `json:"invite_code" binding:"required,len=8,alphanum"`
+}
+
+// AddOptionsArgs names restaurants to search for near Location and add to
+// the poll. Polls are referred to by name.
+type AddOptionsArgs struct {
+	Poll        string   `json:"poll" binding:"required"`
+	Restaurants []string `json:"restaurants" binding:"required,min=1,max=10,dive,required"`
+	Location    string   `json:"location,omitempty"` // "lat,lng", optional
+}
+
+// VoteArgs describes the option to vote for, e.g. "the sushi place".
+type VoteArgs struct {
+	Poll   string `json:"poll" binding:"required"`
+	Option string `json:"option" binding:"required"`
+}
+
+type ClosePollArgs struct {
+	Poll string `json:"poll" binding:"required"`
+}
+
+type StartMatchArgs struct {
+	Friend     string   `json:"friend" binding:"required,email"`
+	Categories []string `json:"categories,omitempty" binding:"omitempty,max=10,dive,required"`
+}
+
+type SummarizeArgs struct {
+	Poll string `json:"poll" binding:"required"`
+}
+
+// SummarizeMatchArgs picks the user's latest match, or the latest with
+// Friend if set.
+type SummarizeMatchArgs struct {
+	Friend string `json:"friend,omitempty" binding:"omitempty,email"`
+}
+
+// RecommendArgs asks for options for a new poll. The group is the members
+// of Poll, or everyone the user polls with when it is empty. With Food set,
+// only matching restaurants are recommended, and a search near Location
+// fills in new ones.
+type RecommendArgs struct {
+	Poll     string `json:"poll,omitempty"`
+	Food     string `json:"food,omitempty"`
+	Location string `json:"location,omitempty"` // "lat,lng", optional
+	Count    int    `json:"count,omitempty" binding:"omitempty,min=1,max=10"`
+}
+
+// Decode returns the call's arguments as the typed struct for its tool. The
+// raw arguments are checked against the tool's declared schema, then the
+// struct against its binding tags, and free text is cleaned. Invalid
+// arguments are reported as a *ParseError.
+func (c *ToolCall) Decode() (interface{}, error) {
+	var args interface{}
+	switch c.Name {
+	case ToolSearchRestaurants:
+		args = &SearchRestaurantsArgs{}
+	case ToolCreatePoll:
+		args = &CreatePollArgs{}
+	case ToolJoinPoll:
+		args = &JoinPollArgs{}
+	case ToolAddOptions:
+		args = &AddOptionsArgs{}
+	case ToolCastVote:
+		args = &VoteArgs{}
+	case ToolClosePoll:
+		args = &ClosePollArgs{}
+	case ToolStartMatch:
+		args = &StartMatchArgs{}
+	case ToolSummarizePoll:
+		args = &SummarizeArgs{}
+	case ToolSummarizeMatch:
+		args = &SummarizeMatchArgs{}
+	case ToolRecommendOptions:
+		args = &RecommendArgs{}
+	default:
+		return nil, &ParseError{Problems: []string{fmt.Sprintf("unknown tool %q", c.Name)}}
+	}
+
+	if len(c.Args) == 0 {
+		return nil, &ParseError{Tool: c.Name, Problems: []string{"arguments are missing"}}
+	}
+	if problems := toolSchemas[c.Name].validateJSON(c.Args); len(problems) > 0 {
+		return nil, &ParseError{Tool: c.Name, Problems: problems}
+	}
+	if err := json.Unmarshal(c.Args, args); err != nil {
+		return nil, &ParseError{Tool: c.Name, Problems: []string{err.Error()}}
+	}
+	if s, ok := args.(sanitizer); ok {
+		if problems := s.sanitize(); len(problems) > 0 {
+			return nil, &ParseError{Tool: c.Name, Problems: problems}
+		}
+	}
+	if err := binding.Validator.ValidateStruct(args); err != nil {
+		return nil, &ParseError{Tool: c.Name, Problems: strings.Split(err.Error(), "\n")}
+	}
+	return args, nil
 }
@@ -0,0 +1,157 @@
+package agentic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+const defaultOpenAITimeout = 30 * time.Second
+
+// OpenAIClient parses commands with any server implementing the OpenAI chat
+// completions API, including local model servers.
+type OpenAIClient struct {
+	BaseURL string
+	Model   string
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewOpenAIClient(cfg *config.Config) *OpenAIClient {
+	timeout := cfg.Agent.OpenAI.Timeout
+	if timeout <= 0 {
+		timeout = defaultOpenAITimeout
+	}
+	return &OpenAIClient{
+		BaseURL: strings.TrimRight(cfg.Agent.OpenAI.BaseURL, "/"),
+		Model:   cfg.Agent.OpenAI.Model,
+		APIKey:  cfg.Agent.OpenAI.APIKey,
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON, encoded as a string
+	} `json:"function"`
+}
+
+// Next sends the conversation with the tools declared as functions.
+func (o *OpenAIClient) Next(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	declared := make([]map[string]interface{}, len(tools))
+	for i, tool := range tools {
+		declared[i] = map[string]interface{}{"type": "function", "function": tool}
+	}
+	request := map[string]interface{}{
+		"model":       o.Model,
+		"messages":    toOpenAIMessages(messages),
+		"temperature": 0,
+	}
+	if len(declared) > 0 {
+		request["tools"] = declared
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("model server error: %s: %s", resp.Status, string(respBody))
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message openAIMessage `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, errors.New("no choices from model server")
+	}
+
+	msg := completion.Choices[0].Message
+	reply := &Message{
+		Role:    RoleAssistant,
+		Content: strings.TrimSpace(msg.Content),
+		Usage:   Usage{PromptTokens: completion.Usage.PromptTokens, CompletionTokens: completion.Usage.CompletionTokens},
+	}
+	for _, call := range msg.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+			ID:   call.ID,
+			Name: call.Function.Name,
+			Args: json.RawMessage(call.Function.Arguments),
+		})
+	}
+	return reply, nil
+}
+
+func toOpenAIMessages(messages []Message) []openAIMessage {
+	out := make([]openAIMessage, 0, len(messages)+1)
+	out = append(out, openAIMessage{Role: "system", Content: systemPrompt})
+	for _, m := range messages {
+		msg := openAIMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		switch m.Role {
+		case RoleContext:
+			msg.Role, msg.Content = RoleUser, guardContext(m.Content)
+		case RoleUser:
+			msg.Content = guardUserText(m.Content)
+		}
+		for _, call := range m.ToolCalls {
+			tc := openAIToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = string(call.Args)
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+func (o *OpenAIClient) Summarize(ctx context.Context, transcript string) (string, error) {
+	return summarizeWith(ctx, o, transcript)
+}
@@ -0,0 +1,33 @@
+package agentic
+
+import "context"
+
+// Progress events, sent as server-sent events by the streaming endpoint.
+const (
+	EventSession       = "session"        // the session the command runs in
+	EventIntent        = "intent"         // a tool call the model asked for
+	EventSearchResults = "search_results" // restaurants found by a search
+	EventPollCreated   = "poll_created"
+	EventOptionAdded   = "option_added"
+	EventToolResult    = "tool_result" // a tool call finished or failed
+	EventConfirmation  = "confirmation"
+	EventDone          = "done"
+	EventError         = "error"
+)
+
+// ProgressFunc receives progress events while a command runs.
+type ProgressFunc func(event string, data interface{})
+
+type progressKey struct{}
+
+// WithProgress returns a context whose commands report progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progress reports an event if the context asks for progress.
+func progress(ctx context.Context, event string, data interface{}) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		fn(event, data)
+	}
+}
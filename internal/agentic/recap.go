@@ -0,0 +1,327 @@
+package agentic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/internal/head2head"
+	"github.com/turanoo/bitebattle/internal/poll"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+var ErrMatchNotFound = errors.New("no head-to-head match found")
+
+// maxNamedVoters caps the voters named in a poll recap before the rest are
+// counted instead.
+const maxNamedVoters = 3
+
+// Veto is a restaurant a player disliked when the others wanted it.
+type Veto struct {
+	Player         string `json:"player"`
+	RestaurantID   string `json:"restaurant_id"`
+	RestaurantName string `json:"restaurant_name"`
+}
+
+// RecapPoll describes the outcome of a closed poll: the winner and its
+// margin, who voted for it and what got no votes. names maps voters to their
+// names; voters without one are counted but not named. Results are expected
+// in descending vote order, as returned by GetResults.
+func RecapPoll(p *poll.Poll, results []poll.PollResult, names map[uuid.UUID]string) string {
+	total := 0
+	for _, r := range results {
+		total += r.VoteCount
+	}
+	if total == 0 {
+		return fmt.Sprintf("%q closed without any votes.", p.Name)
+	}
+
+	var leaders []string
+	for _, r := range results {
+		if r.VoteCount == results[0].VoteCount {
+			leaders = append(leaders, r.OptionName)
+		}
+	}
+	var recap string
+	switch {
+	case len(leaders) > 1:
+		recap = fmt.Sprintf("%q closed in a tie between %s with %s each.", p.Name, joinList(leaders, "and"), votes(results[0].VoteCount))
+	case len(results) == 1:
+		recap = fmt.Sprintf("%s won %q with %s.", results[0].OptionName, p.Name, votes(results[0].VoteCount))
+	default:
+		recap = fmt.Sprintf("%s won %q %d–%d over %s.", results[0].OptionName, p.Name, results[0].VoteCount, results[1].VoteCount, results[1].OptionName)
+	}
+	if len(leaders) == 1 {
+		if voters := voterNames(results[0].VoterIDs, names); voters != "" {
+			recap += fmt.Sprintf(" %s voted for it.", voters)
+		}
+	}
+
+	var unvoted []string
+	for _, r := range results {
+		if r.VoteCount == 0 {
+			unvoted = append(unvoted, r.OptionName)
+		}
+	}
+	if len(unvoted) > 0 {
+		recap += fmt.Sprintf(" Nobody voted for %s.", joinList(unvoted, "or"))
+	}
+	return recap
+}
+
+// SummarizeMatch describes the outcome of a head-to-head match: the top
+// restaurant that reached consensus, or else the best compromise, and who
+// vetoed what.
+func SummarizeMatch(results *head2head.MatchResults, vetoes []Veto) string {
+	if len(results.Restaurants) == 0 {
+		return "Nobody has swiped in the match yet."
+	}
+
+	var matched []string
+	for _, r := range results.Restaurants {
+		if r.Consensus {
+			matched = append(matched, r.RestaurantName)
+		}
+	}
+	var summary string
+	switch {
+	case len(matched) > 0:
+		top := results.Restaurants[0]
+		for _, r := range results.Restaurants {
+			if r.Consensus {
+				top = r
+				break
+			}
+		}
+		summary = fmt.Sprintf("%s won the head-to-head, liked by %d of %d players.", top.RestaurantName, top.Likes, results.Players)
+		if len(matched) > 1 {
+			summary += fmt.Sprintf(" %s also matched.", joinList(matched[1:], "and"))
+		}
+	case results.Compromise != nil:
+		summary = fmt.Sprintf("Nothing was a match; %s came closest, liked by %d of %d players.", results.Compromise.RestaurantName, results.Compromise.Likes, results.Players)
+	default:
+		summary = "Nothing was a match."
+	}
+
+	// Vetoes are grouped by player, in the order they are given.
+	var players []string
+	vetoed := make(map[string][]string)
+	for _, v := range vetoes {
+		if _, ok := vetoed[v.Player]; !ok {
+			players = append(players, v.Player)
+		}
+		vetoed[v.Player] = append(vetoed[v.Player], v.RestaurantName)
+	}
+	for _, player := range players {
+		summary += fmt.Sprintf(" %s vetoed %s.", player, joinList(vetoed[player], "and"))
+	}
+	return summary
+}
+
+// VetoedRestaurants returns the restaurants that missed consensus only
+// because of dislikes: liked by at least as many players as disliked them.
+func VetoedRestaurants(results *head2head.MatchResults) []head2head.RestaurantResult {
+	var vetoed []head2head.RestaurantResult
+	for _, r := range results.Restaurants {
+		if !r.Consensus && r.Dislikes > 0 && r.Likes >= r.Dislikes {
+			vetoed = append(vetoed, r)
+		}
+	}
+	return vetoed
+}
+
+func (s *Service) summarizeMatch(ctx context.Context, userID uuid.UUID, args *SummarizeMatchArgs) (*ToolResult, error) {
+	matchID, err := s.findMatch(ctx, userID, args.Friend)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.H2H.GetResults(matchID, userID)
+	if err != nil {
+		return nil, err
+	}
+	vetoes, err := s.vetoes(ctx, matchID, VetoedRestaurants(results))
+	if err != nil {
+		return nil, err
+	}
+	summary := SummarizeMatch(results, vetoes)
+	return &ToolResult{
+		Message: s.narrate(ctx, summary, matchFacts(summary, results)),
+		MatchID: matchID,
+		Data:    map[string]interface{}{"results": results, "vetoes": vetoes},
+	}, nil
+}
+
+// narrate has the backend word a recap when it can summarize, given the
+// template recap and the facts behind it. The template recap is kept when
+// the backend cannot or fails to.
+func (s *Service) narrate(ctx context.Context, recap, facts string) string {
+	summarizer, ok := s.Model.(Summarizer)
+	if !ok {
+		return recap
+	}
+	text, err := summarizer.Summarize(ctx, facts)
+	if err != nil || strings.TrimSpace(text) == "" {
+		logger.Log.WithError(err).Warn("Failed to word a recap, keeping the template")
+		return recap
+	}
+	return strings.TrimSpace(text)
+}
+
+// pollFacts lists a closed poll's recap and every option's votes and voters.
+func pollFacts(recap string, results []poll.PollResult, voters map[string][]string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recap: %s\nResults:\n", recap)
+	for _, r := range results {
+		fmt.Fprintf(&b, "- %s: %s", r.OptionName, votes(r.VoteCount))
+		if names := voters[r.OptionName]; len(names) > 0 {
+			fmt.Fprintf(&b, " from %s", strings.Join(names, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// matchFacts lists a match's summary and every restaurant's likes.
+func matchFacts(summary string, results *head2head.MatchResults) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recap: %s\nPlayers: %d\nResults:\n", summary, results.Players)
+	for _, r := range results.Restaurants {
+		fmt.Fprintf(&b, "- %s: %d likes, %d dislikes", r.RestaurantName, r.Likes, r.Dislikes)
+		if r.Consensus {
+			b.WriteString(", a match")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// findMatch returns the user's most recently updated match that swiping has
+// started in, with friend in it if friend is set.
+func (s *Service) findMatch(ctx context.Context, userID uuid.UUID, friend string) (uuid.UUID, error) {
+	var matchID uuid.UUID
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT m.id FROM head2head_matches m
+		JOIN head2head_participants me ON me.match_id = m.id AND me.user_id = $1 AND me.status = 'accepted'
+		WHERE m.status IN ('active', 'completed')
+			AND ($2 = '' OR EXISTS (
+				SELECT 1 FROM head2head_participants p JOIN users u ON u.id = p.user_id
+				WHERE p.match_id = m.id AND p.user_id <> $1 AND LOWER(u.email) = LOWER($2)
+			))
+		ORDER BY m.updated_at DESC
+		LIMIT 1
+	`, userID, friend).Scan(&matchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if friend != "" {
+			return uuid.Nil, fmt.Errorf("%w with %s", ErrMatchNotFound, friend)
+		}
+		return uuid.Nil, ErrMatchNotFound
+	}
+	return matchID, err
+}
+
+// vetoes names the players who disliked each of the restaurants.
+func (s *Service) vetoes(ctx context.Context, matchID uuid.UUID, restaurants []head2head.RestaurantResult) ([]Veto, error) {
+	vetoes := []Veto{}
+	if len(restaurants) == 0 {
+		return vetoes, nil
+	}
+	ids := make([]string, len(restaurants))
+	for i, r := range restaurants {
+		ids[i] = r.RestaurantID
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.name, s.restaurant_id, s.restaurant_name
+		FROM head2head_swipes s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.match_id = $1 AND NOT s.liked AND s.restaurant_id = ANY($2)
+		ORDER BY s.created_at
+	`, matchID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var v Veto
+		if err := rows.Scan(&v.Player, &v.RestaurantID, &v.RestaurantName); err != nil {
+			return nil, err
+		}
+		vetoes = append(vetoes, v)
+	}
+	return vetoes, rows.Err()
+}
+
+// userNames looks up the names of users.
+func (s *Service) userNames(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	names := make(map[uuid.UUID]string)
+	if len(ids) == 0 {
+		return names, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, name FROM users WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
+
+// voterNames names up to maxNamedVoters voters and counts the rest.
+func voterNames(ids []uuid.UUID, names map[uuid.UUID]string) string {
+	var named []string
+	others := 0
+	for _, id := range ids {
+		if name := names[id]; name != "" && len(named) < maxNamedVoters {
+			named = append(named, name)
+		} else {
+			others++
+		}
+	}
+	if len(named) == 0 {
+		return ""
+	}
+	switch others {
+	case 0:
+	case 1:
+		named = append(named, "1 other")
+	default:
+		named = append(named, fmt.Sprintf("%d others", others))
+	}
+	return joinList(named, "and")
+}
+
+// joinList joins items as in "a, b and c".
+func joinList(items []string, conjunction string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + conjunction + " " + items[len(items)-1]
+}
+
+func votes(n int) string {
+	if n == 1 {
+		return "1 vote"
+	}
+	return fmt.Sprintf("%d votes", n)
+}
@@ -0,0 +1,405 @@
+package agentic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/internal/account"
+	"github.com/turanoo/bitebattle/internal/poll"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+const (
+	defaultRecommendations = 5
+	maxRecommendations     = 10
+)
+
+// maxWinnerPolls caps how many of the user's closed polls, most recent
+// first, are looked at for past winners.
+const maxWinnerPolls = 20
+
+// minRecommendRating is the lowest average visit rating a restaurant the
+// group has rated can have and still be recommended.
+const minRecommendRating = 3
+
+// dietConflicts are the words in a restaurant's name or types that suggest
+// it is built around what a diet avoids. A word matches the start of a word,
+// so "burger" also matches "burgers".
+var dietConflicts = map[string][]string{
+	account.DietVegetarian:  {"steak", "bbq", "barbecue", "burger", "chicken", "wings", "brisket", "seafood", "fish", "oyster", "crab"},
+	account.DietVegan:       {"steak", "bbq", "barbecue", "burger", "chicken", "wings", "brisket", "seafood", "fish", "oyster", "crab", "cheese", "creamery", "ice cream", "dairy"},
+	account.DietPescatarian: {"steak", "bbq", "barbecue", "burger", "chicken", "wings", "brisket"},
+	account.DietGlutenFree:  {"bakery", "bagel", "pizza", "pasta", "noodle", "ramen", "donut"},
+	account.DietDairyFree:   {"cheese", "creamery", "ice cream", "dairy", "gelato"},
+	account.DietHalal:       {"pork", "bbq", "barbecue", "brewery", "brewpub", "pub", "wine"},
+	account.DietKosher:      {"pork", "bbq", "barbecue", "oyster", "crab", "shellfish"},
+}
+
+// Candidate is a restaurant that could be recommended, with what the group
+// knows about it.
+type Candidate struct {
+	RestaurantID string
+	Name         string
+	Types        []string
+	// Wins is how many of the group's polls the restaurant won.
+	Wins int
+	// Rating is the group's average visit rating, from Ratings ratings
+	// over Visits visits.
+	Rating  float64
+	Ratings int
+	Visits  int
+	// Found marks restaurants from a search rather than the group's
+	// history.
+	Found bool
+}
+
+// Recommendation is a proposed option for a new poll and why it was picked.
+type Recommendation struct {
+	RestaurantID string   `json:"restaurant_id"`
+	Name         string   `json:"name"`
+	Reasons      []string `json:"reasons"`
+}
+
+// Recommendations are the options proposed for a group's next poll. Which
+// diets the group has is not reported, as they are private to each member.
+type Recommendations struct {
+	Options []Recommendation `json:"options"`
+	// Excluded are restaurants left out because they don't suit the diets.
+	// They are not shown, since in a small group they give away whose diet
+	// ruled them out.
+	Excluded []string `json:"-"`
+}
+
+// Recommend picks up to count options from the candidates. Restaurants from
+// the group's history come first, ranked by poll wins and visit ratings;
+// search results fill the rest in the order given. Restaurants the group
+// rated poorly, or that don't suit one of the diets, are left out.
+func Recommend(candidates []Candidate, diets []string, count int) *Recommendations {
+	recs := &Recommendations{Options: []Recommendation{}}
+
+	seen := make(map[string]bool)
+	var history, found []Candidate
+	for _, c := range candidates {
+		if seen[c.RestaurantID] {
+			continue
+		}
+		seen[c.RestaurantID] = true
+		if c.Ratings > 0 && c.Rating < minRecommendRating {
+			continue
+		}
+		if conflictingDiet(c, diets) != "" {
+			recs.Excluded = append(recs.Excluded, c.Name)
+			continue
+		}
+		if c.Found {
+			found = append(found, c)
+		} else {
+			history = append(history, c)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].score() > history[j].score()
+	})
+
+	for _, c := range append(history, found...) {
+		if len(recs.Options) == count {
+			break
+		}
+		recs.Options = append(recs.Options, Recommendation{RestaurantID: c.RestaurantID, Name: c.Name, Reasons: c.reasons()})
+	}
+	return recs
+}
+
+// DescribeRecommendations puts recommendations in a sentence or two.
+func DescribeRecommendations(recs *Recommendations) string {
+	if len(recs.Options) == 0 {
+		return "There's nothing to recommend yet: the group has no past winners or rated visits. Name a kind of food to search for options instead."
+	}
+	picks := make([]string, len(recs.Options))
+	for i, o := range recs.Options {
+		picks[i] = fmt.Sprintf("%s (%s)", o.Name, strings.Join(o.Reasons, ", "))
+	}
+	return fmt.Sprintf("For your next poll, try %s.", joinList(picks, "and"))
+}
+
+// score ranks restaurants from the group's history: each win counts for two
+// stars of rating.
+func (c Candidate) score() float64 {
+	return 2*float64(c.Wins) + c.Rating
+}
+
+func (c Candidate) reasons() []string {
+	var reasons []string
+	switch {
+	case c.Wins == 1:
+		reasons = append(reasons, "won a poll")
+	case c.Wins > 1:
+		reasons = append(reasons, fmt.Sprintf("won %d polls", c.Wins))
+	}
+	switch {
+	case c.Ratings > 0:
+		reasons = append(reasons, fmt.Sprintf("rated %.1f by the group", c.Rating))
+	case c.Visits == 1:
+		reasons = append(reasons, "visited once")
+	case c.Visits > 1:
+		reasons = append(reasons, fmt.Sprintf("visited %d times", c.Visits))
+	}
+	if c.Found {
+		reasons = append(reasons, "new to the group")
+	}
+	return reasons
+}
+
+// conflictingDiet returns the first diet the restaurant doesn't suit, or ""
+// if it suits them all.
+func conflictingDiet(c Candidate, diets []string) string {
+	text := strings.ToLower(c.Name + " " + strings.ReplaceAll(strings.Join(c.Types, " "), "_", " "))
+	words := " " + strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	}), " ")
+	for _, diet := range diets {
+		for _, conflict := range dietConflicts[diet] {
+			if strings.Contains(words, " "+conflict) {
+				return diet
+			}
+		}
+	}
+	return ""
+}
+
+// matchesFood reports whether a restaurant's name or types mention the food.
+func matchesFood(c Candidate, food string) bool {
+	text := strings.ToLower(c.Name + " " + strings.ReplaceAll(strings.Join(c.Types, " "), "_", " "))
+	for _, word := range strings.Fields(strings.ToLower(food)) {
+		if !optionStopwords[word] && strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// recommend proposes options for the group's next poll. The group is the
+// members of the named poll, or everyone the user shares a poll with. For a
+// named poll, only the winners of polls within that group count, so the
+// user's polls with other people stay private.
+func (s *Service) recommend(ctx context.Context, userID uuid.UUID, args *RecommendArgs) (*ToolResult, error) {
+	polls, err := s.Poll.GetPolls(userID)
+	if err != nil {
+		return nil, err
+	}
+	members := []uuid.UUID{userID}
+	var pollID uuid.UUID
+	if args.Poll != "" {
+		p, err := s.findPoll(userID, args.Poll)
+		if err != nil {
+			return nil, err
+		}
+		pollID = p.ID
+		members = appendMembers(members, *p)
+		polls = groupPolls(polls, members)
+	} else {
+		for _, p := range polls {
+			members = appendMembers(members, p)
+		}
+	}
+
+	candidates, err := s.pastWinners(polls)
+	if err != nil {
+		return nil, err
+	}
+	rated, err := s.groupVisits(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+	candidates = mergeCandidates(candidates, rated)
+	if args.Food != "" {
+		var matching []Candidate
+		for _, c := range candidates {
+			if matchesFood(c, args.Food) {
+				matching = append(matching, c)
+			}
+		}
+		location := args.Location
+		if location == "" {
+			location = defaultLocation
+		}
+		places, err := s.Rest.SearchRestaurants(ctx, args.Food, location, strconv.Itoa(defaultRadius))
+		if err != nil {
+			return nil, fmt.Errorf("failed to search restaurants: %w", err)
+		}
+		progress(ctx, EventSearchResults, map[string]interface{}{"query": args.Food, "count": len(places)})
+		for _, p := range places {
+			matching = append(matching, Candidate{RestaurantID: p.PlaceID, Name: p.Name, Types: p.Types, Found: true})
+		}
+		candidates = matching
+	}
+
+	diets, err := s.groupDiets(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+	count := args.Count
+	if count == 0 {
+		count = defaultRecommendations
+	}
+	recs := Recommend(candidates, diets, count)
+	return &ToolResult{Message: DescribeRecommendations(recs), Data: recs, PollID: pollID}, nil
+}
+
+// pastWinners returns the outright winners of the most recently closed
+// polls.
+func (s *Service) pastWinners(polls []poll.Poll) ([]Candidate, error) {
+	var closed []poll.Poll
+	for _, p := range polls {
+		if !p.IsActive {
+			closed = append(closed, p)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].UpdatedAt.After(closed[j].UpdatedAt) })
+	if len(closed) > maxWinnerPolls {
+		closed = closed[:maxWinnerPolls]
+	}
+
+	var winners []Candidate
+	for _, p := range closed {
+		results, err := s.Poll.GetResults(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 || results[0].VoteCount == 0 || (len(results) > 1 && results[1].VoteCount == results[0].VoteCount) {
+			continue
+		}
+		winner := Candidate{RestaurantID: results[0].RestaurantID, Name: results[0].OptionName, Wins: 1}
+		if results[0].Restaurant != nil {
+			winner.Types = results[0].Restaurant.Types
+		}
+		winners = mergeCandidates(winners, []Candidate{winner})
+	}
+	return winners, nil
+}
+
+// groupVisits aggregates the group's visits to each restaurant.
+func (s *Service) groupVisits(ctx context.Context, members []uuid.UUID) ([]Candidate, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT v.restaurant_id, MAX(v.restaurant_name), COALESCE(AVG(v.rating), 0), COUNT(v.rating), COUNT(*),
+			COALESCE(MAX(r.types), '{}')
+		FROM visits v
+		LEFT JOIN restaurants r ON r.place_id = v.restaurant_id
+		WHERE v.user_id = ANY($1::uuid[])
+		GROUP BY v.restaurant_id
+	`, pq.Array(members))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	var visited []Candidate
+	for rows.Next() {
+		var c Candidate
+		if err := rows.Scan(&c.RestaurantID, &c.Name, &c.Rating, &c.Ratings, &c.Visits, pq.Array(&c.Types)); err != nil {
+			return nil, err
+		}
+		visited = append(visited, c)
+	}
+	return visited, rows.Err()
+}
+
+// groupDiets returns every dietary preference in the group, sorted.
+func (s *Service) groupDiets(ctx context.Context, members []uuid.UUID) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT DISTINCT d FROM users, UNNEST(dietary_preferences) AS d
+		WHERE id = ANY($1::uuid[])
+		ORDER BY d
+	`, pq.Array(members))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	var diets []string
+	for rows.Next() {
+		var diet string
+		if err := rows.Scan(&diet); err != nil {
+			return nil, err
+		}
+		diets = append(diets, diet)
+	}
+	return diets, rows.Err()
+}
+
+// mergeCandidates adds more to candidates, combining what is known about
+// restaurants in both.
+func mergeCandidates(candidates, more []Candidate) []Candidate {
+	index := make(map[string]int, len(candidates))
+	for i, c := range candidates {
+		index[c.RestaurantID] = i
+	}
+	for _, m := range more {
+		i, ok := index[m.RestaurantID]
+		if !ok {
+			index[m.RestaurantID] = len(candidates)
+			candidates = append(candidates, m)
+			continue
+		}
+		c := &candidates[i]
+		c.Wins += m.Wins
+		c.Visits += m.Visits
+		if m.Ratings > 0 {
+			c.Rating = (c.Rating*float64(c.Ratings) + m.Rating*float64(m.Ratings)) / float64(c.Ratings+m.Ratings)
+			c.Ratings += m.Ratings
+		}
+		if len(c.Types) == 0 {
+			c.Types = m.Types
+		}
+	}
+	return candidates
+}
+
+// groupPolls returns the polls whose owner and members are all in members.
+func groupPolls(polls []poll.Poll, members []uuid.UUID) []poll.Poll {
+	inGroup := make(map[uuid.UUID]bool, len(members))
+	for _, m := range members {
+		inGroup[m] = true
+	}
+	var shared []poll.Poll
+	for _, p := range polls {
+		within := inGroup[p.CreatedBy]
+		for _, id := range p.Members {
+			within = within && inGroup[id]
+		}
+		if within {
+			shared = append(shared, p)
+		}
+	}
+	return shared
+}
+
+// appendMembers adds the poll's owner and members not already in members.
+func appendMembers(members []uuid.UUID, p poll.Poll) []uuid.UUID {
+	for _, id := range append([]uuid.UUID{p.CreatedBy}, p.Members...) {
+		found := false
+		for _, m := range members {
+			if m == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			members = append(members, id)
+		}
+	}
+	return members
+}
@@ -0,0 +1,270 @@
+package agentic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/turanoo/bitebattle/internal/geocode"
+)
+
+var (
+	// radiusPattern matches "within 5 km", "in a 3 mile radius" and the like.
+	radiusPattern = regexp.MustCompile(`(?i)\s*\b(?:within|in an?|inside(?: of)?)\s+(\d+(?:\.\d+)?)\s*(km|kilometers?|kilometres?|mi|miles?|m|meters?|metres?)\b(?:\s+radius)?`)
+	// placePattern matches the prepositions that introduce a location.
+	placePattern = regexp.MustCompile(`(?i)\b(?:in|near|around|at|by)\s+`)
+	// leadPattern matches the request wrapped around the food.
+	leadPattern = regexp.MustCompile(`(?i)^(?:please\s+)?(?:(?:create|make|start|set up|open)\s+(?:a\s+)?(?:new\s+)?poll\s+(?:for|of|about|on)|find(?:\s+me)?|search\s+for|show\s+me|look\s+for|get(?:\s+me)?)\s+`)
+
+	// The patterns below pick out the other intents. Poll names are
+	// captured without a leading "the"/"my" or a trailing "poll".
+	joinPattern      = regexp.MustCompile(`(?i)^join\b.*?\b([a-z0-9]{8})$`)
+	addPattern       = regexp.MustCompile(`(?i)^add\s+(.+?)\s+to\s+(?:the\s+|my\s+)?(?:poll\s+)?(.+?)(?:\s+poll)?$`)
+	votePattern      = regexp.MustCompile(`(?i)^vote\s+(?:for\s+)?(.+)\s+(?:in|on)\s+(?:the\s+|my\s+)?(?:poll\s+)?(.+?)(?:\s+poll)?$`)
+	closePattern     = regexp.MustCompile(`(?i)^(?:close|end|finish)\s+(?:voting\s+(?:in|on)\s+)?(?:the\s+|my\s+)?(?:poll\s+)?(.+?)(?:\s+poll)?$`)
+	summarizePattern = regexp.MustCompile(`(?i)^(?:summari[sz]e|recap|who\s+won|(?:show\s+(?:me\s+)?)?(?:the\s+)?results\s+(?:of|for))\s+(?:the\s+|my\s+)?(?:poll\s+)?(.+?)(?:\s+poll)?$`)
+	matchPattern     = regexp.MustCompile(`(?i)\b(?:head[- ]to[- ]head|h2h)\b`)
+	emailPattern     = regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`)
+	categoryPattern  = regexp.MustCompile(`(?i)\b(?:for|on)\s+(.+)$`)
+	listSeparator    = regexp.MustCompile(`(?i)\s*(?:,\s*(?:and\s+|or\s+)?|\s+and\s+|\s+or\s+)`)
+
+	// matchRecapPattern asks how the latest match went; it is checked
+	// before matchPattern.
+	matchRecapPattern = regexp.MustCompile(`(?i)^(?:summari[sz]e|recap|how\s+did|who\s+won)\s+(?:the\s+|my\s+|our\s+)?(?:last\s+|latest\s+)?(?:head[- ]to[- ]head|h2h|match)\b`)
+
+	// The patterns below pick apart a request for recommendations, such
+	// as "suggest 3 sushi places near Austin for the Friday lunch group".
+	recommendPattern = regexp.MustCompile(`(?i)^(?:(?:recommend|suggest|propose)\b|what\s+should\s+(?:we|i)\s+eat\b)\s*(.*)$`)
+	newPollPattern   = regexp.MustCompile(`(?i)\s*\bfor\s+(?:a|an|our|my|the)?\s*(?:new|next)\s+poll\b`)
+	groupPattern     = regexp.MustCompile(`(?i)\s*\b(?:for|with)\s+(?:the\s+|my\s+|our\s+)?(.+?)\s+(?:group|crew|team|poll)$`)
+	countPattern     = regexp.MustCompile(`^(\d+)\s+`)
+	fillerPattern    = regexp.MustCompile(`(?i)\b(?:some|a few|new|options?|restaurants?|places?|spots?|ideas?)\b`)
+)
+
+// RuleParser parses commands with regular expressions and an offline
+// geocoder. It needs no model, so it serves local development, tests and as
+// a fallback when no model backend is reachable.
+type RuleParser struct {
+	Geocoder geocode.Geocoder
+}
+
+func NewRuleParser(geocoder geocode.Geocoder) *RuleParser {
+	if geocoder == nil {
+		geocoder = geocode.NewGazetteer()
+	}
+	return &RuleParser{Geocoder: geocoder}
+}
+
+// ParseCommand recognises joining, recommendations, adding options, voting,
+// closing, head-to-head matches and summaries by their leading verb.
+// Anything else is read as a request to create a poll.
+func (r *RuleParser) ParseCommand(ctx context.Context, command string) (*ToolCall, error) {
+	text := strings.Trim(command, " .!?")
+	text = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(text, "please "), "Please "))
+
+	switch {
+	case joinPattern.MatchString(text):
+		m := joinPattern.FindStringSubmatch(text)
+		return NewToolCall(ToolJoinPoll, JoinPollArgs{InviteCode: m[1]}), nil
+	case recommendPattern.MatchString(text):
+		m := recommendPattern.FindStringSubmatch(text)
+		args, err := r.parseRecommend(ctx, m[1])
+		if err != nil {
+			return nil, err
+		}
+		return NewToolCall(ToolRecommendOptions, args), nil
+	case matchRecapPattern.MatchString(text):
+		return NewToolCall(ToolSummarizeMatch, SummarizeMatchArgs{Friend: emailPattern.FindString(text)}), nil
+	case matchPattern.MatchString(text):
+		return NewToolCall(ToolStartMatch, parseMatch(text)), nil
+	case votePattern.MatchString(text):
+		m := votePattern.FindStringSubmatch(text)
+		return NewToolCall(ToolCastVote, VoteArgs{Poll: pollName(m[2]), Option: m[1]}), nil
+	case addPattern.MatchString(text):
+		m := addPattern.FindStringSubmatch(text)
+		// Restaurant names often contain "at" or "by", so only a phrase
+		// that geocodes is taken as the location.
+		names, location, found, err := r.findLocation(ctx, m[1])
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			names = m[1]
+		}
+		return NewToolCall(ToolAddOptions, AddOptionsArgs{
+			Poll:        pollName(m[2]),
+			Restaurants: splitList(names),
+			Location:    location,
+		}), nil
+	case closePattern.MatchString(text):
+		m := closePattern.FindStringSubmatch(text)
+		return NewToolCall(ToolClosePoll, ClosePollArgs{Poll: pollName(m[1])}), nil
+	case summarizePattern.MatchString(text):
+		m := summarizePattern.FindStringSubmatch(text)
+		return NewToolCall(ToolSummarizePoll, SummarizeArgs{Poll: pollName(m[1])}), nil
+	}
+
+	args, err := r.parseCreatePoll(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return NewToolCall(ToolCreatePoll, args), nil
+}
+
+// Next answers like a model that takes a single step: the user's command
+// becomes one tool call, and that tool's result becomes the reply.
+func (r *RuleParser) Next(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	last := messages[len(messages)-1]
+	if last.Role == RoleTool {
+		var result ToolResult
+		if err := json.Unmarshal([]byte(last.Content), &result); err != nil {
+			return nil, err
+		}
+		reply := result.Message
+		if result.Error != "" {
+			reply = "Sorry, that didn't work: " + result.Error
+		}
+		return &Message{Role: RoleAssistant, Content: reply}, nil
+	}
+
+	call, err := r.ParseCommand(ctx, last.Content)
+	if err != nil {
+		return nil, err
+	}
+	call.ID = "call_1"
+	return &Message{Role: RoleAssistant, ToolCalls: []ToolCall{*call}}, nil
+}
+
+// parseCreatePoll splits a command such as "create a poll for ramen near
+// Austin within 5km" into food, location and radius. A location that can't
+// be geocoded is left empty rather than guessed.
+func (r *RuleParser) parseCreatePoll(ctx context.Context, text string) (CreatePollArgs, error) {
+	args := CreatePollArgs{Radius: defaultRadius}
+
+	if m := radiusPattern.FindStringSubmatchIndex(text); m != nil {
+		value, _ := strconv.ParseFloat(text[m[2]:m[3]], 64)
+		args.Radius = int(math.Round(value * unitMeters(text[m[4]:m[5]])))
+		text = text[:m[0]] + text[m[1]:]
+	}
+
+	food, location, err := r.splitLocation(ctx, text)
+	if err != nil {
+		return args, err
+	}
+	args.Location = location
+	args.Food = cleanFood(food)
+	return args, nil
+}
+
+// parseMatch reads the friend's email and, after "for", the categories to
+// swipe on.
+func parseMatch(text string) StartMatchArgs {
+	var args StartMatchArgs
+	loc := emailPattern.FindStringIndex(text)
+	if loc == nil {
+		return args
+	}
+	args.Friend = text[loc[0]:loc[1]]
+	if m := categoryPattern.FindStringSubmatch(text[loc[1]:]); m != nil {
+		args.Categories = splitList(m[1])
+	}
+	return args
+}
+
+// parseRecommend reads the group's poll, a location that geocodes, the
+// number of options and the food from what follows "recommend".
+func (r *RuleParser) parseRecommend(ctx context.Context, text string) (RecommendArgs, error) {
+	var args RecommendArgs
+	text = newPollPattern.ReplaceAllString(text, "")
+	if m := groupPattern.FindStringSubmatchIndex(text); m != nil {
+		args.Poll = pollName(text[m[2]:m[3]])
+		text = text[:m[0]]
+	}
+	before, location, found, err := r.findLocation(ctx, text)
+	if err != nil {
+		return args, err
+	}
+	if found {
+		text, args.Location = before, location
+	}
+	text = strings.TrimSpace(text)
+	if m := countPattern.FindStringSubmatch(text); m != nil {
+		args.Count, _ = strconv.Atoi(m[1])
+		text = text[len(m[0]):]
+	}
+	args.Food = strings.Join(strings.Fields(fillerPattern.ReplaceAllString(text, "")), " ")
+	return args, nil
+}
+
+// splitLocation finds the first "in/near/at ..." phrase that geocodes and
+// returns the text before it along with the coordinates. Without such a
+// phrase the default location is used; with one that doesn't resolve, the
+// location is empty.
+func (r *RuleParser) splitLocation(ctx context.Context, text string) (string, string, error) {
+	before, location, found, err := r.findLocation(ctx, text)
+	if err != nil || found {
+		return before, location, err
+	}
+	if matches := placePattern.FindAllStringIndex(text, -1); len(matches) > 0 {
+		return text[:matches[len(matches)-1][0]], "", nil
+	}
+	return text, defaultLocation, nil
+}
+
+// findLocation returns the text before the first "in/near/at ..." phrase
+// that geocodes, and its coordinates. found is false if there is none.
+func (r *RuleParser) findLocation(ctx context.Context, text string) (before, location string, found bool, err error) {
+	for _, m := range placePattern.FindAllStringIndex(text, -1) {
+		candidate := strings.Trim(text[m[1]:], " .,!?")
+		if candidate == "" {
+			continue
+		}
+		result, err := r.Geocoder.Geocode(ctx, candidate)
+		if errors.Is(err, geocode.ErrNotFound) || errors.Is(err, geocode.ErrInvalidQuery) {
+			continue
+		}
+		if err != nil {
+			return "", "", false, err
+		}
+		return text[:m[0]], result.Location.String(), true, nil
+	}
+	return text, "", false, nil
+}
+
+func unitMeters(unit string) float64 {
+	switch strings.ToLower(unit)[0] {
+	case 'k':
+		return 1000
+	case 'm':
+		if strings.HasPrefix(strings.ToLower(unit), "mi") {
+			return 1609.344
+		}
+	}
+	return 1
+}
+
+// splitList splits "a, b and c" into its items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range listSeparator.Split(strings.TrimSpace(s), -1) {
+		if item = strings.Trim(item, " .,!?"); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func pollName(s string) string {
+	return strings.Trim(s, ` "'“”`)
+}
+
+func cleanFood(s string) string {
+	s = strings.TrimSpace(s)
+	s = leadPattern.ReplaceAllString(s, "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "some "), "a ")
+	return strings.Trim(s, " .,!?")
+}
@@ -0,0 +1,145 @@
+package agentic
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// schema is the subset of JSON schema used to declare tool parameters, and
+// checked against every call the model makes. Properties that aren't
+// declared are rejected, so a model can't smuggle in extra fields.
+type schema struct {
+	Type       string             `json:"type"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *schema            `json:"items"`
+	Enum       []string           `json:"enum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+}
+
+// toolSchemas are the parameter schemas of Tools, by tool name.
+var toolSchemas = compileSchemas(Tools)
+
+func compileSchemas(tools []Tool) map[string]*schema {
+	schemas := make(map[string]*schema, len(tools))
+	for _, tool := range tools {
+		var s schema
+		if err := json.Unmarshal(tool.Parameters, &s); err != nil {
+			panic(fmt.Sprintf("agentic: invalid parameters schema for %s: %v", tool.Name, err))
+		}
+		schemas[tool.Name] = &s
+	}
+	return schemas
+}
+
+// validateJSON checks raw JSON against the schema and describes every
+// problem found, or returns nil.
+func (s *schema) validateJSON(raw json.RawMessage) []string {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return []string{"arguments are not valid JSON"}
+	}
+	return s.validate("arguments", value)
+}
+
+func (s *schema) validate(path string, value interface{}) []string {
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{path + " must be an object"}
+		}
+		var problems []string
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is not a known field", path, name))
+				continue
+			}
+			problems = append(problems, prop.validate(path+"."+name, obj[name])...)
+		}
+		return problems
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{path + " must be an array"}
+		}
+		var problems []string
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s must have at least %d items", path, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			problems = append(problems, fmt.Sprintf("%s must have at most %d items", path, *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+		return problems
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{path + " must be a string"}
+		}
+		length := len([]rune(str))
+		switch {
+		case s.MinLength != nil && length < *s.MinLength:
+			return []string{fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength)}
+		case s.MaxLength != nil && length > *s.MaxLength:
+			return []string{fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength)}
+		case len(s.Enum) > 0 && !contains(s.Enum, str):
+			return []string{fmt.Sprintf("%s must be one of %v", path, s.Enum)}
+		}
+		return nil
+
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a %s", path, s.Type)}
+		}
+		switch {
+		case s.Type == "integer" && n != math.Trunc(n):
+			return []string{path + " must be a whole number"}
+		case s.Minimum != nil && n < *s.Minimum:
+			return []string{fmt.Sprintf("%s must be at least %v", path, *s.Minimum)}
+		case s.Maximum != nil && n > *s.Maximum:
+			return []string{fmt.Sprintf("%s must be at most %v", path, *s.Maximum)}
+		}
+		return nil
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{path + " must be a boolean"}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,70 +2,659 @@ package agentic
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/internal/head2head"
 	"github.com/turanoo/bitebattle/internal/poll"
 	"github.com/turanoo/bitebattle/internal/restaurant"
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/logger"
 )
 
+var ErrInvalidCommand = errors.New("invalid command")
+var ErrPollNotFound = errors.New("no poll matches that name")
+var ErrAmbiguousPoll = errors.New("more than one poll matches that name")
+var ErrOptionNotFound = errors.New("no option in the poll matches")
+var ErrAmbiguousOption = errors.New("more than one option in the poll matches")
+var ErrStepLimit = errors.New("command needed too many steps")
+var ErrNoRestaurants = errors.New("no restaurants found")
+var ErrConfirmationInvalid = errors.New("confirmation is invalid, expired or already used")
+
+// maxPollOptions caps how many search results a created poll starts with.
+const maxPollOptions = 7
+
+// optionStopwords are words in a vote that don't help pick an option, as in
+// "the sushi place".
+var optionStopwords = map[string]bool{
+	"the": true, "a": true, "an": true, "place": true, "spot": true, "one": true,
+	"restaurant": true, "joint": true, "option": true,
+}
+
+// defaultMaxSteps caps the model turns spent on one command unless the
+// config sets agent.max_steps.
+const defaultMaxSteps = 6
+
 type Service struct {
-	Vertex *VertexAIClient
-	Poll   *poll.Service
-	Rest   *restaurant.Service
+	DB       *sql.DB
+	Model    Model
+	Poll     *poll.Service
+	Rest     *restaurant.Service
+	H2H      *head2head.Service
+	MaxSteps int
+	// SessionTokenBudget is roughly how many tokens of session history are
+	// sent with each command before older turns are summarized.
+	SessionTokenBudget int
+	// DailyCommandLimit and DailyTokenLimit are each user's quotas of
+	// commands and model tokens a day.
+	DailyCommandLimit int
+	DailyTokenLimit   int
 }
 
-func NewService(vertex *VertexAIClient, pollSvc poll.Service, restSvc restaurant.Service) *Service {
+func NewService(db *sql.DB, cfg *config.Config, model Model, pollSvc *poll.Service, restSvc *restaurant.Service, h2hSvc *head2head.Service) *Service {
+	maxSteps := cfg.Agent.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxSteps
+	}
+	tokenBudget := cfg.Agent.SessionTokenBudget
+	if tokenBudget <= 0 {
+		tokenBudget = defaultSessionTokenBudget
+	}
+	commandLimit := cfg.Agent.DailyCommandLimit
+	if commandLimit <= 0 {
+		commandLimit = defaultDailyCommandLimit
+	}
+	tokenLimit := cfg.Agent.DailyTokenLimit
+	if tokenLimit <= 0 {
+		tokenLimit = defaultDailyTokenLimit
+	}
 	return &Service{
-		Vertex: vertex,
-		Poll:   &pollSvc,
-		Rest:   &restSvc,
+		DB:                 db,
+		Model:              model,
+		Poll:               pollSvc,
+		Rest:               restSvc,
+		H2H:                h2hSvc,
+		MaxSteps:           maxSteps,
+		SessionTokenBudget: tokenBudget,
+		DailyCommandLimit:  commandLimit,
+		DailyTokenLimit:    tokenLimit,
 	}
 }
 
-func (s *Service) OrchestrateCommand(ctx context.Context, userID uuid.UUID, command string) (interface{}, error) {
-	// Step 1: Parse command for query/location
-	parsedPrompt, err := s.Vertex.SendCommand(ctx, command)
+// OrchestrateCommand runs a command within a session, starting a new one
+// when sessionID is uuid.Nil. The session's history and what it last acted
+// on are given to the model, and the command and reply are added to it.
+// Commands are refused with a *QuotaError once the user is over a daily
+// quota, and every command is audited.
+func (s *Service) OrchestrateCommand(ctx context.Context, userID, sessionID uuid.UUID, command string) (*Result, error) {
+	start := time.Now()
+	id, err := s.reserveCommand(ctx, userID, command, start)
+	if err != nil {
+		s.audit(newRecord(userID, KindCommand, command, start, nil, err))
+		return nil, err
+	}
+	result, err := s.orchestrate(ctx, userID, sessionID, command)
+	record := newRecord(userID, KindCommand, command, start, result, err)
+	record.ID = id
+	s.finishCommand(record)
 	if err != nil {
-		return nil, fmt.Errorf("vertex AI error: %w", err)
+		return nil, err
 	}
+	return result, nil
+}
 
-	food := parsedPrompt.Food
-	location := parsedPrompt.Location
-	if food == "" {
-		return nil, fmt.Errorf("could not extract restaurant query from command")
+func (s *Service) orchestrate(ctx context.Context, userID, sessionID uuid.UUID, command string) (*Result, error) {
+	var session *Session
+	var err error
+	if sessionID == uuid.Nil {
+		session, err = s.startSession(userID)
+	} else {
+		session, err = s.loadSession(userID, sessionID)
 	}
-	if location == "" {
-		return nil, fmt.Errorf("could not extract location from command")
+	if err != nil {
+		return nil, err
 	}
+	progress(ctx, EventSession, map[string]interface{}{"session_id": session.ID})
 
-	places, err := s.Rest.SearchRestaurants(food, location, "5000")
+	result, err := s.Run(ctx, userID, session.Messages(command))
+	result.SessionID = session.ID
+	if err != nil {
+		return result, err
+	}
+
+	// The command has been carried out, so a failure to remember it is
+	// logged rather than reported.
+	if err := s.recordTurn(ctx, session, command, result); err != nil {
+		logger.Log.WithError(err).Errorf("Failed to record turn of agent session %s", session.ID)
+	}
+	return result, nil
+}
+
+// Result is the outcome of a command: the model's reply, the last action
+// carried out and its data, and any action left waiting for confirmation.
+type Result struct {
+	Action       string
+	Message      string
+	Data         interface{}
+	Steps        []Step
+	Confirmation *Confirmation
+	// PollID and MatchID are the last poll and match the command touched.
+	PollID    uuid.UUID
+	MatchID   uuid.UUID
+	SessionID uuid.UUID
+	// Calls are the tool calls the model made, valid or not.
+	Calls []ToolCall
+	Usage Usage
+}
+
+// Run is the agent loop: the model calls tools, their results are fed back,
+// and this repeats until the model replies without calling any or MaxSteps
+// turns are spent. messages ends with the user's command. If the last tool
+// call failed, its error is returned. Arguments that fail validation are fed
+// back once for the model to fix; a second invalid call ends the loop with
+// its *ParseError. On error, the result holds what was done until then.
+func (s *Service) Run(ctx context.Context, userID uuid.UUID, messages []Message) (*Result, error) {
+	result := &Result{}
+	var lastErr error
+	// The model gets one chance to repair arguments that fail validation.
+	repairing := false
+
+	for step := 0; step < s.MaxSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		reply, err := s.Model.Next(ctx, messages, Tools)
+		if err != nil {
+			return result, fmt.Errorf("failed to run model: %w", err)
+		}
+		result.Usage.Add(reply.Usage)
+		result.Calls = append(result.Calls, reply.ToolCalls...)
+		messages = append(messages, *reply)
+
+		if len(reply.ToolCalls) == 0 {
+			if lastErr != nil {
+				return result, lastErr
+			}
+			result.Message = reply.Content
+			if result.Message == "" && len(result.Steps) > 0 {
+				result.Message = result.Steps[len(result.Steps)-1].Message
+			}
+			return result, nil
+		}
+
+		for _, call := range reply.ToolCalls {
+			progress(ctx, EventIntent, map[string]interface{}{"tool": call.Name, "args": call.Args})
+			out, err := s.runTool(ctx, userID, call)
+			if err != nil {
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				lastErr = err
+				out = &ToolResult{Error: err.Error()}
+				var parseErr *ParseError
+				if errors.As(err, &parseErr) {
+					if repairing {
+						return result, parseErr
+					}
+					repairing = true
+					out.Error += ". Fix the arguments and call the tool again."
+				}
+				result.Steps = append(result.Steps, Step{Tool: call.Name, Error: err.Error()})
+			} else {
+				lastErr = nil
+				result.Steps = append(result.Steps, Step{Tool: call.Name, Message: out.Message})
+				if out.Confirmation != nil {
+					result.Confirmation = out.Confirmation
+					progress(ctx, EventConfirmation, out.Confirmation)
+				} else if call.Name != ToolSearchRestaurants || result.Action == "" {
+					result.Action, result.Data = call.Name, out.Data
+				}
+				if out.PollID != uuid.Nil {
+					result.PollID = out.PollID
+				}
+				if out.MatchID != uuid.Nil {
+					result.MatchID = out.MatchID
+				}
+			}
+			progress(ctx, EventToolResult, result.Steps[len(result.Steps)-1])
+
+			content, err := json.Marshal(out)
+			if err != nil {
+				return result, err
+			}
+			messages = append(messages, Message{Role: RoleTool, ToolCallID: call.ID, Name: call.Name, Content: string(content)})
+		}
+	}
+	return result, fmt.Errorf("%w: gave up after %d steps", ErrStepLimit, s.MaxSteps)
+}
+
+// runTool validates a call and runs it, unless it changes other people's
+// data, in which case it is held for confirmation instead.
+func (s *Service) runTool(ctx context.Context, userID uuid.UUID, call ToolCall) (*ToolResult, error) {
+	args, err := call.Decode()
+	if err != nil {
+		return nil, err
+	}
+	message, err := s.confirmationNeeded(userID, args)
+	if err != nil {
+		return nil, err
+	}
+	if message != "" {
+		// Hold the arguments as confirmationNeeded resolved them.
+		if call.Args, err = json.Marshal(args); err != nil {
+			return nil, err
+		}
+		confirmation, err := s.holdForConfirmation(userID, call, message)
+		if err != nil {
+			return nil, err
+		}
+		return &ToolResult{Message: message + " Waiting for confirmation.", Confirmation: confirmation}, nil
+	}
+	return s.execute(ctx, userID, args)
+}
+
+// execute carries out a validated call.
+func (s *Service) execute(ctx context.Context, userID uuid.UUID, decoded interface{}) (*ToolResult, error) {
+	switch args := decoded.(type) {
+	case *SearchRestaurantsArgs:
+		return s.searchRestaurants(ctx, args)
+	case *CreatePollArgs:
+		return s.createPoll(ctx, userID, args)
+	case *JoinPollArgs:
+		return s.joinPoll(userID, args)
+	case *AddOptionsArgs:
+		return s.addOptions(ctx, userID, args)
+	case *VoteArgs:
+		return s.vote(userID, args)
+	case *ClosePollArgs:
+		return s.closePoll(userID, args)
+	case *StartMatchArgs:
+		return s.startMatch(ctx, userID, args)
+	case *SummarizeArgs:
+		return s.summarize(ctx, userID, args)
+	case *SummarizeMatchArgs:
+		return s.summarizeMatch(ctx, userID, args)
+	case *RecommendArgs:
+		return s.recommend(ctx, userID, args)
+	}
+	return nil, fmt.Errorf("%w: unsupported arguments %T", ErrInvalidCommand, decoded)
+}
+
+// maxSearchHits caps the search results returned to the model.
+const maxSearchHits = 10
+
+func (s *Service) searchRestaurants(ctx context.Context, args *SearchRestaurantsArgs) (*ToolResult, error) {
+	radius := args.Radius
+	if radius == 0 {
+		radius = defaultRadius
+	}
+	places, err := s.Rest.SearchRestaurants(ctx, args.Query, args.Location, strconv.Itoa(radius))
 	if err != nil {
 		return nil, fmt.Errorf("failed to search restaurants: %w", err)
 	}
-	maxOptions := 7
-	if len(places) < maxOptions {
-		maxOptions = len(places)
+	if len(places) > maxSearchHits {
+		places = places[:maxSearchHits]
 	}
+	hits := make([]SearchHit, len(places))
+	for i, p := range places {
+		hits[i] = SearchHit{PlaceID: p.PlaceID, Name: p.Name, Address: p.Address, Rating: p.Rating}
+	}
+	progress(ctx, EventSearchResults, map[string]interface{}{"query": args.Query, "count": len(hits)})
+	return &ToolResult{Message: fmt.Sprintf("Found %d restaurants for %q.", len(hits), args.Query), Data: hits}, nil
+}
 
-	title := food + " poll"
-	poll, err := s.Poll.CreatePoll(title, userID)
+func (s *Service) createPoll(ctx context.Context, userID uuid.UUID, args *CreatePollArgs) (*ToolResult, error) {
+	places, err := s.Rest.SearchRestaurants(ctx, args.Food, args.Location, strconv.Itoa(args.Radius))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search restaurants: %w", err)
+	}
+	if len(places) > maxPollOptions {
+		places = places[:maxPollOptions]
+	}
+	progress(ctx, EventSearchResults, map[string]interface{}{"query": args.Food, "count": len(places)})
+	if len(places) == 0 {
+		return nil, fmt.Errorf("%w for %q", ErrNoRestaurants, args.Food)
+	}
+
+	p, err := s.Poll.CreatePoll(args.Food+" poll", userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create poll: %w", err)
 	}
+	progress(ctx, EventPollCreated, map[string]interface{}{"poll_id": p.ID, "name": p.Name})
+
+	// Once the poll exists it is reported even if the command is cancelled
+	// part way, so the caller is not left with a poll it never heard of.
+	addedOptions, failedOptions := []string{}, []string{}
+	var firstErr error
+	cancelled := false
+	for _, place := range places {
+		if ctx.Err() != nil {
+			cancelled = true
+			break
+		}
+		err := s.addPlace(ctx, p.ID, place)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			continue
+		}
+		if err != nil {
+			logger.Log.WithError(err).Warnf("Failed to add %q to poll %s", place.Name, p.ID)
+			failedOptions = append(failedOptions, place.Name)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		addedOptions = append(addedOptions, place.Name)
+	}
+
+	if len(addedOptions) == 0 && !cancelled {
+		if err := s.Poll.DeletePoll(p.ID); err != nil {
+			logger.Log.WithError(err).Errorf("Failed to delete empty poll %s", p.ID)
+		}
+		return nil, fmt.Errorf("failed to add any option to poll %q: %w", p.Name, firstErr)
+	}
+
+	message := fmt.Sprintf("Created poll %q with %d options.", p.Name, len(addedOptions))
+	if cancelled {
+		message = fmt.Sprintf("Created poll %q with %d options before the command was cancelled.", p.Name, len(addedOptions))
+	}
+	if len(failedOptions) > 0 {
+		message += fmt.Sprintf(" Could not add %s.", strings.Join(failedOptions, ", "))
+	}
+	return &ToolResult{
+		Message: message,
+		PollID:  p.ID,
+		Data:    map[string]interface{}{"poll_id": p.ID, "title": p.Name, "options": addedOptions, "failed": failedOptions},
+	}, nil
+}
+
+func (s *Service) joinPoll(userID uuid.UUID, args *JoinPollArgs) (*ToolResult, error) {
+	p, err := s.Poll.JoinPoll(args.InviteCode, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolResult{Message: fmt.Sprintf("Joined poll %q.", p.Name), Data: p, PollID: p.ID}, nil
+}
+
+// addOptions adds the best search match for each named restaurant. Names
+// with no match, or already in the poll, are reported as skipped.
+func (s *Service) addOptions(ctx context.Context, userID uuid.UUID, args *AddOptionsArgs) (*ToolResult, error) {
+	p, err := s.findPoll(userID, args.Poll)
+	if err != nil {
+		return nil, err
+	}
+	location := args.Location
+	if location == "" {
+		location = defaultLocation
+	}
+
+	added, skipped := []string{}, []string{}
+	for _, name := range args.Restaurants {
+		places, err := s.Rest.SearchRestaurants(ctx, name, location, strconv.Itoa(defaultRadius))
+		if err != nil {
+			return nil, fmt.Errorf("failed to search restaurants: %w", err)
+		}
+		progress(ctx, EventSearchResults, map[string]interface{}{"query": name, "count": len(places)})
+		if len(places) == 0 {
+			skipped = append(skipped, name)
+			continue
+		}
+		err = s.addPlace(ctx, p.ID, places[0])
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			skipped = append(skipped, name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, places[0].Name)
+	}
+
+	message := fmt.Sprintf("Added %d options to %q", len(added), p.Name)
+	if len(added) > 0 {
+		message += ": " + strings.Join(added, ", ")
+	}
+	message += "."
+	if len(skipped) > 0 {
+		message += fmt.Sprintf(" Skipped %s, which had no match or were already in the poll.", strings.Join(skipped, ", "))
+	}
+	return &ToolResult{
+		Message: message,
+		Data:    map[string]interface{}{"poll_id": p.ID, "added": added, "skipped": skipped},
+		PollID:  p.ID,
+	}, nil
+}
+
+func (s *Service) addPlace(ctx context.Context, pollID uuid.UUID, place restaurant.Place) error {
+	imageURL := ""
+	if len(place.Photos) > 0 {
+		imageURL = restaurant.PhotoURL(place.Photos[0].PhotoReference)
+	}
+	option, err := s.Poll.AddOption(pollID, place.PlaceID, place.Name, imageURL, "")
+	if err != nil {
+		return err
+	}
+	progress(ctx, EventOptionAdded, option)
+	return nil
+}
+
+func (s *Service) vote(userID uuid.UUID, args *VoteArgs) (*ToolResult, error) {
+	p, err := s.findPoll(userID, args.Poll)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.Poll.GetResults(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	option, err := MatchOption(results, args.Option)
+	if err != nil {
+		return nil, err
+	}
+
+	vote, err := s.Poll.CastVote(p.ID, option.OptionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolResult{Message: fmt.Sprintf("Voted for %s in %q.", option.OptionName, p.Name), Data: vote, PollID: p.ID}, nil
+}
+
+func (s *Service) closePoll(userID uuid.UUID, args *ClosePollArgs) (*ToolResult, error) {
+	p, err := s.findPoll(userID, args.Poll)
+	if err != nil {
+		return nil, err
+	}
+	closed, err := s.Poll.ClosePoll(p.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolResult{Message: fmt.Sprintf("Closed poll %q.", closed.Name), Data: closed, PollID: closed.ID}, nil
+}
+
+func (s *Service) startMatch(ctx context.Context, userID uuid.UUID, args *StartMatchArgs) (*ToolResult, error) {
+	inviteeIDs, err := s.H2H.ResolveInviteeEmails(ctx, []string{args.Friend})
+	if err != nil {
+		return nil, err
+	}
+	categories := args.Categories
+	if len(categories) == 0 {
+		categories = []string{"restaurant"}
+	}
+
+	// The invite link reaches the friend if they have not registered yet;
+	// whether they have is not revealed.
+	match, err := s.H2H.CreateMatch(userID, nil, head2head.MatchOptions{
+		Categories:      categories,
+		SuperLikeBudget: head2head.DefaultSuperLikeBudget,
+		InviteLink:      true,
+		EmailInvitees:   inviteeIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ToolResult{
+		Message: fmt.Sprintf("Started a head-to-head match with %s for %s. If they have not joined BiteBattle yet, share the invite link with them.",
+			args.Friend, strings.Join(categories, ", ")),
+		Data:    match,
+		MatchID: match.ID,
+	}, nil
+}
 
-	var addedOptions []string
-	for i := 0; i < maxOptions; i++ {
-		place := places[i]
-		imageURL := ""
-		if len(place.Photos) > 0 {
-			imageURL = place.Photos[0].PhotoReference
+// summarize reports how an open poll stands, and recaps a closed one with
+// the names of who voted for what.
+func (s *Service) summarize(ctx context.Context, userID uuid.UUID, args *SummarizeArgs) (*ToolResult, error) {
+	p, err := s.findPoll(userID, args.Poll)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.Poll.GetResults(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsActive {
+		return &ToolResult{
+			Message: SummarizeResults(p, results),
+			PollID:  p.ID,
+			Data:    map[string]interface{}{"poll": p, "results": results},
+		}, nil
+	}
+
+	var voterIDs []uuid.UUID
+	for _, r := range results {
+		voterIDs = append(voterIDs, r.VoterIDs...)
+	}
+	names, err := s.userNames(ctx, voterIDs)
+	if err != nil {
+		return nil, err
+	}
+	voters := make(map[string][]string, len(results))
+	for _, r := range results {
+		voters[r.OptionName] = []string{}
+		for _, id := range r.VoterIDs {
+			if name := names[id]; name != "" {
+				voters[r.OptionName] = append(voters[r.OptionName], name)
+			}
+		}
+	}
+	recap := RecapPoll(p, results, names)
+	return &ToolResult{
+		Message: s.narrate(ctx, recap, pollFacts(recap, results, voters)),
+		PollID:  p.ID,
+		Data:    map[string]interface{}{"poll": p, "results": results, "voters": voters},
+	}, nil
+}
+
+// SummarizeResults describes a poll's standing in a sentence or two. Results
+// are expected in descending vote order, as returned by GetResults.
+func SummarizeResults(p *poll.Poll, results []poll.PollResult) string {
+	state := "open"
+	if !p.IsActive {
+		state = "closed"
+	}
+	total := 0
+	for _, r := range results {
+		total += r.VoteCount
+	}
+	summary := fmt.Sprintf("%q is %s with %d votes across %d options.", p.Name, state, total, len(results))
+	if total == 0 {
+		return summary
+	}
+
+	var leaders []string
+	for _, r := range results {
+		if r.VoteCount == results[0].VoteCount {
+			leaders = append(leaders, r.OptionName)
+		}
+	}
+	if len(leaders) == 1 {
+		return summary + fmt.Sprintf(" %s leads with %d.", leaders[0], results[0].VoteCount)
+	}
+	return summary + fmt.Sprintf(" %s are tied with %d each.", strings.Join(leaders, " and "), results[0].VoteCount)
+}
+
+// findPoll resolves a poll the user belongs to by ID, or by name: an exact
+// match, ignoring case, or else the only poll whose name contains it.
+func (s *Service) findPoll(userID uuid.UUID, name string) (*poll.Poll, error) {
+	polls, err := s.Poll.GetPolls(userID)
+	if err != nil {
+		return nil, err
+	}
+	want := strings.ToLower(strings.TrimSpace(name))
+	id, idErr := uuid.Parse(want)
+
+	var partial []poll.Poll
+	for _, p := range polls {
+		if idErr == nil && p.ID == id {
+			return &p, nil
+		}
+		have := strings.ToLower(p.Name)
+		if have == want {
+			return &p, nil
 		}
-		_, err := s.Poll.AddOption(poll.ID, place.PlaceID, place.Name, imageURL, "")
-		if err == nil {
-			addedOptions = append(addedOptions, place.Name)
+		if strings.Contains(have, want) {
+			partial = append(partial, p)
 		}
 	}
+	switch len(partial) {
+	case 0:
+		return nil, fmt.Errorf("%w: %q", ErrPollNotFound, name)
+	case 1:
+		return &partial[0], nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrAmbiguousPoll, name)
+	}
+}
 
-	return map[string]interface{}{"poll_id": poll.ID, "title": poll.Name, "options": addedOptions}, nil
+// MatchOption picks the poll option a description such as "the sushi place"
+// refers to. An exact name wins; otherwise the option whose name and
+// restaurant types share the most words with the description, if only one
+// does.
+func MatchOption(results []poll.PollResult, description string) (*poll.PollResult, error) {
+	want := strings.ToLower(strings.TrimSpace(description))
+	var words []string
+	for _, w := range strings.Fields(want) {
+		if !optionStopwords[w] {
+			words = append(words, w)
+		}
+	}
+
+	best, bestScore, tied := -1, 0, false
+	for i, r := range results {
+		name := strings.ToLower(r.OptionName)
+		if name == want {
+			return &results[i], nil
+		}
+		text := name
+		if r.Restaurant != nil {
+			text += " " + strings.ToLower(strings.Join(r.Restaurant.Types, " "))
+		}
+		score := 0
+		for _, w := range words {
+			if strings.Contains(text, w) {
+				score++
+			}
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = i, score, false
+		case score == bestScore && score > 0:
+			tied = true
+		}
+	}
+	if best < 0 {
+		return nil, fmt.Errorf("%w: %q", ErrOptionNotFound, description)
+	}
+	if tied {
+		return nil, fmt.Errorf("%w: %q", ErrAmbiguousOption, description)
+	}
+	return &results[best], nil
 }
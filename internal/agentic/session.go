@@ -0,0 +1,278 @@
+package agentic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+var ErrSessionNotFound = errors.New("agent session not found or expired")
+
+// SessionTTL is how long a session lives after its last command.
+const SessionTTL = 24 * time.Hour
+
+// defaultSessionTokenBudget is roughly how many tokens of history a session
+// keeps before older turns are summarized, unless the config sets
+// agent.session_token_budget.
+const defaultSessionTokenBudget = 1500
+
+// keptTurns are the most recent turns never folded into the summary, so the
+// model always sees the last exchange or two verbatim.
+const keptTurns = 4
+
+// maxSummaryChars caps a summary built without the model.
+const maxSummaryChars = 2000
+
+// Session is a conversation with the agent. Older turns are folded into
+// Summary; PollID and MatchID are the poll and match last acted on.
+type Session struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Summary   string
+	PollID    uuid.UUID
+	PollName  string
+	MatchID   uuid.UUID
+	Turns     []Turn
+	ExpiresAt time.Time
+}
+
+// Turn is a command or the agent's reply to it. Tool calls made along the
+// way are not kept.
+type Turn struct {
+	ID        uuid.UUID
+	Role      string
+	Content   string
+	CreatedAt time.Time
+}
+
+// Messages is the conversation to send the model for a new command: the
+// session context, the turns so far and the command. The context holds user
+// text, so it is a context message rather than a system one.
+func (s *Session) Messages(command string) []Message {
+	messages := make([]Message, 0, len(s.Turns)+2)
+	if context := s.context(); context != "" {
+		messages = append(messages, Message{Role: RoleContext, Content: context})
+	}
+	for _, turn := range s.Turns {
+		messages = append(messages, Message{Role: turn.Role, Content: turn.Content})
+	}
+	return append(messages, Message{Role: RoleUser, Content: command})
+}
+
+func (s *Session) context() string {
+	var lines []string
+	if summary := cleanText(s.Summary); summary != "" {
+		lines = append(lines, "Summary of the conversation so far: "+summary)
+	}
+	if name := cleanText(s.PollName); name != "" {
+		lines = append(lines, fmt.Sprintf("Current poll: %q", name))
+	}
+	if s.MatchID != uuid.Nil {
+		lines = append(lines, "The user has a head-to-head match in progress: "+s.MatchID.String()+".")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// EstimateTokens approximates the tokens in a summary and turns, at about
+// four characters a token.
+func EstimateTokens(summary string, turns []Turn) int {
+	chars := len(summary)
+	for _, turn := range turns {
+		chars += len(turn.Content)
+	}
+	return chars / 4
+}
+
+// transcript renders turns for summarization.
+func transcript(turns []Turn) string {
+	var b strings.Builder
+	for _, turn := range turns {
+		role := "User"
+		if turn.Role == RoleAssistant {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", role, turn.Content)
+	}
+	return b.String()
+}
+
+// FallbackSummary extends a summary with the commands in turns, for backends
+// that can't summarize. It keeps the most recent text when too long.
+func FallbackSummary(previous string, turns []Turn) string {
+	var commands []string
+	for _, turn := range turns {
+		if turn.Role == RoleUser {
+			commands = append(commands, cleanText(turn.Content))
+		}
+	}
+	summary := previous
+	if len(commands) > 0 {
+		if summary != "" {
+			summary += " "
+		}
+		summary += "The user asked: " + strings.Join(commands, "; ") + "."
+	}
+	if len(summary) > maxSummaryChars {
+		summary = "..." + summary[len(summary)-maxSummaryChars:]
+	}
+	return summary
+}
+
+func (s *Service) startSession(userID uuid.UUID) (*Session, error) {
+	session := &Session{ID: uuid.New(), UserID: userID, ExpiresAt: time.Now().Add(SessionTTL)}
+	_, err := s.DB.Exec(`
+		INSERT INTO agent_sessions (id, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`, session.ID, userID, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// loadSession returns the user's session with its turns. Sessions of other
+// users are reported as not found.
+func (s *Service) loadSession(userID, sessionID uuid.UUID) (*Session, error) {
+	session := &Session{ID: sessionID, UserID: userID}
+	var pollID, matchID uuid.NullUUID
+	var pollName sql.NullString
+	err := s.DB.QueryRow(`
+		SELECT s.summary, s.poll_id, p.name, s.match_id, s.expires_at
+		FROM agent_sessions s
+		LEFT JOIN polls p ON p.id = s.poll_id
+		WHERE s.id = $1 AND s.user_id = $2 AND s.expires_at > $3
+	`, sessionID, userID, time.Now()).Scan(&session.Summary, &pollID, &pollName, &matchID, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.PollID, session.PollName, session.MatchID = pollID.UUID, pollName.String, matchID.UUID
+
+	rows, err := s.DB.Query(`
+		SELECT id, role, content, created_at
+		FROM agent_session_turns
+		WHERE session_id = $1
+		ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var turn Turn
+		if err := rows.Scan(&turn.ID, &turn.Role, &turn.Content, &turn.CreatedAt); err != nil {
+			return nil, err
+		}
+		session.Turns = append(session.Turns, turn)
+	}
+	return session, rows.Err()
+}
+
+// recordTurn stores a command and its reply, remembers what it acted on and
+// extends the session. History over the token budget is then summarized.
+func (s *Service) recordTurn(ctx context.Context, session *Session, command string, result *Result) error {
+	now := time.Now()
+	turns := []Turn{
+		{ID: uuid.New(), Role: RoleUser, Content: command, CreatedAt: now},
+		// A microsecond later, so the reply always sorts after the command.
+		{ID: uuid.New(), Role: RoleAssistant, Content: result.Message, CreatedAt: now.Add(time.Microsecond)},
+	}
+	for _, turn := range turns {
+		_, err := s.DB.Exec(`
+			INSERT INTO agent_session_turns (id, session_id, role, content, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, turn.ID, session.ID, turn.Role, turn.Content, turn.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	session.Turns = append(session.Turns, turns...)
+
+	if result.PollID != uuid.Nil {
+		session.PollID = result.PollID
+	}
+	if result.MatchID != uuid.Nil {
+		session.MatchID = result.MatchID
+	}
+	session.ExpiresAt = now.Add(SessionTTL)
+	_, err := s.DB.Exec(`
+		UPDATE agent_sessions SET poll_id = $2, match_id = $3, expires_at = $4, updated_at = $5
+		WHERE id = $1
+	`, session.ID, nullUUID(session.PollID), nullUUID(session.MatchID), session.ExpiresAt, now)
+	if err != nil {
+		return err
+	}
+
+	if EstimateTokens(session.Summary, session.Turns) > s.SessionTokenBudget && len(session.Turns) > keptTurns {
+		return s.compact(ctx, session)
+	}
+	return nil
+}
+
+// compact folds all but the last few turns into the session summary.
+func (s *Service) compact(ctx context.Context, session *Session) error {
+	older := session.Turns[:len(session.Turns)-keptTurns]
+	summary := s.summarizeHistory(ctx, session.Summary, older)
+
+	ids := make([]string, len(older))
+	for i, turn := range older {
+		ids[i] = turn.ID.String()
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.Exec(`UPDATE agent_sessions SET summary = $2 WHERE id = $1`, session.ID, summary); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM agent_session_turns WHERE id = ANY($1::uuid[])`, pq.Array(ids)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	session.Summary = summary
+	session.Turns = session.Turns[len(older):]
+	return nil
+}
+
+// summarizeHistory asks the model to extend the summary when it can, and falls back
+// to FallbackSummary otherwise.
+func (s *Service) summarizeHistory(ctx context.Context, previous string, turns []Turn) string {
+	summarizer, ok := s.Model.(Summarizer)
+	if !ok {
+		return FallbackSummary(previous, turns)
+	}
+	text := transcript(turns)
+	if previous != "" {
+		text = "Earlier summary: " + previous + "\n" + text
+	}
+	summary, err := summarizer.Summarize(ctx, text)
+	if err != nil || strings.TrimSpace(summary) == "" {
+		logger.Log.WithError(err).Warn("Failed to summarize agent session, keeping a plain summary")
+		return FallbackSummary(previous, turns)
+	}
+	return strings.TrimSpace(summary)
+}
+
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
@@ -12,73 +12,120 @@ import (
 	"time"
 
 	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/logger"
 )
 
-var (
-	cachedToken     string
-	tokenExpiryTime int64
-)
+const defaultVertexTimeout = 30 * time.Second
 
+// VertexAIClient calls Gemini on Vertex AI. Requests are authorized with
+// tokens from Credentials and sent with Client, which tests can point at a
+// stub server.
 type VertexAIClient struct {
-	Url string
+	Url         string
+	Client      *http.Client
+	Credentials Credentials
 }
 
 func NewVertexAIClient(cfg *config.Config) *VertexAIClient {
 	url := fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1beta1/projects/%s/locations/%s/publishers/google/models/%s:generateContent",
-		cfg.Vertex.Location, cfg.Vertex.ProjectID, cfg.Vertex.Location, cfg.Vertex.Model)
+		cfg.Agent.Vertex.Location, cfg.Agent.Vertex.ProjectID, cfg.Agent.Vertex.Location, cfg.Agent.Vertex.Model)
+	timeout := cfg.Agent.Vertex.Timeout
+	if timeout <= 0 {
+		timeout = defaultVertexTimeout
+	}
+	client := &http.Client{Timeout: timeout}
 	return &VertexAIClient{
-		Url: url,
+		Url:         url,
+		Client:      client,
+		Credentials: NewCredentials(cfg, client),
 	}
 }
 
-func (v *VertexAIClient) SendCommand(ctx context.Context, command string) (*ParsedPrompt, error) {
+type vertexPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *vertexFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *vertexFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type vertexFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+type vertexFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type vertexContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []vertexPart `json:"parts"`
+}
+
+// Next sends the conversation to Gemini with the tools declared as
+// functions. Gemini doesn't identify calls, so each is given an ID from its
+// position in the conversation.
+func (v *VertexAIClient) Next(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	// Gemini only takes system messages as part of the system instruction.
+	system := vertexContent{Parts: []vertexPart{{Text: systemPrompt}}}
+	for _, m := range messages {
+		if m.Role == RoleSystem {
+			system.Parts = append(system.Parts, vertexPart{Text: m.Content})
+		}
+	}
 	requestBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"role": "user",
-				"parts": []map[string]string{
-					{"text": buildPrompt(command)},
-				},
-			},
-		},
+		"systemInstruction": system,
+		"contents":          toVertexContents(messages),
+		"generationConfig":  map[string]interface{}{"temperature": 0},
+	}
+	if len(tools) > 0 {
+		requestBody["tools"] = []map[string]interface{}{{"functionDeclarations": tools}}
+	}
+	body, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
 	}
-	body, _ := json.Marshal(requestBody)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", v.Url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := getAccessToken()
+	token, err := v.Credentials.Token(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Authorization", "Bearer "+token.Value)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := v.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		cerr := resp.Body.Close()
-		_ = cerr
+		if err := resp.Body.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close response body")
+		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("vertex AI error: %s", string(respBody))
+		// A revoked or lapsed token is fetched again on the next call.
+		if cache, ok := v.Credentials.(*TokenCache); ok && resp.StatusCode == http.StatusUnauthorized {
+			cache.Invalidate()
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("vertex AI error: %s: %s", resp.Status, string(respBody))
 	}
 
 	var vertexResp struct {
 		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
+			Content vertexContent `json:"content"`
 		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&vertexResp); err != nil {
 		return nil, err
@@ -87,104 +134,64 @@ func (v *VertexAIClient) SendCommand(ctx context.Context, command string) (*Pars
 		return nil, errors.New("no candidates from Vertex AI")
 	}
 
-	jsonText := stripCodeBlock(vertexResp.Candidates[0].Content.Parts[0].Text)
-
-	var intent ParsedPrompt
-	if err := json.Unmarshal([]byte(jsonText), &intent); err != nil {
-		return nil, fmt.Errorf("failed to parse intent: %w", err)
+	reply := &Message{Role: RoleAssistant, Usage: Usage{
+		PromptTokens:     vertexResp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: vertexResp.UsageMetadata.CandidatesTokenCount,
+	}}
+	var text []string
+	for i, part := range vertexResp.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil {
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+				ID:   fmt.Sprintf("call_%d_%d", len(messages), i),
+				Name: part.FunctionCall.Name,
+				Args: part.FunctionCall.Args,
+			})
+		} else if part.Text != "" {
+			text = append(text, part.Text)
+		}
 	}
-	return &intent, nil
+	reply.Content = strings.TrimSpace(strings.Join(text, ""))
+	return reply, nil
 }
 
-func stripCodeBlock(s string) string {
-	s = strings.TrimSpace(s)
-	if strings.HasPrefix(s, "```") {
-		lines := strings.SplitN(s, "\n", 2)
-		if len(lines) == 2 {
-			s = lines[1]
-		}
-		s = strings.TrimPrefix(s, "```")
-		if idx := strings.Index(s, "```"); idx >= 0 {
-			s = s[:idx]
+func toVertexContents(messages []Message) []vertexContent {
+	contents := make([]vertexContent, 0, len(messages))
+	for _, m := range messages {
+		switch m.Role {
+		case RoleSystem:
+			continue
+		case RoleAssistant:
+			content := vertexContent{Role: "model"}
+			if m.Content != "" {
+				content.Parts = append(content.Parts, vertexPart{Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				content.Parts = append(content.Parts, vertexPart{FunctionCall: &vertexFunctionCall{Name: call.Name, Args: call.Args}})
+			}
+			contents = append(contents, content)
+		case RoleTool:
+			part := vertexPart{FunctionResponse: &vertexFunctionResponse{Name: m.Name, Response: json.RawMessage(m.Content)}}
+			// Consecutive tool results answer the same model turn.
+			if last := len(contents) - 1; last >= 0 && contents[last].Role == RoleUser && contents[last].Parts[0].FunctionResponse != nil {
+				contents[last].Parts = append(contents[last].Parts, part)
+				continue
+			}
+			contents = append(contents, vertexContent{Role: RoleUser, Parts: []vertexPart{part}})
+		case RoleContext:
+			contents = append(contents, vertexContent{Role: RoleUser, Parts: []vertexPart{{Text: guardContext(m.Content)}}})
+		default:
+			part := vertexPart{Text: guardUserText(m.Content)}
+			// Session context and the first command share a user turn.
+			if last := len(contents) - 1; last >= 0 && contents[last].Role == RoleUser && contents[last].Parts[0].FunctionResponse == nil {
+				contents[last].Parts = append(contents[last].Parts, part)
+				continue
+			}
+			contents = append(contents, vertexContent{Role: RoleUser, Parts: []vertexPart{part}})
 		}
 	}
-	s = strings.Trim(s, "`")
-	return strings.TrimSpace(s)
-}
-
-func buildPrompt(command string) string {
-	return `You are a strict JSON-generating agent for a food poll app.
-
-Your task is to extract and return only a valid JSON object from a user's command using this exact structure:
-
-{
-  "food": <string, required — type of food or restaurant>,
-  "location": <string, required — must be in "lat,lng" format>,
-  "radius": <string, required — search radius in meters>
+	return contents
 }
 
-Rules:
-- **"food"**: Extract what kind of food or restaurant is mentioned (e.g., pizza, sushi, Indian food).
-- **"location"**: If the command includes a specific coordinate (e.g., 37.7749,-122.4194), extract it as-is.  
-  If it includes a city, town, neighborhood, or zip code (e.g., "in Austin", "near 94107"), convert that to a best estimate of coordinates in "lat,lng" format.
-  If no location is mentioned, default to "40.7128,-74.0060" (New York City).
-- **"radius"**: Extract if mentioned like "within 3000 meters" or "in a 5km radius". Otherwise, default to "10000".
-
-You must return only the JSON output. No explanations, no comments.
-
-Examples:
-Command: create a poll for tacos in San Diego within 5000 meters  
-Output: {"food": "tacos", "location": "32.7157,-117.1611", "radius": "5000"}
-
-Command: create a poll for ramen near Austin  
-Output: {"food": "ramen", "location": "30.2672,-97.7431", "radius": "10000"}
-
-Command: create a poll for Chinese food around 94107  
-Output: {"food": "Chinese food", "location": "37.7691,-122.3933", "radius": "10000"}
-
-Command: create a poll for sushi restaurants at 37.7749,-122.4194 within 5000 meters  
-Output: {"food": "sushi restaurants", "location": "37.7749,-122.4194", "radius": "5000"}
-
-Command: create a poll for vegan food  
-Output: {"food": "vegan food", "location": "40.7128,-74.0060", "radius": "10000"}
-
-Command: ` + command + `
-Output:`
-}
-
-func getAccessToken() (string, error) {
-	// If we have a cached token and it's not expired, return it
-	if cachedToken != "" && tokenExpiryTime > time.Now().Unix()+60 {
-		return cachedToken, nil
-	}
-
-	req, err := http.NewRequest("GET", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Metadata-Flavor", "Google")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		cerr := resp.Body.Close()
-		_ = cerr
-	}()
-
-	var tokenResp struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int    `json:"expires_in"`
-		TokenType   string `json:"token_type"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", err
-	}
-
-	cachedToken = tokenResp.AccessToken
-	tokenExpiryTime = time.Now().Unix() + int64(tokenResp.ExpiresIn)
-
-	return cachedToken, nil
+func (v *VertexAIClient) Summarize(ctx context.Context, transcript string) (string, error) {
+	return summarizeWith(ctx, v, transcript)
 }
@@ -0,0 +1,241 @@
+package favorite
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/internal/auth"
+	"github.com/turanoo/bitebattle/internal/poll"
+	"github.com/turanoo/bitebattle/pkg/logger"
+	"github.com/turanoo/bitebattle/pkg/utils"
+)
+
+type Handler struct {
+	Service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{Service: service}
+}
+
+func (h *Handler) SaveRestaurant(c *gin.Context) {
+	var req SaveRestaurantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	saved, err := h.Service.SaveRestaurant(userID, req.RestaurantID, req.Name, req.ImageURL)
+	if err != nil {
+		writeFavoriteError(c, err, "could not save restaurant")
+		return
+	}
+	c.JSON(http.StatusCreated, saved)
+}
+
+func (h *Handler) GetFavorites(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	favorites, err := h.Service.GetFavorites(userID)
+	if err != nil {
+		writeFavoriteError(c, err, "could not fetch favorites")
+		return
+	}
+	c.JSON(http.StatusOK, favorites)
+}
+
+func (h *Handler) RemoveFavorite(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveFavorite(userID, c.Param("restaurantId")); err != nil {
+		writeFavoriteError(c, err, "could not remove favorite")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) CreateList(c *gin.Context) {
+	var req ListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.Service.CreateList(userID, req.Name)
+	if err != nil {
+		writeFavoriteError(c, err, "could not create list")
+		return
+	}
+	c.JSON(http.StatusCreated, list)
+}
+
+func (h *Handler) GetLists(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	lists, err := h.Service.GetLists(userID)
+	if err != nil {
+		writeFavoriteError(c, err, "could not fetch lists")
+		return
+	}
+	c.JSON(http.StatusOK, lists)
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	userID, listID, ok := listParams(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.Service.GetList(userID, listID)
+	if err != nil {
+		writeFavoriteError(c, err, "could not fetch list")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) RenameList(c *gin.Context) {
+	var req ListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+	userID, listID, ok := listParams(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.Service.RenameList(userID, listID, req.Name)
+	if err != nil {
+		writeFavoriteError(c, err, "could not rename list")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) DeleteList(c *gin.Context) {
+	userID, listID, ok := listParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DeleteList(userID, listID); err != nil {
+		writeFavoriteError(c, err, "could not delete list")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) AddToList(c *gin.Context) {
+	var req SaveRestaurantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+	userID, listID, ok := listParams(c)
+	if !ok {
+		return
+	}
+
+	added, err := h.Service.AddToList(userID, listID, req.RestaurantID, req.Name, req.ImageURL)
+	if err != nil {
+		writeFavoriteError(c, err, "could not add restaurant to list")
+		return
+	}
+	c.JSON(http.StatusCreated, added)
+}
+
+func (h *Handler) RemoveFromList(c *gin.Context) {
+	userID, listID, ok := listParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveFromList(userID, listID, c.Param("restaurantId")); err != nil {
+		writeFavoriteError(c, err, "could not remove restaurant from list")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AddListToPoll adds every restaurant in a list as options of a poll.
+func (h *Handler) AddListToPoll(c *gin.Context) {
+	var req AddListToPollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+	userID, listID, ok := listParams(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.Service.AddListToPoll(userID, listID, uuid.MustParse(req.PollID))
+	if err != nil {
+		writeFavoriteError(c, err, "could not add list to poll")
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func userIDFromContext(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		logger.FromContext(c).WithError(err).Warn("Invalid user id in favorites request")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func listParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	listID, err := uuid.Parse(c.Param("listId"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid list ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, listID, true
+}
+
+func writeFavoriteError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrFavoriteNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Restaurant is not saved.")
+	case errors.Is(err, ErrListNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "List not found.")
+	case errors.Is(err, ErrPollNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Poll not found.")
+	case errors.Is(err, ErrListNameTaken):
+		utils.ErrorResponse(c, http.StatusConflict, "You already have a list with this name.")
+	case errors.Is(err, ErrListFull):
+		utils.ErrorResponse(c, http.StatusConflict, "List is full.")
+	case errors.Is(err, poll.ErrPollClosed):
+		utils.ErrorResponse(c, http.StatusConflict, "Poll is closed.")
+	default:
+		logger.FromContext(c).WithError(err).Error(fallback)
+		utils.ErrorResponse(c, http.StatusInternalServerError, fallback)
+	}
+}
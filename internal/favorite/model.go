@@ -0,0 +1,52 @@
+package favorite
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/internal/poll"
+)
+
+// MaxListItems caps how many restaurants a list holds, keeping "add my list
+// to this poll" to a sensible number of options.
+const MaxListItems = 50
+
+type SaveRestaurantRequest struct {
+	RestaurantID string `json:"restaurant_id" binding:"required,max=255"`
+	Name         string `json:"name" binding:"required,max=200"`
+	ImageURL     string `json:"image_url" binding:"max=2048"`
+}
+
+type ListRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
+
+type AddListToPollRequest struct {
+	PollID string `json:"poll_id" binding:"required,uuid"`
+}
+
+// Restaurant is a restaurant saved by a user, either as a favorite or in a
+// list.
+type Restaurant struct {
+	RestaurantID string    `json:"restaurant_id"`
+	Name         string    `json:"name"`
+	ImageURL     string    `json:"image_url,omitempty"`
+	SavedAt      time.Time `json:"saved_at"`
+}
+
+type List struct {
+	ID          uuid.UUID    `json:"id"`
+	Name        string       `json:"name"`
+	ItemCount   int          `json:"item_count"`
+	Restaurants []Restaurant `json:"restaurants,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// AddToPollResult reports which list restaurants became poll options.
+// Restaurants already in the poll are skipped.
+type AddToPollResult struct {
+	PollID  uuid.UUID         `json:"poll_id"`
+	Added   []poll.PollOption `json:"added"`
+	Skipped []string          `json:"skipped"` // restaurant IDs
+}
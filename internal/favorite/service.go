@@ -0,0 +1,271 @@
+package favorite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/internal/poll"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+var ErrFavoriteNotFound = errors.New("restaurant is not saved")
+var ErrListNotFound = errors.New("list not found")
+var ErrListNameTaken = errors.New("a list with this name already exists")
+var ErrListFull = errors.New("list is full")
+var ErrPollNotFound = errors.New("poll not found")
+
+type Service struct {
+	DB   *sql.DB
+	Poll *poll.Service
+}
+
+func NewService(db *sql.DB, pollService *poll.Service) *Service {
+	return &Service{DB: db, Poll: pollService}
+}
+
+// SaveRestaurant adds a restaurant to the user's favorites, refreshing its
+// name and image if it was already saved.
+func (s *Service) SaveRestaurant(userID uuid.UUID, restaurantID, name, imageURL string) (*Restaurant, error) {
+	r := Restaurant{RestaurantID: restaurantID, Name: name, ImageURL: imageURL}
+	err := s.DB.QueryRow(`
+		INSERT INTO favorite_restaurants (user_id, restaurant_id, name, image_url, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, restaurant_id) DO UPDATE SET name = EXCLUDED.name, image_url = EXCLUDED.image_url
+		RETURNING created_at
+	`, userID, restaurantID, name, imageURL, time.Now()).Scan(&r.SavedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Service) GetFavorites(userID uuid.UUID) ([]Restaurant, error) {
+	rows, err := s.DB.Query(`
+		SELECT restaurant_id, name, image_url, created_at
+		FROM favorite_restaurants
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanRestaurants(rows)
+}
+
+func (s *Service) RemoveFavorite(userID uuid.UUID, restaurantID string) error {
+	res, err := s.DB.Exec(`
+		DELETE FROM favorite_restaurants WHERE user_id = $1 AND restaurant_id = $2
+	`, userID, restaurantID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrFavoriteNotFound
+	}
+	return nil
+}
+
+func (s *Service) CreateList(userID uuid.UUID, name string) (*List, error) {
+	now := time.Now()
+	list := List{ID: uuid.New(), Name: name, CreatedAt: now, UpdatedAt: now}
+	_, err := s.DB.Exec(`
+		INSERT INTO favorite_lists (id, user_id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, list.ID, userID, name, now, now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrListNameTaken
+		}
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (s *Service) GetLists(userID uuid.UUID) ([]List, error) {
+	rows, err := s.DB.Query(`
+		SELECT l.id, l.name, COUNT(i.restaurant_id), l.created_at, l.updated_at
+		FROM favorite_lists l
+		LEFT JOIN favorite_list_items i ON i.list_id = l.id
+		WHERE l.user_id = $1
+		GROUP BY l.id
+		ORDER BY l.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	lists := []List{}
+	for rows.Next() {
+		var l List
+		if err := rows.Scan(&l.ID, &l.Name, &l.ItemCount, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// GetList returns one of the user's lists with its restaurants.
+func (s *Service) GetList(userID, listID uuid.UUID) (*List, error) {
+	var l List
+	err := s.DB.QueryRow(`
+		SELECT id, name, created_at, updated_at
+		FROM favorite_lists
+		WHERE id = $1 AND user_id = $2
+	`, listID, userID).Scan(&l.ID, &l.Name, &l.CreatedAt, &l.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrListNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT restaurant_id, name, image_url, added_at
+		FROM favorite_list_items
+		WHERE list_id = $1
+		ORDER BY added_at
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	if l.Restaurants, err = scanRestaurants(rows); err != nil {
+		return nil, err
+	}
+	l.ItemCount = len(l.Restaurants)
+	return &l, nil
+}
+
+func (s *Service) RenameList(userID, listID uuid.UUID, name string) (*List, error) {
+	res, err := s.DB.Exec(`
+		UPDATE favorite_lists SET name = $1, updated_at = $2 WHERE id = $3 AND user_id = $4
+	`, name, time.Now(), listID, userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrListNameTaken
+		}
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrListNotFound
+	}
+	return s.GetList(userID, listID)
+}
+
+func (s *Service) DeleteList(userID, listID uuid.UUID) error {
+	res, err := s.DB.Exec(`DELETE FROM favorite_lists WHERE id = $1 AND user_id = $2`, listID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrListNotFound
+	}
+	return nil
+}
+
+// AddToList adds a restaurant to one of the user's lists. Adding a restaurant
+// that is already listed refreshes its name and image.
+func (s *Service) AddToList(userID, listID uuid.UUID, restaurantID, name, imageURL string) (*Restaurant, error) {
+	var count int
+	err := s.DB.QueryRow(`
+		SELECT COUNT(i.restaurant_id)
+		FROM favorite_lists l
+		LEFT JOIN favorite_list_items i ON i.list_id = l.id AND i.restaurant_id <> $3
+		WHERE l.id = $1 AND l.user_id = $2
+		GROUP BY l.id
+	`, listID, userID, restaurantID).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrListNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxListItems {
+		return nil, ErrListFull
+	}
+
+	r := Restaurant{RestaurantID: restaurantID, Name: name, ImageURL: imageURL}
+	now := time.Now()
+	err = s.DB.QueryRow(`
+		INSERT INTO favorite_list_items (list_id, restaurant_id, name, image_url, added_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (list_id, restaurant_id) DO UPDATE SET name = EXCLUDED.name, image_url = EXCLUDED.image_url
+		RETURNING added_at
+	`, listID, restaurantID, name, imageURL, now).Scan(&r.SavedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.DB.Exec(`UPDATE favorite_lists SET updated_at = $1 WHERE id = $2`, now, listID); err != nil {
+		logger.Log.WithError(err).Warn("failed to touch favorite list")
+	}
+	return &r, nil
+}
+
+func (s *Service) RemoveFromList(userID, listID uuid.UUID, restaurantID string) error {
+	res, err := s.DB.Exec(`
+		DELETE FROM favorite_list_items i
+		USING favorite_lists l
+		WHERE i.list_id = l.id AND l.id = $1 AND l.user_id = $2 AND i.restaurant_id = $3
+	`, listID, userID, restaurantID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrFavoriteNotFound
+	}
+	return nil
+}
+
+// AddListToPoll adds every restaurant in the list as an option of a poll the
+// user owns or has joined. Restaurants already in the poll are skipped.
+func (s *Service) AddListToPoll(userID, listID, pollID uuid.UUID) (*AddToPollResult, error) {
+	list, err := s.GetList(userID, listID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Poll.GetPoll(pollID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPollNotFound
+		}
+		return nil, err
+	}
+
+	result := &AddToPollResult{PollID: pollID, Added: []poll.PollOption{}, Skipped: []string{}}
+	for _, r := range list.Restaurants {
+		option, err := s.Poll.AddOption(pollID, r.RestaurantID, r.Name, r.ImageURL, "")
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				result.Skipped = append(result.Skipped, r.RestaurantID)
+				continue
+			}
+			return nil, err
+		}
+		result.Added = append(result.Added, *option)
+	}
+	return result, nil
+}
+
+func scanRestaurants(rows *sql.Rows) ([]Restaurant, error) {
+	defer closeRows(rows)
+
+	restaurants := []Restaurant{}
+	for rows.Next() {
+		var r Restaurant
+		if err := rows.Scan(&r.RestaurantID, &r.Name, &r.ImageURL, &r.SavedAt); err != nil {
+			return nil, err
+		}
+		restaurants = append(restaurants, r)
+	}
+	return restaurants, rows.Err()
+}
+
+func closeRows(rows *sql.Rows) {
+	if err := rows.Close(); err != nil {
+		logger.Log.WithError(err).Error("failed to close rows")
+	}
+}
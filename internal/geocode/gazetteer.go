@@ -0,0 +1,248 @@
+package geocode
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+//go:embed data/cities.csv
+var citiesCSV []byte
+
+//go:embed data/zips.csv
+var zipsCSV []byte
+
+var zipPattern = regexp.MustCompile(`\b(\d{5})(?:-\d{4})?\b`)
+
+// regionAliases maps full region names to the codes used in the dataset.
+var regionAliases = map[string]string{
+	"arizona": "az", "california": "ca", "colorado": "co", "district of columbia": "dc",
+	"florida": "fl", "georgia": "ga", "hawaii": "hi", "illinois": "il", "indiana": "in",
+	"kentucky": "ky", "louisiana": "la", "maine": "me", "maryland": "md", "massachusetts": "ma",
+	"michigan": "mi", "minnesota": "mn", "missouri": "mo", "nebraska": "ne", "nevada": "nv",
+	"new mexico": "nm", "new york": "ny", "north carolina": "nc", "ohio": "oh", "oklahoma": "ok",
+	"oregon": "or", "pennsylvania": "pa", "tennessee": "tn", "texas": "tx", "utah": "ut",
+	"washington": "wa", "wisconsin": "wi",
+	"ontario": "on", "quebec": "qc", "british columbia": "bc",
+	"new south wales": "nsw", "victoria": "vic",
+}
+
+// countryAliases maps country names to ISO codes.
+var countryAliases = map[string]string{
+	"usa": "us", "united states": "us", "united states of america": "us", "america": "us",
+	"uk": "gb", "united kingdom": "gb", "great britain": "gb",
+	"canada": "ca", "australia": "au", "france": "fr", "germany": "de", "japan": "jp",
+	"mexico": "mx", "ireland": "ie", "netherlands": "nl", "singapore": "sg",
+}
+
+// Gazetteer geocodes against a bundled dataset of cities and US zip codes,
+// so it works offline. Ambiguous names resolve to the most populous match
+// unless a region or country narrows them down ("Portland, ME").
+type Gazetteer struct {
+	once   sync.Once
+	cities map[string][]city // keyed by normalized name
+	zips   map[string]zip
+	err    error
+}
+
+type city struct {
+	Name       string
+	Region     string
+	Country    string
+	Location   geo.Point
+	Population int
+}
+
+type zip struct {
+	Code     string
+	City     string
+	Region   string
+	Location geo.Point
+}
+
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{}
+}
+
+func (g *Gazetteer) Geocode(ctx context.Context, text string) (*Result, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || len(text) > MaxQueryLength || strings.IndexFunc(text, unicode.IsControl) >= 0 {
+		return nil, ErrInvalidQuery
+	}
+	if point, err := geo.ParseLatLng(text); err == nil {
+		return &Result{Location: point, Name: point.String(), Kind: KindCoordinates}, nil
+	}
+	if err := g.load(); err != nil {
+		return nil, err
+	}
+
+	if m := zipPattern.FindStringSubmatch(text); m != nil {
+		if z, ok := g.zips[m[1]]; ok {
+			return &Result{Location: z.Location, Name: fmt.Sprintf("%s %s, %s", z.City, z.Region, z.Code), Kind: KindZip}, nil
+		}
+	}
+
+	parts := []string{}
+	for _, part := range strings.Split(text, ",") {
+		if part = normalize(zipPattern.ReplaceAllString(part, "")); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	// Try each comma-separated part as the city, last first so street names
+	// don't win over the city, qualified by the parts after it. Earlier parts
+	// are treated as a street address.
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := parts[i]
+		if i > 0 && isQualifier(part) {
+			continue
+		}
+		words := strings.Fields(part)
+		// "austin tx" has no comma, so trailing words may be the qualifier.
+		for n := len(words); n >= 1; n-- {
+			candidates := g.cities[strings.Join(words[:n], " ")]
+			if len(candidates) == 0 {
+				continue
+			}
+			qualifiers := parts[i+1:]
+			if n < len(words) {
+				qualifiers = append([]string{strings.Join(words[n:], " ")}, qualifiers...)
+			}
+			c := pick(candidates, qualifiers)
+			kind := KindCity
+			if i > 0 {
+				kind = KindAddress
+			}
+			return &Result{Location: c.Location, Name: c.displayName(), Kind: kind}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// pick returns the candidate matching the most qualifiers, then the most
+// populous one.
+func pick(candidates []city, qualifiers []string) city {
+	best, bestScore := candidates[0], -1
+	for _, c := range candidates {
+		score := 0
+		for _, q := range qualifiers {
+			if c.matches(q) {
+				score++
+			}
+		}
+		if score > bestScore || (score == bestScore && c.Population > best.Population) {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// isQualifier reports whether s names a region or country, like "washington"
+// in "Seattle, Washington".
+func isQualifier(s string) bool {
+	_, region := regionAliases[s]
+	_, country := countryAliases[s]
+	return region || country
+}
+
+func (c city) matches(qualifier string) bool {
+	region, country := strings.ToLower(c.Region), strings.ToLower(c.Country)
+	if alias, ok := regionAliases[qualifier]; ok && alias == region {
+		return true
+	}
+	if alias, ok := countryAliases[qualifier]; ok && alias == country {
+		return true
+	}
+	return qualifier == region || qualifier == country
+}
+
+func (c city) displayName() string {
+	if c.Region == "" {
+		return c.Name + ", " + c.Country
+	}
+	return c.Name + ", " + c.Region + ", " + c.Country
+}
+
+// normalize lowercases s, drops punctuation and collapses whitespace.
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '.' || r == '\'' {
+			return -1
+		}
+		if unicode.IsPunct(r) {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (g *Gazetteer) load() error {
+	g.once.Do(func() {
+		g.cities = make(map[string][]city)
+		g.zips = make(map[string]zip)
+
+		g.err = readCSV(citiesCSV, 6, func(rec []string) error {
+			loc, err := parsePoint(rec[3], rec[4])
+			if err != nil {
+				return err
+			}
+			population, err := strconv.Atoi(rec[5])
+			if err != nil {
+				return fmt.Errorf("city %q: invalid population", rec[0])
+			}
+			c := city{Name: rec[0], Region: rec[1], Country: rec[2], Location: loc, Population: population}
+			key := normalize(c.Name)
+			g.cities[key] = append(g.cities[key], c)
+			return nil
+		})
+		if g.err != nil {
+			return
+		}
+
+		g.err = readCSV(zipsCSV, 5, func(rec []string) error {
+			loc, err := parsePoint(rec[3], rec[4])
+			if err != nil {
+				return err
+			}
+			g.zips[rec[0]] = zip{Code: rec[0], City: rec[1], Region: rec[2], Location: loc}
+			return nil
+		})
+	})
+	return g.err
+}
+
+// readCSV calls fn for every row after the header.
+func readCSV(data []byte, fields int, fn func([]string) error) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = fields
+	if _, err := r.Read(); err != nil {
+		return fmt.Errorf("failed to read gazetteer header: %w", err)
+	}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read gazetteer: %w", err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func parsePoint(lat, lng string) (geo.Point, error) {
+	return geo.ParseLatLng(lat + "," + lng)
+}
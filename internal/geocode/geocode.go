@@ -0,0 +1,34 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+const (
+	KindCoordinates = "coordinates"
+	KindZip         = "zip"
+	KindCity        = "city"
+	KindAddress     = "address"
+)
+
+// MaxQueryLength bounds free-text locations.
+const MaxQueryLength = 200
+
+var ErrInvalidQuery = errors.New("invalid location")
+var ErrNotFound = errors.New("location not found")
+
+// Result is a resolved location.
+type Result struct {
+	Location geo.Point `json:"location"`
+	Name     string    `json:"name"` // e.g. "Austin, TX, US"
+	Kind     string    `json:"kind"` // coordinates, zip, city or address
+}
+
+// Geocoder turns free text such as "Austin", "94107" or a street address into
+// coordinates.
+type Geocoder interface {
+	Geocode(ctx context.Context, text string) (*Result, error)
+}
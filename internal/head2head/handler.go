@@ -1,6 +1,8 @@
 package head2head
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -33,15 +35,57 @@ func (h *Handler) CreateMatch(c *gin.Context) {
 		return
 	}
 
-	inviteeID, err := uuid.Parse(req.InviteeID)
-	if err != nil {
-		log.WithError(err).Warn("Invalid invitee ID in CreateMatch")
-		utils.ErrorResponse(c, http.StatusBadRequest, "invalid invitee ID")
-		return
+	if req.InviteeID != "" {
+		req.InviteeIDs = append(req.InviteeIDs, req.InviteeID)
+	}
+	inviteeIDs := make([]uuid.UUID, 0, len(req.InviteeIDs))
+	for _, raw := range req.InviteeIDs {
+		inviteeID, err := uuid.Parse(raw)
+		if err != nil {
+			log.WithError(err).Warn("Invalid invitee ID in CreateMatch")
+			utils.ErrorResponse(c, http.StatusBadRequest, "invalid invitee ID")
+			return
+		}
+		inviteeIDs = append(inviteeIDs, inviteeID)
+	}
+
+	// Emails always come with an invite link, whether or not they belong to
+	// registered users, and registered ones stay hidden until they join, so
+	// the response does not tell the two apart. For the same reason every
+	// email counts towards the player cap.
+	var emailIDs []uuid.UUID
+	if len(req.InviteeEmails) > 0 {
+		if len(inviteeIDs)+len(req.InviteeEmails)+1 > MaxPlayers {
+			utils.ErrorResponse(c, http.StatusBadRequest, ErrTooManyPlayers.Error())
+			return
+		}
+		req.InviteLink = true
+		emailIDs, err = h.Service.ResolveInviteeEmails(c.Request.Context(), req.InviteeEmails)
+		if err != nil {
+			log.WithError(err).Error("Failed to resolve invitee emails")
+			utils.ErrorResponse(c, http.StatusInternalServerError, "could not create match")
+			return
+		}
 	}
 
-	match, err := h.Service.CreateMatch(userID, inviteeID, req.Categories)
+	superLikeBudget := DefaultSuperLikeBudget
+	if req.SuperLikeBudget != nil {
+		superLikeBudget = *req.SuperLikeBudget
+	}
+
+	match, err := h.Service.CreateMatch(userID, inviteeIDs, MatchOptions{
+		Categories:      req.Categories,
+		Consensus:       req.Consensus,
+		ConsensusK:      req.ConsensusK,
+		SuperLikeBudget: superLikeBudget,
+		InviteLink:      req.InviteLink,
+		EmailInvitees:   emailIDs,
+	})
 	if err != nil {
+		if errors.Is(err, ErrNoInvitees) || errors.Is(err, ErrTooManyPlayers) || errors.Is(err, ErrInvalidConsensus) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		log.WithError(err).Error("Could not create match")
 		utils.ErrorResponse(c, http.StatusInternalServerError, "could not create match")
 		return
@@ -51,6 +95,151 @@ func (h *Handler) CreateMatch(c *gin.Context) {
 	c.JSON(http.StatusCreated, match)
 }
 
+func (h *Handler) GetMatch(c *gin.Context) {
+	log := logger.FromContext(c)
+	matchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid match ID")
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in GetMatch")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	match, err := h.Service.GetMatch(matchID, userID)
+	if err != nil {
+		writeMatchError(c, err, "failed to fetch match")
+		return
+	}
+
+	c.JSON(http.StatusOK, match)
+}
+
+func (h *Handler) Rematch(c *gin.Context) {
+	log := logger.FromContext(c)
+	var req RematchRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+			return
+		}
+	}
+
+	matchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid match ID")
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in Rematch")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	match, err := h.Service.Rematch(matchID, userID, req.Categories)
+	if err != nil {
+		if errors.Is(err, ErrNoInvitees) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "No other players to rematch.")
+			return
+		}
+		writeMatchError(c, err, "could not create rematch")
+		return
+	}
+
+	log.Infof("Head2Head rematch created: %s from %s by %s", match.ID, matchID, userID)
+	c.JSON(http.StatusCreated, match)
+}
+
+func (h *Handler) GetPairStats(c *gin.Context) {
+	log := logger.FromContext(c)
+	opponentID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in GetPairStats")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	stats, err := h.Service.GetPairStats(userID, opponentID)
+	if errors.Is(err, ErrSelfStats) {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.WithError(err).Errorf("Failed to fetch head2head stats for %s and %s", userID, opponentID)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *Handler) CreateInvite(c *gin.Context) {
+	log := logger.FromContext(c)
+	matchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid match ID")
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in CreateInvite")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	invite, err := h.Service.CreateInvite(matchID, userID)
+	if err != nil {
+		writeMatchError(c, err, "could not create invite")
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// PreviewInvite is public so that people who have not registered yet can
+// see what they were invited to.
+func (h *Handler) PreviewInvite(c *gin.Context) {
+	preview, err := h.Service.PreviewInvite(c.Param("token"))
+	if err != nil {
+		writeMatchError(c, err, "failed to fetch invite")
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func (h *Handler) ClaimInvite(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in ClaimInvite")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	match, err := h.Service.ClaimInvite(c.Param("token"), userID)
+	if err != nil {
+		writeMatchError(c, err, "could not claim invite")
+		return
+	}
+
+	log.Infof("Head2Head invite claimed for match %s by %s", match.ID, userID)
+	c.JSON(http.StatusOK, match)
+}
+
 func (h *Handler) AcceptMatch(c *gin.Context) {
 	log := logger.FromContext(c)
 	matchID, err := uuid.Parse(c.Param("id"))
@@ -67,6 +256,9 @@ func (h *Handler) AcceptMatch(c *gin.Context) {
 	}
 
 	if err := h.Service.AcceptMatch(matchID, userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.WithError(err).Errorf("Failed to accept match %s", matchID)
+		}
 		utils.ErrorResponse(c, http.StatusBadRequest, "could not accept match")
 		return
 	}
@@ -74,6 +266,32 @@ func (h *Handler) AcceptMatch(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "match accepted"})
 }
 
+func (h *Handler) DeclineMatch(c *gin.Context) {
+	log := logger.FromContext(c)
+	matchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid match ID")
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in DeclineMatch")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := h.Service.DeclineMatch(matchID, userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.WithError(err).Errorf("Failed to decline match %s", matchID)
+		}
+		utils.ErrorResponse(c, http.StatusBadRequest, "could not decline match")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "match declined"})
+}
+
 func (h *Handler) SubmitSwipe(c *gin.Context) {
 	log := logger.FromContext(c)
 	var req SubmitSwipeRequest
@@ -96,9 +314,9 @@ func (h *Handler) SubmitSwipe(c *gin.Context) {
 		return
 	}
 
-	swipe, err := h.Service.SubmitSwipe(matchID, userID, req.RestaurantID, req.RestaurantName, req.Liked)
+	swipe, err := h.Service.SubmitSwipe(matchID, userID, req.RestaurantID, req.RestaurantName, req.Liked, req.SuperLike)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "failed to record swipe")
+		writeMatchError(c, err, "failed to record swipe")
 		return
 	}
 
@@ -114,12 +332,40 @@ func (h *Handler) GetMatchResults(c *gin.Context) {
 		return
 	}
 
-	matches, err := h.Service.GetMutualLikes(matchID)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in GetMatchResults")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	results, err := h.Service.GetResults(matchID, userID)
 	if err != nil {
-		log.WithError(err).Error("Failed to fetch match results")
-		utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch match results")
+		writeMatchError(c, err, "failed to fetch match results")
 		return
 	}
 
-	c.JSON(http.StatusOK, matches)
+	c.JSON(http.StatusOK, results)
+}
+
+func writeMatchError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrMatchNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Match not found.")
+	case errors.Is(err, ErrNotParticipant):
+		utils.ErrorResponse(c, http.StatusForbidden, "You are not a player in this match.")
+	case errors.Is(err, ErrMatchNotActive):
+		utils.ErrorResponse(c, http.StatusConflict, "Match is not active.")
+	case errors.Is(err, ErrInviteInvalid):
+		utils.ErrorResponse(c, http.StatusGone, "Invite link is invalid, expired or already claimed.")
+	case errors.Is(err, ErrAlreadyParticipant):
+		utils.ErrorResponse(c, http.StatusConflict, "You are already a player in this match.")
+	case errors.Is(err, ErrTooManyPlayers):
+		utils.ErrorResponse(c, http.StatusConflict, "Match is full.")
+	case errors.Is(err, ErrSuperLikeBudgetExceeded):
+		utils.ErrorResponse(c, http.StatusConflict, "No super-likes left for this match.")
+	default:
+		logger.FromContext(c).WithError(err).Error(fallback)
+		utils.ErrorResponse(c, http.StatusInternalServerError, fallback)
+	}
 }
@@ -0,0 +1,212 @@
+package head2head
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/pkg/utils"
+)
+
+// InviteLinkTTL is how long a shareable match invite stays claimable.
+const InviteLinkTTL = 72 * time.Hour
+
+// inviteTokenBytes is the amount of randomness in an invite token.
+const inviteTokenBytes = 18
+
+var ErrInviteInvalid = errors.New("invite link is invalid, expired or already claimed")
+var ErrAlreadyParticipant = errors.New("user is already a player in this match")
+
+type Invite struct {
+	Token     string    `json:"token"`
+	MatchID   uuid.UUID `json:"match_id"`
+	ClaimPath string    `json:"claim_path"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// InvitePreview is what an invite link reveals before it is claimed, so that
+// clients can show it to people who still have to register or log in.
+type InvitePreview struct {
+	MatchID     uuid.UUID `json:"match_id"`
+	InviterName string    `json:"inviter_name"`
+	Categories  []string  `json:"categories"`
+	Players     int       `json:"players"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ResolveInviteeEmails maps the emails of registered invitees to user IDs.
+// Emails nobody has registered with are skipped rather than reported, so that
+// invites cannot be used to find out who has an account; callers issue an
+// invite link for those people instead.
+func (s *Service) ResolveInviteeEmails(ctx context.Context, emails []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(emails))
+	for _, email := range emails {
+		u, err := s.Users.GetUserByEmail(ctx, strings.TrimSpace(email))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, err
+		}
+		id, err := uuid.Parse(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CreateInvite issues a single-use invite link for the match. Only players
+// who have joined the match may share it.
+func (s *Service) CreateInvite(matchID, userID uuid.UUID) (*Invite, error) {
+	match, err := s.loadMatch(matchID)
+	if err != nil {
+		return nil, err
+	}
+	if !match.hasAcceptedParticipant(userID) {
+		return nil, ErrNotParticipant
+	}
+	if match.Status != "pending" && match.Status != "active" {
+		return nil, ErrMatchNotActive
+	}
+
+	return insertInvite(s.DB, matchID, userID, time.Now())
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertInvite(db execer, matchID, userID uuid.UUID, now time.Time) (*Invite, error) {
+	token, err := utils.GenerateSecureToken(inviteTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := now.Add(InviteLinkTTL)
+
+	_, err = db.Exec(`
+		INSERT INTO head2head_invites (token, match_id, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, token, matchID, userID, expiresAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Invite{
+		Token:     token,
+		MatchID:   matchID,
+		ClaimPath: "/v1/h2h/invites/" + token + "/claim",
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *Service) PreviewInvite(token string) (*InvitePreview, error) {
+	var preview InvitePreview
+	err := s.DB.QueryRow(`
+		SELECT m.id, u.name, m.categories, i.expires_at,
+			(SELECT COUNT(*) FROM head2head_participants p WHERE p.match_id = m.id AND p.status = 'accepted')
+		FROM head2head_invites i
+		JOIN head2head_matches m ON m.id = i.match_id
+		JOIN users u ON u.id = m.inviter_id
+		WHERE i.token = $1 AND i.claimed_by IS NULL AND i.expires_at > $2
+			AND m.status IN ('pending', 'active')
+	`, token, time.Now()).Scan(&preview.MatchID, &preview.InviterName, pq.Array(&preview.Categories), &preview.ExpiresAt, &preview.Players)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInviteInvalid
+		}
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// ClaimInvite consumes the invite link and adds the user to the match as an
+// accepted player.
+func (s *Service) ClaimInvite(token string, userID uuid.UUID) (*Match, error) {
+	now := time.Now()
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var matchID uuid.UUID
+	err = tx.QueryRow(`
+		SELECT i.match_id FROM head2head_invites i
+		JOIN head2head_matches m ON m.id = i.match_id
+		WHERE i.token = $1 AND i.claimed_by IS NULL AND i.expires_at > $2
+			AND m.status IN ('pending', 'active')
+		FOR UPDATE OF i
+	`, token, now).Scan(&matchID)
+	if err != nil {
+		rollback(tx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInviteInvalid
+		}
+		return nil, err
+	}
+
+	var existing sql.NullString
+	var players int
+	err = tx.QueryRow(`
+		SELECT
+			(SELECT status FROM head2head_participants WHERE match_id = $1 AND user_id = $2),
+			(SELECT COUNT(*) FROM head2head_participants WHERE match_id = $1 AND status <> 'declined')
+	`, matchID, userID).Scan(&existing, &players)
+	if err != nil {
+		rollback(tx)
+		return nil, err
+	}
+	if existing.String == ParticipantAccepted {
+		rollback(tx)
+		return nil, ErrAlreadyParticipant
+	}
+	// Invited players already hold a seat; anyone else, including a player
+	// who declined, needs a free one.
+	if existing.String != ParticipantInvited && players >= MaxPlayers {
+		rollback(tx)
+		return nil, ErrTooManyPlayers
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO head2head_participants (match_id, user_id, status, joined_at, created_at)
+		VALUES ($1, $2, 'accepted', $3, $3)
+		ON CONFLICT (match_id, user_id) DO UPDATE SET status = 'accepted', joined_at = EXCLUDED.joined_at
+	`, matchID, userID, now)
+	if err != nil {
+		rollback(tx)
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE head2head_invites SET claimed_by = $2, claimed_at = $3 WHERE token = $1
+	`, token, userID, now)
+	if err != nil {
+		rollback(tx)
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE head2head_matches SET status = 'active', updated_at = $2 WHERE id = $1 AND status = 'pending'
+	`, matchID, now)
+	if err != nil {
+		rollback(tx)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	match, err := s.loadMatch(matchID)
+	if err != nil {
+		return nil, err
+	}
+	return match.visibleTo(userID), nil
+}
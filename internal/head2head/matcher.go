@@ -2,8 +2,11 @@ package head2head
 
 import (
 	"database/sql"
+	"errors"
+	"sort"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/turanoo/bitebattle/pkg/logger"
 )
 
@@ -15,13 +18,20 @@ func NewMatcher(db *sql.DB) *Matcher {
 	return &Matcher{DB: db}
 }
 
-func (m *Matcher) FindMutualLikes(matchID uuid.UUID) ([]Swipe, error) {
+// Rank tallies every swiped restaurant in the match and orders them by
+// weighted score. Restaurants reaching requiredLikes are flagged as consensus.
+// Stored restaurant details are attached where there are any.
+func (m *Matcher) Rank(matchID uuid.UUID, requiredLikes int) ([]RestaurantResult, error) {
 	rows, err := m.DB.Query(`
-		SELECT restaurant_id, restaurant_name
-		FROM head2head_swipes
-		WHERE match_id = $1 AND liked = TRUE
-		GROUP BY restaurant_id, restaurant_name
-		HAVING COUNT(DISTINCT user_id) = 2
+		SELECT s.restaurant_id, MAX(s.restaurant_name),
+			COUNT(DISTINCT s.user_id) FILTER (WHERE s.liked),
+			COUNT(DISTINCT s.user_id) FILTER (WHERE s.super_like),
+			COUNT(DISTINCT s.user_id) FILTER (WHERE NOT s.liked),
+			r.place_id IS NOT NULL, COALESCE(r.address, ''), COALESCE(r.rating, 0), r.price_level, COALESCE(r.types, '{}')
+		FROM head2head_swipes s
+		LEFT JOIN restaurants r ON r.place_id = s.restaurant_id
+		WHERE s.match_id = $1
+		GROUP BY s.restaurant_id, r.place_id
 	`, matchID)
 	if err != nil {
 		return nil, err
@@ -32,16 +42,97 @@ func (m *Matcher) FindMutualLikes(matchID uuid.UUID) ([]Swipe, error) {
 		}
 	}()
 
-	var matches []Swipe
+	results := []RestaurantResult{}
 	for rows.Next() {
-		var sw Swipe
-		if err := rows.Scan(&sw.RestaurantID, &sw.RestaurantName); err != nil {
+		var res RestaurantResult
+		var hasRestaurant bool
+		var info RestaurantInfo
+		var priceLevel sql.NullInt64
+		if err := rows.Scan(&res.RestaurantID, &res.RestaurantName, &res.Likes, &res.SuperLikes, &res.Dislikes,
+			&hasRestaurant, &info.Address, &info.Rating, &priceLevel, pq.Array(&info.Types)); err != nil {
 			return nil, err
 		}
-		sw.MatchID = matchID
-		sw.Liked = true
-		matches = append(matches, sw)
+		if hasRestaurant {
+			if priceLevel.Valid {
+				level := int(priceLevel.Int64)
+				info.PriceLevel = &level
+			}
+			res.Restaurant = &info
+		}
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return RankResults(results, requiredLikes), nil
+}
+
+// RestaurantInfo returns the stored summary of a restaurant, or nil if no
+// details are stored for it.
+func (m *Matcher) RestaurantInfo(restaurantID string) (*RestaurantInfo, error) {
+	var info RestaurantInfo
+	var priceLevel sql.NullInt64
+	err := m.DB.QueryRow(`
+		SELECT address, COALESCE(rating, 0), price_level, types
+		FROM restaurants WHERE place_id = $1
+	`, restaurantID).Scan(&info.Address, &info.Rating, &priceLevel, pq.Array(&info.Types))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if priceLevel.Valid {
+		level := int(priceLevel.Int64)
+		info.PriceLevel = &level
 	}
+	return &info, nil
+}
 
-	return matches, nil
+// RankResults scores the tallied restaurants and sorts them best first.
+func RankResults(results []RestaurantResult, requiredLikes int) []RestaurantResult {
+	for i := range results {
+		res := &results[i]
+		plainLikes := res.Likes - res.SuperLikes
+		res.Score = res.SuperLikes*superLikeWeight + plainLikes*likeWeight + res.Dislikes*dislikeWeight
+		res.Consensus = requiredLikes > 0 && res.Likes >= requiredLikes
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Likes != b.Likes {
+			return a.Likes > b.Likes
+		}
+		if a.Dislikes != b.Dislikes {
+			return a.Dislikes < b.Dislikes
+		}
+		return a.RestaurantName < b.RestaurantName
+	})
+	return results
+}
+
+// BestCompromise picks the liked restaurant the fewest players objected to,
+// breaking ties by score. It returns nil if nothing was liked at all.
+func BestCompromise(results []RestaurantResult) *RestaurantResult {
+	var best *RestaurantResult
+	for i := range results {
+		res := &results[i]
+		if res.Likes == 0 {
+			continue
+		}
+		if best == nil ||
+			res.Dislikes < best.Dislikes ||
+			(res.Dislikes == best.Dislikes && res.Score > best.Score) {
+			best = res
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	compromise := *best
+	return &compromise
 }
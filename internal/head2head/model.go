@@ -6,25 +6,93 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	ConsensusUnanimous = "unanimous"
+	ConsensusMajority  = "majority"
+	ConsensusKOfN      = "k_of_n"
+)
+
+const (
+	ParticipantInvited  = "invited"
+	ParticipantAccepted = "accepted"
+	ParticipantDeclined = "declined"
+)
+
+// MaxPlayers caps the size of a match, inviter included.
+const MaxPlayers = 8
+
+// DefaultSuperLikeBudget is how many super-likes each player gets per match
+// unless the inviter chooses otherwise.
+const DefaultSuperLikeBudget = 3
+
+// Swipe weights used to score restaurants in match results.
+const (
+	superLikeWeight = 3
+	likeWeight      = 1
+	dislikeWeight   = -1
+)
+
+// CreateMatchRequest needs at least one invitee ID or email, or InviteLink
+// set so players can be invited by sharing a link.
 type CreateMatchRequest struct {
-	InviteeID  string   `json:"invitee_id" binding:"required,uuid"`
-	Categories []string `json:"categories" binding:"required,min=1,dive,required"`
+	// InviteeID is the single invitee of two-player matches. Deprecated: use
+	// InviteeIDs; it is folded into them.
+	InviteeID     string   `json:"invitee_id" binding:"omitempty,uuid"`
+	InviteeIDs    []string `json:"invitee_ids" binding:"omitempty,max=7,dive,required,uuid"`
+	InviteeEmails []string `json:"invitee_emails" binding:"omitempty,max=7,dive,required,email"`
+	InviteLink    bool     `json:"invite_link"`
+	Categories    []string `json:"categories" binding:"required,min=1,dive,required"`
+	Consensus     string   `json:"consensus" binding:"omitempty,oneof=unanimous majority k_of_n"`
+	ConsensusK    int      `json:"consensus_k" binding:"omitempty,min=1,max=8"`
+	// SuperLikeBudget defaults to DefaultSuperLikeBudget when omitted.
+	SuperLikeBudget *int `json:"super_like_budget" binding:"omitempty,min=0,max=10"`
 }
 
 type SubmitSwipeRequest struct {
 	RestaurantID   string `json:"restaurant_id" binding:"required"`
 	RestaurantName string `json:"restaurant_name" binding:"required"`
 	Liked          bool   `json:"liked"`
+	SuperLike      bool   `json:"super_like"` // implies liked
+}
+
+// MatchOptions are the rules a match is created with.
+type MatchOptions struct {
+	Categories      []string
+	Consensus       string
+	ConsensusK      int
+	SuperLikeBudget int
+	// InviteLink issues a shareable invite along with the match.
+	InviteLink bool
+	// EmailInvitees are registered users invited by email. Until they join
+	// they are only shown to themselves, so the inviter can't tell which
+	// addresses belong to accounts.
+	EmailInvitees []uuid.UUID
+}
+
+// RematchRequest optionally replaces the categories of the original match.
+type RematchRequest struct {
+	Categories []string `json:"categories" binding:"omitempty,dive,required"`
 }
 
 type Match struct {
-	ID         uuid.UUID `json:"id"`
-	InviterID  uuid.UUID `json:"inviter_id"`
-	InviteeID  uuid.UUID `json:"invitee_id"`
-	Status     string    `json:"status"` // pending, active, completed, cancelled
-	Categories []string  `json:"categories"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID              uuid.UUID     `json:"id"`
+	InviterID       uuid.UUID     `json:"inviter_id"`
+	Status          string        `json:"status"` // pending, active, completed, cancelled
+	Categories      []string      `json:"categories"`
+	Consensus       string        `json:"consensus"`
+	ConsensusK      int           `json:"consensus_k,omitempty"`
+	SuperLikeBudget int           `json:"super_like_budget"`
+	Participants    []Participant `json:"participants"`
+	Invite          *Invite       `json:"invite,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+type Participant struct {
+	UserID         uuid.UUID  `json:"user_id"`
+	Status         string     `json:"status"` // invited, accepted, declined
+	JoinedAt       *time.Time `json:"joined_at,omitempty"`
+	InvitedByEmail bool       `json:"-"`
 }
 
 type Swipe struct {
@@ -34,5 +102,85 @@ type Swipe struct {
 	RestaurantID   string    `json:"restaurant_id"`
 	RestaurantName string    `json:"restaurant_name"`
 	Liked          bool      `json:"liked"`
+	SuperLike      bool      `json:"super_like"`
 	CreatedAt      time.Time `json:"created_at"`
 }
+
+// SwipeResult is returned from a swipe. Match is set when this swipe brought
+// the restaurant to the match's consensus threshold.
+type SwipeResult struct {
+	Swipe
+	IsMatch bool              `json:"is_match"`
+	Match   *RestaurantResult `json:"match,omitempty"`
+}
+
+type RestaurantResult struct {
+	RestaurantID   string `json:"restaurant_id"`
+	RestaurantName string `json:"restaurant_name"`
+	Likes          int    `json:"likes"` // players who liked or super-liked
+	SuperLikes     int    `json:"super_likes"`
+	Dislikes       int    `json:"dislikes"`
+	Score          int    `json:"score"`
+	Consensus      bool   `json:"consensus"`
+	// Restaurant is set once details for the restaurant are stored.
+	Restaurant *RestaurantInfo `json:"restaurant,omitempty"`
+}
+
+// RestaurantInfo is the stored summary of a swiped restaurant.
+type RestaurantInfo struct {
+	Address    string   `json:"address,omitempty"`
+	Rating     float64  `json:"rating,omitempty"`
+	PriceLevel *int     `json:"price_level,omitempty"`
+	Types      []string `json:"types,omitempty"`
+}
+
+type MatchResults struct {
+	MatchID       uuid.UUID          `json:"match_id"`
+	Consensus     string             `json:"consensus"`
+	Players       int                `json:"players"`
+	RequiredLikes int                `json:"required_likes"`
+	Restaurants   []RestaurantResult `json:"restaurants"`
+	// Compromise is set when no restaurant reached consensus.
+	Compromise *RestaurantResult `json:"compromise,omitempty"`
+}
+
+// visibleTo returns the match as the user may see it: players invited by
+// email who haven't joined are hidden from everyone else.
+func (m *Match) visibleTo(userID uuid.UUID) *Match {
+	visible := *m
+	visible.Participants = []Participant{}
+	for _, p := range m.Participants {
+		if p.InvitedByEmail && p.Status != ParticipantAccepted && p.UserID != userID {
+			continue
+		}
+		visible.Participants = append(visible.Participants, p)
+	}
+	return &visible
+}
+
+// AcceptedCount returns how many participants have joined the match.
+func (m *Match) AcceptedCount() int {
+	count := 0
+	for _, p := range m.Participants {
+		if p.Status == ParticipantAccepted {
+			count++
+		}
+	}
+	return count
+}
+
+// RequiredLikes returns how many players must like a restaurant for it to
+// count as a match under the given consensus rule.
+func RequiredLikes(consensus string, k, players int) int {
+	switch consensus {
+	case ConsensusMajority:
+		return players/2 + 1
+	case ConsensusKOfN:
+		if k > players {
+			return players
+		}
+		return k
+	default:
+		return players
+	}
+}
@@ -2,92 +2,533 @@ package head2head
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/internal/notification"
+	"github.com/turanoo/bitebattle/internal/user"
 	"github.com/turanoo/bitebattle/pkg/config"
-	"github.com/turanoo/bitebattle/pkg/db"
+	"github.com/turanoo/bitebattle/pkg/logger"
 )
 
+var ErrMatchNotFound = errors.New("match not found")
+var ErrNotParticipant = errors.New("user is not a participant in this match")
+var ErrMatchNotActive = errors.New("match is not active")
+var ErrInvalidConsensus = errors.New("invalid consensus settings for match")
+var ErrTooManyPlayers = errors.New("too many players for match")
+var ErrNoInvitees = errors.New("match needs at least one invitee")
+var ErrSuperLikeBudgetExceeded = errors.New("no super-likes left for this match")
+
 type Service struct {
-	DB      *sql.DB
-	Matcher *Matcher
+	DB       *sql.DB
+	Matcher  *Matcher
+	Notifier *notification.Notifier
+	Users    *user.Service
 	// Add config if needed in future
 }
 
-func NewService(db *sql.DB, cfg *config.Config) *Service {
-	return &Service{DB: db, Matcher: NewMatcher(db)}
+func NewService(db *sql.DB, cfg *config.Config, notifier *notification.Notifier, users *user.Service) *Service {
+	return &Service{DB: db, Matcher: NewMatcher(db), Notifier: notifier, Users: users}
 }
 
-func (s *Service) CreateMatch(inviterID, inviteeID uuid.UUID, categories []string) (*Match, error) {
+func (s *Service) CreateMatch(inviterID uuid.UUID, inviteeIDs []uuid.UUID, opts MatchOptions) (*Match, error) {
+	invitees := dedupeInvitees(inviterID, inviteeIDs)
+	// Someone invited both ways is invited by ID, as the inviter knows them.
+	var emailInvitees []uuid.UUID
+	for _, id := range dedupeInvitees(inviterID, opts.EmailInvitees) {
+		if !containsUser(invitees, id) {
+			emailInvitees = append(emailInvitees, id)
+		}
+	}
+	if len(invitees)+len(emailInvitees) == 0 && !opts.InviteLink {
+		return nil, ErrNoInvitees
+	}
+	if len(invitees)+len(emailInvitees)+1 > MaxPlayers {
+		return nil, ErrTooManyPlayers
+	}
+
+	consensus := opts.Consensus
+	if consensus == "" {
+		consensus = ConsensusUnanimous
+	}
+	consensusK := opts.ConsensusK
+	var k sql.NullInt64
+	if consensus == ConsensusKOfN {
+		// Link invites may still bring in more players, so only the cap applies.
+		maxK := len(invitees) + len(emailInvitees) + 1
+		if opts.InviteLink {
+			maxK = MaxPlayers
+		}
+		if consensusK < 1 || consensusK > maxK {
+			return nil, ErrInvalidConsensus
+		}
+		k = sql.NullInt64{Int64: int64(consensusK), Valid: true}
+	} else {
+		consensusK = 0
+	}
+
 	id := uuid.New()
 	now := time.Now()
 
-	_, err := s.DB.Exec(`
-		INSERT INTO head2head_matches (id, inviter_id, invitee_id, status, categories, created_at, updated_at)
-		VALUES ($1, $2, $3, 'pending', $4, $5, $6)
-	`, id, inviterID, inviteeID, pq.Array(categories), now, now)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
 
+	_, err = tx.Exec(`
+		INSERT INTO head2head_matches (id, inviter_id, status, categories, consensus, consensus_k, super_like_budget, created_at, updated_at)
+		VALUES ($1, $2, 'pending', $3, $4, $5, $6, $7, $8)
+	`, id, inviterID, pq.Array(opts.Categories), consensus, k, opts.SuperLikeBudget, now, now)
 	if err != nil {
+		rollback(tx)
 		return nil, err
 	}
 
-	return &Match{
-		ID:         id,
-		InviterID:  inviterID,
-		InviteeID:  inviteeID,
-		Status:     "pending",
-		Categories: categories,
-		CreatedAt:  now,
-		UpdatedAt:  now,
-	}, nil
+	participants := []Participant{{UserID: inviterID, Status: ParticipantAccepted, JoinedAt: &now}}
+	for _, inviteeID := range invitees {
+		participants = append(participants, Participant{UserID: inviteeID, Status: ParticipantInvited})
+	}
+	for _, inviteeID := range emailInvitees {
+		participants = append(participants, Participant{UserID: inviteeID, Status: ParticipantInvited, InvitedByEmail: true})
+	}
+
+	for _, p := range participants {
+		_, err = tx.Exec(`
+			INSERT INTO head2head_participants (match_id, user_id, status, joined_at, invited_by_email, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, id, p.UserID, p.Status, p.JoinedAt, p.InvitedByEmail, now)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+	}
+
+	var invite *Invite
+	if opts.InviteLink {
+		invite, err = insertInvite(tx, id, inviterID, now)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	match := &Match{
+		ID:              id,
+		InviterID:       inviterID,
+		Status:          "pending",
+		Categories:      opts.Categories,
+		Consensus:       consensus,
+		ConsensusK:      consensusK,
+		SuperLikeBudget: opts.SuperLikeBudget,
+		Participants:    participants,
+		Invite:          invite,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	return match.visibleTo(inviterID), nil
+}
+
+// Rematch starts a new match with the same players and rules as an earlier
+// one. Only players who joined the original may ask for one. The requester
+// becomes the inviter; everyone else is invited again.
+func (s *Service) Rematch(matchID, userID uuid.UUID, categories []string) (*Match, error) {
+	original, err := s.loadMatch(matchID)
+	if err != nil {
+		return nil, err
+	}
+	if !original.hasAcceptedParticipant(userID) {
+		return nil, ErrNotParticipant
+	}
+	if len(categories) == 0 {
+		categories = original.Categories
+	}
+
+	// Players invited by email who never joined stay hidden in the rematch.
+	invitees, emailInvitees := []uuid.UUID{}, []uuid.UUID{}
+	for _, p := range original.Participants {
+		switch {
+		case p.UserID == userID || p.Status == ParticipantDeclined:
+		case p.InvitedByEmail && p.Status != ParticipantAccepted:
+			emailInvitees = append(emailInvitees, p.UserID)
+		default:
+			invitees = append(invitees, p.UserID)
+		}
+	}
+
+	return s.CreateMatch(userID, invitees, MatchOptions{
+		Categories:      categories,
+		Consensus:       original.Consensus,
+		ConsensusK:      original.ConsensusK,
+		SuperLikeBudget: original.SuperLikeBudget,
+		EmailInvitees:   emailInvitees,
+	})
 }
 
+// GetMatch loads a match with the participants the requesting user may see.
+// The requesting user must be one of the participants.
+func (s *Service) GetMatch(matchID, userID uuid.UUID) (*Match, error) {
+	match, err := s.loadMatch(matchID)
+	if err != nil {
+		return nil, err
+	}
+	if !match.hasParticipant(userID) {
+		return nil, ErrNotParticipant
+	}
+	return match.visibleTo(userID), nil
+}
+
+// AcceptMatch records the player's acceptance. The match becomes active as
+// soon as one invitee has joined the inviter.
 func (s *Service) AcceptMatch(matchID, userID uuid.UUID) error {
-	row := s.DB.QueryRow(`
-		SELECT invitee_id FROM head2head_matches WHERE id = $1 AND status = 'pending'
-	`, matchID)
+	now := time.Now()
 
-	var inviteeID uuid.UUID
-	err := db.ScanOne(row, &inviteeID)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE head2head_participants p
+		SET status = 'accepted', joined_at = $3
+		FROM head2head_matches m
+		WHERE p.match_id = m.id
+			AND p.match_id = $1 AND p.user_id = $2
+			AND p.status = 'invited'
+			AND m.status IN ('pending', 'active')
+	`, matchID, userID, now)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		rollback(tx)
 		return err
 	}
-	if inviteeID == uuid.Nil || inviteeID != userID {
+	if rowsAffected == 0 {
+		rollback(tx)
 		return sql.ErrNoRows
 	}
 
-	_, err = s.DB.Exec(`
-		UPDATE head2head_matches SET status = 'active', updated_at = $2 WHERE id = $1
-	`, matchID, time.Now())
-	return err
+	_, err = tx.Exec(`
+		UPDATE head2head_matches SET status = 'active', updated_at = $2 WHERE id = $1 AND status = 'pending'
+	`, matchID, now)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *Service) SubmitSwipe(matchID, userID uuid.UUID, restaurantID, restaurantName string, liked bool) (*Swipe, error) {
-	id := uuid.New()
+// DeclineMatch records that an invited player will not play. A pending match
+// is cancelled once nobody is left to join it: no invitee still has to answer
+// and no invite link can still be claimed.
+func (s *Service) DeclineMatch(matchID, userID uuid.UUID) error {
 	now := time.Now()
 
-	_, err := s.DB.Exec(`
-		INSERT INTO head2head_swipes (id, match_id, user_id, restaurant_id, restaurant_name, liked, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, id, matchID, userID, restaurantID, restaurantName, liked, now)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE head2head_participants p
+		SET status = 'declined'
+		FROM head2head_matches m
+		WHERE p.match_id = m.id
+			AND p.match_id = $1 AND p.user_id = $2
+			AND p.status = 'invited'
+			AND m.status IN ('pending', 'active')
+	`, matchID, userID)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	if rowsAffected == 0 {
+		rollback(tx)
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`
+		UPDATE head2head_matches SET status = 'cancelled', updated_at = $2
+		WHERE id = $1 AND status = 'pending'
+			AND NOT EXISTS (SELECT 1 FROM head2head_participants WHERE match_id = $1 AND status = 'invited')
+			AND NOT EXISTS (SELECT 1 FROM head2head_invites WHERE match_id = $1 AND claimed_by IS NULL AND expires_at > $2)
+	`, matchID, now)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SubmitSwipe records or replaces the player's swipe on a restaurant. A
+// super-like counts as a like and draws from the player's per-match budget.
+// If the like brings the restaurant to consensus, the other players are
+// notified straight away.
+func (s *Service) SubmitSwipe(matchID, userID uuid.UUID, restaurantID, restaurantName string, liked, superLike bool) (*SwipeResult, error) {
+	match, err := s.loadMatch(matchID)
+	if err != nil {
+		return nil, err
+	}
+	if !match.hasAcceptedParticipant(userID) {
+		return nil, ErrNotParticipant
+	}
+	if match.Status != "active" {
+		return nil, ErrMatchNotActive
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the player's row so that concurrent swipes are applied one at a
+	// time and cannot overspend the super-like budget between them.
+	_, err = tx.Exec(`
+		SELECT 1 FROM head2head_participants WHERE match_id = $1 AND user_id = $2 FOR UPDATE
+	`, matchID, userID)
+	if err != nil {
+		rollback(tx)
+		return nil, err
+	}
+
+	if superLike {
+		liked = true
+		var used int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM head2head_swipes
+			WHERE match_id = $1 AND user_id = $2 AND super_like = TRUE AND restaurant_id <> $3
+		`, matchID, userID, restaurantID).Scan(&used)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+		if used >= match.SuperLikeBudget {
+			rollback(tx)
+			return nil, ErrSuperLikeBudgetExceeded
+		}
+	}
+
+	var wasLiked bool
+	err = tx.QueryRow(`
+		SELECT liked FROM head2head_swipes WHERE match_id = $1 AND user_id = $2 AND restaurant_id = $3
+	`, matchID, userID, restaurantID).Scan(&wasLiked)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		rollback(tx)
+		return nil, err
+	}
+
+	id := uuid.New()
+	now := time.Now()
 
+	err = tx.QueryRow(`
+		INSERT INTO head2head_swipes (id, match_id, user_id, restaurant_id, restaurant_name, liked, super_like, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (match_id, user_id, restaurant_id)
+		DO UPDATE SET restaurant_name = EXCLUDED.restaurant_name, liked = EXCLUDED.liked,
+			super_like = EXCLUDED.super_like, created_at = EXCLUDED.created_at
+		RETURNING id
+	`, id, matchID, userID, restaurantID, restaurantName, liked, superLike, now).Scan(&id)
 	if err != nil {
+		rollback(tx)
 		return nil, err
 	}
 
-	return &Swipe{
+	// A new like is counted under a lock on the restaurant, held until
+	// commit, so that of several players liking it at once exactly one sees
+	// the like that reaches consensus and sends the notifications.
+	likes := 0
+	if liked && !wasLiked {
+		_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "head2head:"+matchID.String()+":"+restaurantID)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+		err = tx.QueryRow(`
+			SELECT COUNT(DISTINCT user_id) FROM head2head_swipes
+			WHERE match_id = $1 AND restaurant_id = $2 AND liked = TRUE
+		`, matchID, restaurantID).Scan(&likes)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	result := &SwipeResult{Swipe: Swipe{
 		ID:             id,
 		MatchID:        matchID,
 		UserID:         userID,
 		RestaurantID:   restaurantID,
 		RestaurantName: restaurantName,
 		Liked:          liked,
+		SuperLike:      superLike,
 		CreatedAt:      now,
-	}, nil
+	}}
+
+	required := RequiredLikes(match.Consensus, match.ConsensusK, match.AcceptedCount())
+	if !liked || wasLiked || likes != required {
+		return result, nil
+	}
+
+	result.IsMatch = true
+	result.Match = &RestaurantResult{
+		RestaurantID:   restaurantID,
+		RestaurantName: restaurantName,
+		Likes:          likes,
+		Consensus:      true,
+	}
+	// The stored details only dress up the card, so a failure is logged.
+	if result.Match.Restaurant, err = s.Matcher.RestaurantInfo(restaurantID); err != nil {
+		logger.Log.WithError(err).Warnf("Failed to load stored details for restaurant %s", restaurantID)
+	}
+	for _, p := range match.Participants {
+		if p.UserID != userID && p.Status == ParticipantAccepted {
+			s.Notifier.NotifyItsAMatch(p.UserID, restaurantName)
+		}
+	}
+	return result, nil
 }
 
-func (s *Service) GetMutualLikes(matchID uuid.UUID) ([]Swipe, error) {
-	return s.Matcher.FindMutualLikes(matchID)
+// GetResults ranks the swiped restaurants of a match by weighted score and
+// flags the ones that satisfy the match's consensus rule among the players who
+// joined. When nothing reaches consensus the best compromise is included.
+func (s *Service) GetResults(matchID, userID uuid.UUID) (*MatchResults, error) {
+	match, err := s.GetMatch(matchID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	players := match.AcceptedCount()
+	required := RequiredLikes(match.Consensus, match.ConsensusK, players)
+
+	restaurants, err := s.Matcher.Rank(matchID, required)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &MatchResults{
+		MatchID:       matchID,
+		Consensus:     match.Consensus,
+		Players:       players,
+		RequiredLikes: required,
+		Restaurants:   restaurants,
+	}
+	if !hasConsensus(restaurants) {
+		results.Compromise = BestCompromise(restaurants)
+	}
+	return results, nil
+}
+
+func (s *Service) loadMatch(matchID uuid.UUID) (*Match, error) {
+	var match Match
+	var k sql.NullInt64
+	err := s.DB.QueryRow(`
+		SELECT id, inviter_id, status, categories, consensus, consensus_k, super_like_budget, created_at, updated_at
+		FROM head2head_matches WHERE id = $1
+	`, matchID).Scan(&match.ID, &match.InviterID, &match.Status, pq.Array(&match.Categories), &match.Consensus, &k,
+		&match.SuperLikeBudget, &match.CreatedAt, &match.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMatchNotFound
+		}
+		return nil, err
+	}
+	match.ConsensusK = int(k.Int64)
+
+	rows, err := s.DB.Query(`
+		SELECT user_id, status, joined_at, invited_by_email FROM head2head_participants
+		WHERE match_id = $1
+		ORDER BY created_at, user_id
+	`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	match.Participants = []Participant{}
+	for rows.Next() {
+		var p Participant
+		if err := rows.Scan(&p.UserID, &p.Status, &p.JoinedAt, &p.InvitedByEmail); err != nil {
+			return nil, err
+		}
+		match.Participants = append(match.Participants, p)
+	}
+
+	return &match, rows.Err()
+}
+
+func (m *Match) hasParticipant(userID uuid.UUID) bool {
+	for _, p := range m.Participants {
+		if p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Match) hasAcceptedParticipant(userID uuid.UUID) bool {
+	for _, p := range m.Participants {
+		if p.UserID == userID && p.Status == ParticipantAccepted {
+			return true
+		}
+	}
+	return false
+}
+
+func hasConsensus(results []RestaurantResult) bool {
+	for _, res := range results {
+		if res.Consensus {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupeInvitees(inviterID uuid.UUID, inviteeIDs []uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{inviterID: true}
+	invitees := []uuid.UUID{}
+	for _, id := range inviteeIDs {
+		if id == uuid.Nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		invitees = append(invitees, id)
+	}
+	return invitees
+}
+
+func containsUser(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil {
+		logger.Log.WithError(err).Error("failed to rollback transaction")
+	}
 }
@@ -0,0 +1,210 @@
+package head2head
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+var ErrSelfStats = errors.New("cannot compare a user with themselves")
+
+// topCuisineLimit caps how many cuisines are reported in pair stats.
+const topCuisineLimit = 5
+
+// minAgreedMatches is how many matches a restaurant must have come up in
+// before agreeing on it every time counts as always agreeing.
+const minAgreedMatches = 2
+
+type PairStats struct {
+	UserID        uuid.UUID          `json:"user_id"`
+	OpponentID    uuid.UUID          `json:"opponent_id"`
+	MatchesPlayed int                `json:"matches_played"`
+	MutualLikes   int                `json:"mutual_likes"`
+	TopCuisines   []CuisineCount     `json:"top_cuisines"`
+	AlwaysAgree   []AgreedRestaurant `json:"always_agree"`
+}
+
+type CuisineCount struct {
+	Cuisine     string `json:"cuisine"`
+	MutualLikes int    `json:"mutual_likes"`
+}
+
+type AgreedRestaurant struct {
+	RestaurantID   string `json:"restaurant_id"`
+	RestaurantName string `json:"restaurant_name"`
+	Matches        int    `json:"matches"`
+}
+
+// genericTypes are place types that say nothing about the cuisine.
+var genericTypes = map[string]bool{
+	"restaurant": true, "food": true, "point_of_interest": true, "establishment": true,
+	"meal_takeaway": true, "meal_delivery": true, "store": true,
+}
+
+// pairSwipe is a restaurant both players swiped on in the same match, with
+// its stored place types if any.
+type pairSwipe struct {
+	MatchID        uuid.UUID
+	RestaurantID   string
+	RestaurantName string
+	Types          []string
+	UserLiked      bool
+	OpponentLiked  bool
+}
+
+// GetPairStats summarizes the matches two users have played together.
+func (s *Service) GetPairStats(userID, opponentID uuid.UUID) (*PairStats, error) {
+	if userID == opponentID {
+		return nil, ErrSelfStats
+	}
+	rows, err := s.DB.Query(`
+		SELECT m.id, m.categories
+		FROM head2head_matches m
+		JOIN head2head_participants a ON a.match_id = m.id AND a.user_id = $1 AND a.status = 'accepted'
+		JOIN head2head_participants b ON b.match_id = m.id AND b.user_id = $2 AND b.status = 'accepted'
+		WHERE m.status IN ('active', 'completed')
+	`, userID, opponentID)
+	if err != nil {
+		return nil, err
+	}
+	categories := map[uuid.UUID][]string{}
+	for rows.Next() {
+		var matchID uuid.UUID
+		var cats []string
+		if err := rows.Scan(&matchID, pq.Array(&cats)); err != nil {
+			closeRows(rows)
+			return nil, err
+		}
+		categories[matchID] = cats
+	}
+	closeRows(rows)
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.DB.Query(`
+		SELECT a.match_id, a.restaurant_id, a.restaurant_name, r.types, a.liked, b.liked
+		FROM head2head_swipes a
+		JOIN head2head_swipes b
+			ON b.match_id = a.match_id AND b.restaurant_id = a.restaurant_id AND b.user_id = $2
+		LEFT JOIN restaurants r ON r.place_id = a.restaurant_id
+		WHERE a.user_id = $1
+	`, userID, opponentID)
+	if err != nil {
+		return nil, err
+	}
+	swipes := []pairSwipe{}
+	for rows.Next() {
+		var ps pairSwipe
+		if err := rows.Scan(&ps.MatchID, &ps.RestaurantID, &ps.RestaurantName, pq.Array(&ps.Types), &ps.UserLiked, &ps.OpponentLiked); err != nil {
+			closeRows(rows)
+			return nil, err
+		}
+		swipes = append(swipes, ps)
+	}
+	closeRows(rows)
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := buildPairStats(categories, swipes)
+	stats.UserID = userID
+	stats.OpponentID = opponentID
+	return stats, nil
+}
+
+func buildPairStats(categories map[uuid.UUID][]string, swipes []pairSwipe) *PairStats {
+	stats := &PairStats{
+		MatchesPlayed: len(categories),
+		TopCuisines:   []CuisineCount{},
+		AlwaysAgree:   []AgreedRestaurant{},
+	}
+
+	cuisineLikes := map[string]int{}
+	type agreement struct {
+		name   string
+		seen   int
+		agreed int
+	}
+	byRestaurant := map[string]*agreement{}
+
+	for _, ps := range swipes {
+		cats, played := categories[ps.MatchID]
+		if !played {
+			continue
+		}
+		mutual := ps.UserLiked && ps.OpponentLiked
+		if mutual {
+			stats.MutualLikes++
+			for _, c := range cuisines(ps.Types, cats) {
+				cuisineLikes[c]++
+			}
+		}
+
+		a := byRestaurant[ps.RestaurantID]
+		if a == nil {
+			a = &agreement{name: ps.RestaurantName}
+			byRestaurant[ps.RestaurantID] = a
+		}
+		a.seen++
+		if mutual {
+			a.agreed++
+		}
+	}
+
+	for cuisine, likes := range cuisineLikes {
+		stats.TopCuisines = append(stats.TopCuisines, CuisineCount{Cuisine: cuisine, MutualLikes: likes})
+	}
+	sort.Slice(stats.TopCuisines, func(i, j int) bool {
+		a, b := stats.TopCuisines[i], stats.TopCuisines[j]
+		if a.MutualLikes != b.MutualLikes {
+			return a.MutualLikes > b.MutualLikes
+		}
+		return a.Cuisine < b.Cuisine
+	})
+	if len(stats.TopCuisines) > topCuisineLimit {
+		stats.TopCuisines = stats.TopCuisines[:topCuisineLimit]
+	}
+
+	for id, a := range byRestaurant {
+		if a.seen >= minAgreedMatches && a.agreed == a.seen {
+			stats.AlwaysAgree = append(stats.AlwaysAgree, AgreedRestaurant{RestaurantID: id, RestaurantName: a.name, Matches: a.seen})
+		}
+	}
+	sort.Slice(stats.AlwaysAgree, func(i, j int) bool {
+		a, b := stats.AlwaysAgree[i], stats.AlwaysAgree[j]
+		if a.Matches != b.Matches {
+			return a.Matches > b.Matches
+		}
+		return a.RestaurantName < b.RestaurantName
+	})
+
+	return stats
+}
+
+// cuisines returns the cuisines a restaurant's place types name, as in
+// "thai" for "thai_restaurant". A restaurant with no stored types falls back
+// to its match's category when the match had only one.
+func cuisines(types, categories []string) []string {
+	var found []string
+	for _, t := range types {
+		if genericTypes[t] {
+			continue
+		}
+		found = append(found, strings.TrimSuffix(t, "_restaurant"))
+	}
+	if len(types) == 0 && len(categories) == 1 {
+		found = categories
+	}
+	return found
+}
+
+func closeRows(rows interface{ Close() error }) {
+	if err := rows.Close(); err != nil {
+		logger.Log.WithError(err).Error("failed to close rows")
+	}
+}
@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/turanoo/bitebattle/internal/auth"
+	"github.com/turanoo/bitebattle/pkg/logger"
+	"github.com/turanoo/bitebattle/pkg/utils"
+)
+
+// keepAliveInterval keeps idle streams from being closed by proxies.
+const keepAliveInterval = 25 * time.Second
+
+type Handler struct {
+	Service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{Service: service}
+}
+
+// Stream pushes the caller's notifications as server-sent events for as long
+// as the connection stays open.
+func (h *Handler) Stream(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in notification Stream")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	events, unsubscribe := h.Service.Hub.Subscribe(userID)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{"user_id": userID})
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case n, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("notification", n)
+			return true
+		case <-ticker.C:
+			c.SSEvent("ping", gin.H{"at": time.Now()})
+			return true
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// subscriberBuffer bounds how many notifications may queue for a slow
+// connection before new ones are dropped for it.
+const subscriberBuffer = 16
+
+// Hub fans notifications out to the live connections of each user. It only
+// reaches connections held by this server instance; the notifications table
+// remains the source of truth.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[uuid.UUID]map[chan Notification]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[uuid.UUID]map[chan Notification]struct{})}
+}
+
+// Subscribe registers a live connection for the user. The returned function
+// must be called once the connection goes away.
+func (h *Hub) Subscribe(userID uuid.UUID) (<-chan Notification, func()) {
+	ch := make(chan Notification, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan Notification]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+// Publish delivers the notification to every live connection of its user
+// without blocking on slow readers.
+func (h *Hub) Publish(n Notification) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subscribers[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+		}
+	}
+}
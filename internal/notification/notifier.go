@@ -28,3 +28,8 @@ func (n *Notifier) NotifyVoted(userID uuid.UUID, restaurantName string) {
 	msg := fmt.Sprintf("You voted for \"%s\"", restaurantName)
 	_ = n.Service.Send(userID, msg)
 }
+
+func (n *Notifier) NotifyItsAMatch(userID uuid.UUID, restaurantName string) {
+	msg := fmt.Sprintf("It's a match! Your group agreed on \"%s\"", restaurantName)
+	_ = n.Service.Send(userID, msg)
+}
@@ -8,17 +8,30 @@ import (
 )
 
 type Service struct {
-	DB *sql.DB
+	DB  *sql.DB
+	Hub *Hub
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{DB: db}
+func NewService(db *sql.DB, hub *Hub) *Service {
+	return &Service{DB: db, Hub: hub}
 }
 
+// Send persists the notification and publishes it to the user's live
+// connections.
 func (s *Service) Send(userID uuid.UUID, message string) error {
+	n := Notification{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
 	_, err := s.DB.Exec(`
 		INSERT INTO notifications (id, user_id, message, created_at)
 		VALUES ($1, $2, $3, $4)
-	`, uuid.New(), userID, message, time.Now())
-	return err
+	`, n.ID, n.UserID, n.Message, n.CreatedAt)
+	if err != nil {
+		return err
+	}
+	s.Hub.Publish(n)
+	return nil
 }
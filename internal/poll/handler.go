@@ -193,6 +193,14 @@ func (h *Handler) AddOption(c *gin.Context) {
 	var addedOptions []PollOption
 	for _, opt := range req {
 		option, err := h.Service.AddOption(pollID, opt.RestaurantID, opt.Name, opt.ImageURL, opt.MenuURL)
+		if errors.Is(err, ErrPollClosed) {
+			utils.ErrorResponse(c, http.StatusConflict, "Poll is closed.")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Poll not found.")
+			return
+		}
 		if err != nil {
 			log.WithError(err).Errorf("Failed to add option %s to poll %s", opt.Name, pollID)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add option"})
@@ -238,6 +246,14 @@ func (h *Handler) CastVote(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusBadRequest, "Option does not exist for this poll.")
 			return
 		}
+		if errors.Is(err, ErrPollClosed) {
+			utils.ErrorResponse(c, http.StatusConflict, "Poll is closed.")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Poll not found.")
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cast vote"})
 		return
 	}
@@ -278,6 +294,10 @@ func (h *Handler) UncastVote(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusBadRequest, "Option does not exist for this poll.")
 			return
 		}
+		if errors.Is(err, ErrPollClosed) {
+			utils.ErrorResponse(c, http.StatusConflict, "Poll is closed.")
+			return
+		}
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.ErrorResponse(c, http.StatusNotFound, "Vote not found.")
 		} else {
@@ -289,6 +309,40 @@ func (h *Handler) UncastVote(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// ClosePoll stops the poll from taking further votes or options.
+func (h *Handler) ClosePoll(c *gin.Context) {
+	log := logger.FromContext(c)
+	pollID, err := uuid.Parse(c.Param("pollId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid poll ID"})
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in ClosePoll token")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	poll, err := h.Service.ClosePoll(pollID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Poll not found.")
+			return
+		}
+		if errors.Is(err, ErrNotPollOwner) {
+			utils.ErrorResponse(c, http.StatusForbidden, "Only the poll owner can close it.")
+			return
+		}
+		log.WithError(err).Errorf("Failed to close poll %s", pollID)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to close poll.")
+		return
+	}
+
+	c.JSON(http.StatusOK, poll)
+}
+
 func (h *Handler) GetResults(c *gin.Context) {
 	log := logger.FromContext(c)
 	pollID, err := uuid.Parse(c.Param("pollId"))
@@ -36,8 +36,10 @@ type Poll struct {
 	Role       string      `json:"role"`
 	Members    []uuid.UUID `json:"members"`
 	CreatedBy  uuid.UUID   `json:"created_by"`
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
+	// IsActive is false once the owner closes the poll to votes and options.
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type PollOption struct {
@@ -58,10 +60,21 @@ type PollVote struct {
 }
 
 type PollResult struct {
-	OptionID   uuid.UUID   `json:"option_id"`
-	OptionName string      `json:"option_name"`
-	VoteCount  int         `json:"vote_count"`
-	VoterIDs   []uuid.UUID `json:"voter_ids"`
+	OptionID     uuid.UUID   `json:"option_id"`
+	OptionName   string      `json:"option_name"`
+	RestaurantID string      `json:"restaurant_id"`
+	VoteCount    int         `json:"vote_count"`
+	VoterIDs     []uuid.UUID `json:"voter_ids"`
+	// Restaurant is set once details for the option's restaurant are stored.
+	Restaurant *RestaurantInfo `json:"restaurant,omitempty"`
+}
+
+// RestaurantInfo is the stored summary of a poll option's restaurant.
+type RestaurantInfo struct {
+	Address    string   `json:"address,omitempty"`
+	Rating     float64  `json:"rating,omitempty"`
+	PriceLevel *int     `json:"price_level,omitempty"`
+	Types      []string `json:"types,omitempty"`
 }
 
 type PollSummary struct {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/turanoo/bitebattle/pkg/config"
 	"github.com/turanoo/bitebattle/pkg/db"
 	"github.com/turanoo/bitebattle/pkg/logger"
@@ -17,6 +18,8 @@ import (
 var ErrInvalidInviteCode = errors.New("invalid invite code")
 var ErrAlreadyMember = errors.New("user is already a member or owner of this poll")
 var ErrOptionNotInPoll = errors.New("option does not exist for this poll")
+var ErrPollClosed = errors.New("poll is closed")
+var ErrNotPollOwner = errors.New("only the poll owner can do this")
 
 type Service struct {
 	DB *sql.DB
@@ -47,6 +50,7 @@ func (s *Service) CreatePoll(name string, createdBy uuid.UUID) (*Poll, error) {
 		InviteCode: inviteCode,
 		Role:       "owner", // Creator is always the owner
 		CreatedBy:  createdBy,
+		IsActive:   true,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
@@ -65,7 +69,7 @@ func (s *Service) CreatePoll(name string, createdBy uuid.UUID) (*Poll, error) {
 
 func (s *Service) GetPolls(userID uuid.UUID) ([]Poll, error) {
 	rows, err := s.DB.Query(`
-		SELECT p.id, p.name, p.invite_code, p.created_by, p.created_at, p.updated_at,
+		SELECT p.id, p.name, p.invite_code, p.created_by, COALESCE(p.is_active, TRUE), p.created_at, p.updated_at,
 			CASE 
 				WHEN p.created_by = $1 THEN 'owner'
 				WHEN EXISTS (
@@ -90,6 +94,7 @@ func (s *Service) GetPolls(userID uuid.UUID) ([]Poll, error) {
 			&poll.Name,
 			&poll.InviteCode,
 			&poll.CreatedBy,
+			&poll.IsActive,
 			&poll.CreatedAt,
 			&poll.UpdatedAt,
 			&poll.Role,
@@ -129,7 +134,7 @@ func (s *Service) GetPolls(userID uuid.UUID) ([]Poll, error) {
 
 func (s *Service) GetPoll(pollID, userId uuid.UUID) (*Poll, error) {
 	row := s.DB.QueryRow(`
-		SELECT id, name, invite_code, created_by, created_at, updated_at,
+		SELECT id, name, invite_code, created_by, COALESCE(is_active, TRUE), created_at, updated_at,
 			CASE 
 				WHEN created_by = $2 THEN 'owner'
 				WHEN EXISTS (
@@ -142,7 +147,7 @@ func (s *Service) GetPoll(pollID, userId uuid.UUID) (*Poll, error) {
 	`, pollID, userId)
 
 	var poll Poll
-	err := db.ScanOne(row, &poll.ID, &poll.Name, &poll.InviteCode, &poll.CreatedBy, &poll.CreatedAt, &poll.UpdatedAt, &poll.Role)
+	err := db.ScanOne(row, &poll.ID, &poll.Name, &poll.InviteCode, &poll.CreatedBy, &poll.IsActive, &poll.CreatedAt, &poll.UpdatedAt, &poll.Role)
 	if err != nil {
 		return nil, err
 	}
@@ -260,13 +265,13 @@ func (s *Service) UpdatePoll(pollID uuid.UUID, name string) (*Poll, error) {
 
 func (s *Service) JoinPoll(inviteCode string, userId uuid.UUID) (*Poll, error) {
 	row := s.DB.QueryRow(`
-		SELECT id, name, created_by, invite_code, created_at, updated_at
+		SELECT id, name, created_by, invite_code, COALESCE(is_active, TRUE), created_at, updated_at
 		FROM polls WHERE invite_code = $1
 	`, inviteCode)
 
 	var poll Poll
 	err := row.Scan(
-		&poll.ID, &poll.Name, &poll.CreatedBy, &poll.InviteCode, &poll.CreatedAt, &poll.UpdatedAt,
+		&poll.ID, &poll.Name, &poll.CreatedBy, &poll.InviteCode, &poll.IsActive, &poll.CreatedAt, &poll.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -301,7 +306,43 @@ func (s *Service) JoinPoll(inviteCode string, userId uuid.UUID) (*Poll, error) {
 	return &poll, nil
 }
 
+// ClosePoll stops a poll from taking further votes or options. Only its
+// owner can close it; closing a closed poll is a no-op.
+func (s *Service) ClosePoll(pollID, userID uuid.UUID) (*Poll, error) {
+	res, err := s.DB.Exec(`
+		UPDATE polls SET is_active = FALSE, updated_at = NOW() WHERE id = $1 AND created_by = $2
+	`, pollID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := s.GetPoll(pollID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 && poll.CreatedBy != userID {
+		return nil, ErrNotPollOwner
+	}
+	return poll, nil
+}
+
+// ensureOpen returns ErrPollClosed if the poll has been closed, and
+// sql.ErrNoRows if it doesn't exist.
+func (s *Service) ensureOpen(pollID uuid.UUID) error {
+	var active bool
+	if err := s.DB.QueryRow(`SELECT COALESCE(is_active, TRUE) FROM polls WHERE id = $1`, pollID).Scan(&active); err != nil {
+		return err
+	}
+	if !active {
+		return ErrPollClosed
+	}
+	return nil
+}
+
 func (s *Service) AddOption(pollID uuid.UUID, restaurantID, name, imageURL, menuURL string) (*PollOption, error) {
+	if err := s.ensureOpen(pollID); err != nil {
+		return nil, err
+	}
 	id := uuid.New()
 
 	_, err := s.DB.Exec(`
@@ -324,6 +365,9 @@ func (s *Service) AddOption(pollID uuid.UUID, restaurantID, name, imageURL, menu
 }
 
 func (s *Service) CastVote(pollID, optionID, userID uuid.UUID) (*PollVote, error) {
+	if err := s.ensureOpen(pollID); err != nil {
+		return nil, err
+	}
 	id := uuid.New()
 
 	// Check if option exists for this poll
@@ -354,6 +398,9 @@ func (s *Service) CastVote(pollID, optionID, userID uuid.UUID) (*PollVote, error
 }
 
 func (s *Service) RemoveVote(pollID, optionID, userID uuid.UUID) error {
+	if err := s.ensureOpen(pollID); err != nil {
+		return err
+	}
 	// Check if option exists for this poll
 	var exists bool
 	err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM poll_options WHERE id = $1 AND poll_id = $2)`, optionID, pollID).Scan(&exists)
@@ -385,11 +432,13 @@ func (s *Service) RemoveVote(pollID, optionID, userID uuid.UUID) error {
 
 func (s *Service) GetResults(pollID uuid.UUID) ([]PollResult, error) {
 	rows, err := s.DB.Query(`
-		SELECT o.id, o.name, COUNT(v.id) as votes
+		SELECT o.id, o.name, o.restaurant_id, COUNT(v.id) as votes,
+			r.place_id IS NOT NULL, COALESCE(r.address, ''), COALESCE(r.rating, 0), r.price_level, COALESCE(r.types, '{}')
 		FROM poll_options o
 		LEFT JOIN poll_votes v ON o.id = v.option_id
+		LEFT JOIN restaurants r ON r.place_id = o.restaurant_id
 		WHERE o.poll_id = $1
-		GROUP BY o.id
+		GROUP BY o.id, r.place_id
 		ORDER BY votes DESC
 	`, pollID)
 	if err != nil {
@@ -407,12 +456,23 @@ func (s *Service) GetResults(pollID uuid.UUID) ([]PollResult, error) {
 		var optionID uuid.UUID
 		var optionName string
 		var voteCount int
+		var hasRestaurant bool
+		var info RestaurantInfo
+		var priceLevel sql.NullInt64
 
 		voterIds := []uuid.UUID{}
 
-		if err := rows.Scan(&optionID, &optionName, &voteCount); err != nil {
+		if err := rows.Scan(&optionID, &optionName, &res.RestaurantID, &voteCount,
+			&hasRestaurant, &info.Address, &info.Rating, &priceLevel, pq.Array(&info.Types)); err != nil {
 			return nil, err
 		}
+		if hasRestaurant {
+			if priceLevel.Valid {
+				level := int(priceLevel.Int64)
+				info.PriceLevel = &level
+			}
+			res.Restaurant = &info
+		}
 
 		voterRows, err := s.DB.Query(`
 			SELECT user_id FROM poll_votes WHERE option_id = $1
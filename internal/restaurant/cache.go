@@ -0,0 +1,216 @@
+package restaurant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/turanoo/bitebattle/pkg/geo"
+	"github.com/turanoo/bitebattle/pkg/logger"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultCacheTTL        = 10 * time.Minute
+	DefaultCacheStaleTTL   = time.Hour
+	DefaultCacheMaxEntries = 1000
+
+	// cacheCoordPrecision rounds coordinates to roughly 100m cells.
+	cacheCoordPrecision = 1000
+	// cacheRadiusStep rounds radii up to the nearest 100m.
+	cacheRadiusStep = 100
+)
+
+// CachingProvider sits in front of a Provider. Identical searches and details
+// lookups share one upstream call, fresh results are served from memory for
+// TTL, and results up to StaleTTL past expiry are served if the upstream call
+// fails.
+type CachingProvider struct {
+	Provider   Provider
+	TTL        time.Duration
+	StaleTTL   time.Duration
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	group   singleflight.Group
+
+	hits           atomic.Int64
+	misses         atomic.Int64
+	staleServed    atomic.Int64
+	coalesced      atomic.Int64
+	upstreamErrors atomic.Int64
+}
+
+type cacheEntry struct {
+	value     interface{} // *SearchPage or *PlaceDetails
+	fetchedAt time.Time
+}
+
+type CacheStats struct {
+	Hits           int64 `json:"hits"`
+	Misses         int64 `json:"misses"`
+	StaleServed    int64 `json:"stale_served"`
+	Coalesced      int64 `json:"coalesced"`
+	UpstreamErrors int64 `json:"upstream_errors"`
+	Entries        int   `json:"entries"`
+}
+
+func NewCachingProvider(provider Provider, ttl, staleTTL time.Duration, maxEntries int) *CachingProvider {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if staleTTL <= 0 {
+		staleTTL = DefaultCacheStaleTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &CachingProvider{
+		Provider:   provider,
+		TTL:        ttl,
+		StaleTTL:   staleTTL,
+		MaxEntries: maxEntries,
+		entries:    make(map[string]*cacheEntry),
+	}
+}
+
+func (c *CachingProvider) Search(ctx context.Context, params SearchParams) (*SearchPage, error) {
+	params = NormalizeSearchParams(params)
+	v, err := c.fetch(ctx, searchCacheKey(params), func(ctx context.Context) (interface{}, error) {
+		return c.Provider.Search(ctx, params)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*SearchPage), nil
+}
+
+func (c *CachingProvider) Details(ctx context.Context, placeID string) (*PlaceDetails, error) {
+	v, err := c.fetch(ctx, "details|"+placeID, func(ctx context.Context) (interface{}, error) {
+		return c.Provider.Details(ctx, placeID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*PlaceDetails), nil
+}
+
+// fetch serves key from the cache while fresh and otherwise calls load once
+// for all concurrent callers, falling back to a stale entry on failure.
+func (c *CachingProvider) fetch(ctx context.Context, key string, load func(context.Context) (interface{}, error)) (interface{}, error) {
+	entry := c.lookup(key)
+	if entry != nil && time.Since(entry.fetchedAt) < c.TTL {
+		c.hits.Add(1)
+		return entry.value, nil
+	}
+	c.misses.Add(1)
+
+	leader := false
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		leader = true
+		// Waiters share this call, so one caller going away must not cancel it.
+		value, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			c.upstreamErrors.Add(1)
+			return nil, err
+		}
+		c.store(key, value)
+		return value, nil
+	})
+	if shared && !leader {
+		c.coalesced.Add(1)
+	}
+
+	if err != nil {
+		if entry != nil && !errors.Is(err, ErrPlaceNotFound) && time.Since(entry.fetchedAt) < c.TTL+c.StaleTTL {
+			c.staleServed.Add(1)
+			logger.Log.WithError(err).Warnf("Serving stale restaurant data for %q", key)
+			return entry.value, nil
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *CachingProvider) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:           c.hits.Load(),
+		Misses:         c.misses.Load(),
+		StaleServed:    c.staleServed.Load(),
+		Coalesced:      c.coalesced.Load(),
+		UpstreamErrors: c.upstreamErrors.Load(),
+		Entries:        entries,
+	}
+}
+
+func (c *CachingProvider) lookup(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *CachingProvider) store(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &cacheEntry{value: value, fetchedAt: time.Now()}
+	if len(c.entries) <= c.MaxEntries {
+		return
+	}
+
+	// Drop everything past its stale window, then the oldest entry if still full.
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range c.entries {
+		age := time.Since(e.fetchedAt)
+		if age >= c.TTL+c.StaleTTL {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.fetchedAt.Before(oldest) {
+			oldestKey, oldest = k, e.fetchedAt
+		}
+	}
+	if len(c.entries) > c.MaxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// NormalizeSearchParams canonicalizes a search so that equivalent requests
+// share a cache entry: the query is lowercased with whitespace collapsed, the
+// location is rounded to roughly 100m and the radius rounded up to 100m.
+func NormalizeSearchParams(params SearchParams) SearchParams {
+	params.Query = strings.Join(strings.Fields(strings.ToLower(params.Query)), " ")
+	params.Cuisine = strings.Join(strings.Fields(strings.ToLower(params.Cuisine)), " ")
+	params.Location = geo.Point{
+		Lat: math.Round(params.Location.Lat*cacheCoordPrecision) / cacheCoordPrecision,
+		Lng: math.Round(params.Location.Lng*cacheCoordPrecision) / cacheCoordPrecision,
+	}
+	if params.Radius > 0 {
+		params.Radius = (params.Radius + cacheRadiusStep - 1) / cacheRadiusStep * cacheRadiusStep
+	}
+	return params
+}
+
+func searchCacheKey(params SearchParams) string {
+	price := func(p *int) string {
+		if p == nil {
+			return "-"
+		}
+		return strconv.Itoa(*p)
+	}
+	return fmt.Sprintf("%s|%.3f,%.3f|%d|%g|%s-%s|%t|%s|%s",
+		params.Query, params.Location.Lat, params.Location.Lng, params.Radius,
+		params.MinRating, price(params.MinPrice), price(params.MaxPrice), params.OpenNow, params.Cuisine, params.PageToken)
+}
@@ -0,0 +1,166 @@
+package restaurant
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+const (
+	// SortBest blends rating and distance, and is the default.
+	SortBest      = "best"
+	SortDistance  = "distance"
+	SortRating    = "rating"
+	SortRelevance = "relevance" // the provider's order
+
+	// OriginModeMinMax ranks places by the longest trip any origin has to
+	// make, and is the default.
+	OriginModeMinMax = "minmax"
+	// OriginModeTotal ranks places by the sum of every origin's trip.
+	OriginModeTotal = "total"
+
+	MaxOrigins = 10
+
+	// TravelDriving, TravelCycling and TravelWalking set the speed travel
+	// times are estimated at. Driving is the default.
+	TravelDriving = "driving"
+	TravelCycling = "cycling"
+	TravelWalking = "walking"
+
+	// distanceWeight is the share of the best score that comes from distance.
+	distanceWeight = 0.5
+	// neutralRating stands in for places without a rating.
+	neutralRating = 3.0
+)
+
+// travelSpeeds are rough city speeds in meters a minute. Distances are
+// straight lines, so estimates are a lower bound on the real trip.
+var travelSpeeds = map[string]float64{
+	TravelDriving: 500,
+	TravelCycling: 250,
+	TravelWalking: 80,
+}
+
+func validSort(s string) bool {
+	switch s {
+	case "", SortBest, SortDistance, SortRating, SortRelevance:
+		return true
+	}
+	return false
+}
+
+func (p SearchParams) validateOrigins() error {
+	if len(p.Origins) > MaxOrigins {
+		return fmt.Errorf("%w: at most %d origins are supported", ErrInvalidSearch, MaxOrigins)
+	}
+	for _, o := range p.Origins {
+		if !o.Valid() {
+			return fmt.Errorf("%w: origin %s is out of range", ErrInvalidSearch, o)
+		}
+	}
+	switch p.OriginMode {
+	case "", OriginModeMinMax, OriginModeTotal:
+	default:
+		return fmt.Errorf("%w: origin_mode must be %s or %s", ErrInvalidSearch, OriginModeMinMax, OriginModeTotal)
+	}
+	if _, ok := travelSpeeds[p.TravelMode]; p.TravelMode != "" && !ok {
+		return fmt.Errorf("%w: travel_mode must be %s, %s or %s", ErrInvalidSearch, TravelDriving, TravelCycling, TravelWalking)
+	}
+	return nil
+}
+
+// addDistances annotates places with their distance from the search center
+// and from every origin, and with the travel time of the trip they are
+// ranked by.
+func (p SearchParams) addDistances(places []Place) {
+	speed, ok := travelSpeeds[p.TravelMode]
+	if !ok {
+		speed = travelSpeeds[TravelDriving]
+	}
+	for i := range places {
+		loc := places[i].Location
+		if loc == nil {
+			continue
+		}
+		d := math.Round(geo.DistanceMeters(p.Location, *loc))
+		places[i].DistanceMeters = &d
+		if len(p.Origins) > 0 {
+			places[i].OriginDistances = make([]float64, len(p.Origins))
+			for j, o := range p.Origins {
+				places[i].OriginDistances[j] = math.Round(geo.DistanceMeters(o, *loc))
+			}
+		}
+		if trip, ok := p.travelDistance(places[i]); ok {
+			minutes := math.Ceil(trip / speed)
+			places[i].TravelMinutes = &minutes
+		}
+	}
+}
+
+// travelDistance is the distance a place is ranked by: the distance from the
+// search center, or from the origins aggregated by OriginMode. Totals are
+// averaged so that they stay comparable to the search radius.
+func (p SearchParams) travelDistance(place Place) (float64, bool) {
+	if len(p.Origins) == 0 {
+		if place.DistanceMeters == nil {
+			return 0, false
+		}
+		return *place.DistanceMeters, true
+	}
+	if len(place.OriginDistances) == 0 {
+		return 0, false
+	}
+
+	var d float64
+	for _, od := range place.OriginDistances {
+		if p.OriginMode == OriginModeTotal {
+			d += od
+		} else {
+			d = math.Max(d, od)
+		}
+	}
+	if p.OriginMode == OriginModeTotal {
+		d /= float64(len(place.OriginDistances))
+	}
+	return d, true
+}
+
+// score blends rating and distance into [0, 1]. Distance counts for half at
+// the search radius and falls off smoothly beyond it.
+func (p SearchParams) score(place Place) float64 {
+	rating := place.Rating
+	if rating == 0 {
+		rating = neutralRating
+	}
+	closeness := 0.0
+	if d, ok := p.travelDistance(place); ok {
+		closeness = 1 / (1 + d/float64(max(p.Radius, 1)))
+	}
+	return (1-distanceWeight)*rating/5 + distanceWeight*closeness
+}
+
+// sortPlaces orders places by p.Sort. Places without coordinates go last
+// when sorting by distance.
+func (p SearchParams) sortPlaces(places []Place) {
+	var less func(a, b Place) bool
+	switch p.Sort {
+	case SortRelevance:
+		return
+	case SortRating:
+		less = func(a, b Place) bool { return a.Rating > b.Rating }
+	case SortDistance:
+		less = func(a, b Place) bool {
+			da, okA := p.travelDistance(a)
+			db, okB := p.travelDistance(b)
+			if okA != okB {
+				return okA
+			}
+			return da < db
+		}
+	default:
+		less = func(a, b Place) bool { return p.score(a) > p.score(b) }
+	}
+	sort.SliceStable(places, func(i, j int) bool { return less(places[i], places[j]) })
+}
@@ -0,0 +1,380 @@
+package restaurant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+// fixtureStopWords are ignored when matching a text query against fixtures,
+// so that "sushi restaurants" matches the same places as "sushi".
+var fixtureStopWords = map[string]bool{
+	"restaurant": true, "restaurants": true, "food": true, "place": true, "places": true,
+	"near": true, "in": true, "at": true, "the": true, "a": true, "and": true, "best": true,
+}
+
+// fixturePhotoWidth is the size placeholder photos are rendered at.
+const fixturePhotoWidth = 800
+
+// fixturePageSize matches the page size of the Places API.
+const fixturePageSize = 20
+
+// fixtureWeekdays are the keys of a fixture's opening hours, Monday first to
+// match the order of PlaceDetails.Hours.
+var fixtureWeekdays = []struct {
+	key  string
+	day  time.Weekday
+	name string
+}{
+	{"mon", time.Monday, "Monday"},
+	{"tue", time.Tuesday, "Tuesday"},
+	{"wed", time.Wednesday, "Wednesday"},
+	{"thu", time.Thursday, "Thursday"},
+	{"fri", time.Friday, "Friday"},
+	{"sat", time.Saturday, "Saturday"},
+	{"sun", time.Sunday, "Sunday"},
+}
+
+// FixtureProvider serves restaurants from a local JSON or GeoJSON file so the
+// app can run without network access. The file is loaded on first use.
+type FixtureProvider struct {
+	Path string
+	// Now is used to work out whether a place is open; defaults to time.Now.
+	Now func() time.Time
+
+	once   sync.Once
+	places []fixturePlace
+	err    error
+}
+
+type fixturePlace struct {
+	Place
+	record fixtureRecord
+}
+
+// fixtureRecord is one restaurant in the dataset. GeoJSON features carry it
+// as their properties; plain JSON arrays carry lat/lng inline.
+type fixtureRecord struct {
+	PlaceID        string   `json:"place_id"`
+	Name           string   `json:"name"`
+	Address        string   `json:"address"`
+	Rating         float64  `json:"rating"`
+	Types          []string `json:"types"`
+	PhotoReference string   `json:"photo_reference"`
+	Lat            float64  `json:"lat"`
+	Lng            float64  `json:"lng"`
+
+	UserRatingsTotal int    `json:"user_ratings_total"`
+	PriceLevel       *int   `json:"price_level"`
+	Phone            string `json:"phone"`
+	Website          string `json:"website"`
+	// Hours maps mon..sun to "HH:MM-HH:MM"; null or missing means closed.
+	Hours         map[string]*string `json:"hours"`
+	ReviewSummary string             `json:"review_summary"`
+}
+
+type fixtureCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Geometry struct {
+			Type        string    `json:"type"`
+			Coordinates []float64 `json:"coordinates"` // [lng, lat]
+		} `json:"geometry"`
+		Properties fixtureRecord `json:"properties"`
+	} `json:"features"`
+}
+
+func NewFixtureProvider(path string) *FixtureProvider {
+	return &FixtureProvider{Path: path}
+}
+
+// Search returns fixtures matching every meaningful query term within the
+// radius, best rated first.
+func (f *FixtureProvider) Search(ctx context.Context, params SearchParams) (*SearchPage, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if params.PageToken != "" {
+		n, err := strconv.Atoi(params.PageToken)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidCursor
+		}
+		offset = n
+	}
+
+	now := f.now()
+	terms := fixtureTerms(params.Query + " " + params.Cuisine)
+	places := []Place{}
+	for _, fp := range f.places {
+		if params.Radius > 0 && geo.DistanceMeters(params.Location, *fp.Location) > float64(params.Radius) {
+			continue
+		}
+		if !fp.matches(terms) {
+			continue
+		}
+		place := fp.placeAt(now)
+		if !params.Matches(place) {
+			continue
+		}
+		places = append(places, place)
+	}
+
+	sort.SliceStable(places, func(i, j int) bool {
+		return places[i].Rating > places[j].Rating
+	})
+
+	page := &SearchPage{Places: []Place{}}
+	if offset < len(places) {
+		end := min(offset+fixturePageSize, len(places))
+		page.Places = places[offset:end]
+		if end < len(places) {
+			page.NextPageToken = strconv.Itoa(end)
+		}
+	}
+	return page, nil
+}
+
+// Details returns the full fixture record for placeID.
+func (f *FixtureProvider) Details(ctx context.Context, placeID string) (*PlaceDetails, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	for _, fp := range f.places {
+		if fp.PlaceID == placeID {
+			return fp.details(f.now()), nil
+		}
+	}
+	return nil, ErrPlaceNotFound
+}
+
+// Photo renders a placeholder image for a fixture's photo reference, tinted
+// by the reference so different places get different colors.
+func (f *FixtureProvider) Photo(ctx context.Context, ref string, maxWidth int) (*PhotoData, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	for _, fp := range f.places {
+		if fp.record.PhotoReference != ref {
+			continue
+		}
+		width := min(max(maxWidth, 1), fixturePhotoWidth)
+		data, err := fixturePlaceholder(ref, width, width*3/4)
+		if err != nil {
+			return nil, err
+		}
+		return &PhotoData{Data: data, ContentType: "image/png"}, nil
+	}
+	return nil, ErrPhotoNotFound
+}
+
+func fixturePlaceholder(ref string, width, height int) ([]byte, error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ref))
+	sum := h.Sum32()
+	base := color.RGBA{R: uint8(sum), G: uint8(sum >> 8), B: uint8(sum >> 16), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, max(height, 1)))
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		// Darken towards the bottom so the placeholder isn't a flat block.
+		shade := 255 - y*96/max(height, 1)
+		c := color.RGBA{
+			R: uint8(int(base.R) * shade / 255),
+			G: uint8(int(base.G) * shade / 255),
+			B: uint8(int(base.B) * shade / 255),
+			A: 255,
+		}
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *FixtureProvider) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+func (f *FixtureProvider) load() error {
+	f.once.Do(func() {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			f.err = fmt.Errorf("failed to read restaurant fixtures: %w", err)
+			return
+		}
+		f.places, f.err = parseFixtures(data)
+	})
+	return f.err
+}
+
+func parseFixtures(data []byte) ([]fixturePlace, error) {
+	var records []fixtureRecord
+
+	var collection fixtureCollection
+	if err := json.Unmarshal(data, &collection); err == nil && collection.Type == "FeatureCollection" {
+		for _, feature := range collection.Features {
+			rec := feature.Properties
+			if feature.Geometry.Type != "Point" || len(feature.Geometry.Coordinates) < 2 {
+				return nil, fmt.Errorf("fixture %q: geometry must be a Point", rec.PlaceID)
+			}
+			rec.Lng = feature.Geometry.Coordinates[0]
+			rec.Lat = feature.Geometry.Coordinates[1]
+			records = append(records, rec)
+		}
+	} else if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse restaurant fixtures: %w", err)
+	}
+
+	places := make([]fixturePlace, 0, len(records))
+	for _, rec := range records {
+		loc := geo.Point{Lat: rec.Lat, Lng: rec.Lng}
+		if rec.PlaceID == "" || rec.Name == "" || !loc.Valid() {
+			return nil, fmt.Errorf("fixture %q: place_id, name and valid coordinates are required", rec.PlaceID)
+		}
+		fp := fixturePlace{
+			Place: Place{
+				Name:       rec.Name,
+				Address:    rec.Address,
+				PlaceID:    rec.PlaceID,
+				Rating:     rec.Rating,
+				PriceLevel: rec.PriceLevel,
+				Types:      rec.Types,
+				Location:   &loc,
+			},
+			record: rec,
+		}
+		if rec.PhotoReference != "" {
+			fp.Photos = withPhotoURLs([]Photo{{PhotoReference: rec.PhotoReference}})
+		}
+		places = append(places, fp)
+	}
+	return places, nil
+}
+
+func fixtureTerms(query string) []string {
+	terms := []string{}
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		term = strings.Trim(term, ".,!?'\"")
+		if term == "" || fixtureStopWords[term] {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+func (fp fixturePlace) matches(terms []string) bool {
+	haystack := strings.ToLower(fp.Name + " " + strings.Join(fp.Types, " "))
+	for _, term := range terms {
+		if !strings.Contains(haystack, term) && !strings.Contains(haystack, strings.TrimSuffix(term, "s")) {
+			return false
+		}
+	}
+	return true
+}
+
+// placeAt returns the place with its opening state at now.
+func (fp fixturePlace) placeAt(now time.Time) Place {
+	place := fp.Place
+	if fp.record.Hours != nil {
+		open := fixtureOpenAt(fp.record.Hours, now)
+		place.OpenNow = &open
+	}
+	return place
+}
+
+func (fp fixturePlace) details(now time.Time) *PlaceDetails {
+	rec := fp.record
+	details := &PlaceDetails{
+		Place:            fp.placeAt(now),
+		UserRatingsTotal: rec.UserRatingsTotal,
+		Phone:            rec.Phone,
+		Website:          rec.Website,
+		ReviewSummary:    rec.ReviewSummary,
+		UpdatedAt:        now,
+	}
+	if rec.Hours == nil {
+		return details
+	}
+
+	for _, wd := range fixtureWeekdays {
+		if span := rec.Hours[wd.key]; span != nil {
+			details.Hours = append(details.Hours, wd.name+": "+*span)
+		} else {
+			details.Hours = append(details.Hours, wd.name+": Closed")
+		}
+	}
+	return details
+}
+
+// fixtureOpenAt reports whether hours cover t. A span closing before it opens
+// runs past midnight, so the previous day's span is checked as well.
+func fixtureOpenAt(hours map[string]*string, t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	for _, wd := range fixtureWeekdays {
+		span := hours[wd.key]
+		if span == nil {
+			continue
+		}
+		open, close, ok := parseFixtureSpan(*span)
+		if !ok {
+			continue
+		}
+		switch {
+		case wd.day == t.Weekday() && open <= close:
+			if minute >= open && minute < close {
+				return true
+			}
+		case wd.day == t.Weekday():
+			if minute >= open {
+				return true
+			}
+		case wd.day == (t.Weekday()+6)%7 && close < open:
+			if minute < close {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseFixtureSpan parses "HH:MM-HH:MM" into minutes since midnight.
+func parseFixtureSpan(span string) (open, close int, ok bool) {
+	from, to, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	openAt, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, false
+	}
+	closeAt, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, false
+	}
+	return openAt.Hour()*60 + openAt.Minute(), closeAt.Hour()*60 + closeAt.Minute(), true
+}
@@ -1,42 +1,318 @@
 package restaurant
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/turanoo/bitebattle/pkg/geo"
+	"github.com/turanoo/bitebattle/pkg/httpclient"
 	"github.com/turanoo/bitebattle/pkg/logger"
 )
 
-func (s *Service) fetchFromGooglePlaces(query string, location string, radius string) ([]Place, error) {
+// googleDetailsFields limits details responses to what PlaceDetails uses,
+// which also keeps the request in the cheaper billing tiers.
+const googleDetailsFields = "place_id,name,formatted_address,geometry/location,rating,user_ratings_total," +
+	"price_level,formatted_phone_number,website,types,opening_hours,editorial_summary,reviews,photos"
 
-	params := url.Values{}
-	params.Add("query", query)
-	params.Add("location", location) // format: "lat,lng"
-	params.Add("type", "restaurant")
-	params.Add("radius", radius) // in meters
-	params.Add("key", s.APIKey)
+// maxPhotoBytes caps how much of an upstream photo is read.
+const maxPhotoBytes = 10 << 20
 
-	fullURL := fmt.Sprintf("%s?%s", s.Endpoint, params.Encode())
-	resp, err := http.Get(fullURL)
+// maxReviewSummary caps how much of a review is used as a summary.
+const maxReviewSummary = 280
+
+// GooglePlaces searches restaurants through the Google Places text search API
+// and looks them up through the place details API.
+type GooglePlaces struct {
+	Endpoint        string
+	DetailsEndpoint string
+	PhotoEndpoint   string
+	APIKey          string
+	Client          *http.Client
+}
+
+func NewGooglePlaces(endpoint, apiKey string) *GooglePlaces {
+	return &GooglePlaces{
+		Endpoint:        endpoint,
+		DetailsEndpoint: strings.Replace(endpoint, "/textsearch/", "/details/", 1),
+		PhotoEndpoint:   strings.Replace(endpoint, "/textsearch/json", "/photo", 1),
+		APIKey:          apiKey,
+		Client:          httpclient.New(httpclient.Options{}),
+	}
+}
+
+type googleSearchResponse struct {
+	Results       []googlePlace `json:"results"`
+	NextPageToken string        `json:"next_page_token"`
+	Status        string        `json:"status"`
+	ErrorMessage  string        `json:"error_message"`
+}
+
+type googleDetailsResponse struct {
+	Result       googlePlace `json:"result"`
+	Status       string      `json:"status"`
+	ErrorMessage string      `json:"error_message"`
+}
+
+type googlePlace struct {
+	Name             string   `json:"name"`
+	FormattedAddress string   `json:"formatted_address"`
+	Vicinity         string   `json:"vicinity"`
+	PlaceID          string   `json:"place_id"`
+	Rating           float64  `json:"rating"`
+	PriceLevel       *int     `json:"price_level"`
+	Types            []string `json:"types"`
+	Photos           []Photo  `json:"photos"`
+	OpeningHours     *struct {
+		OpenNow     *bool    `json:"open_now"`
+		WeekdayText []string `json:"weekday_text"` // details only
+	} `json:"opening_hours"`
+
+	// Details-only fields.
+	Geometry struct {
+		Location *struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"location"`
+	} `json:"geometry"`
+	UserRatingsTotal     int    `json:"user_ratings_total"`
+	FormattedPhoneNumber string `json:"formatted_phone_number"`
+	Website              string `json:"website"`
+	EditorialSummary     struct {
+		Overview string `json:"overview"`
+	} `json:"editorial_summary"`
+	Reviews []struct {
+		Text string `json:"text"`
+	} `json:"reviews"`
+}
+
+func (g *GooglePlaces) Search(ctx context.Context, params SearchParams) (*SearchPage, error) {
+	query := url.Values{}
+	if params.PageToken != "" {
+		// The page token carries the original search; other parameters are ignored.
+		query.Add("pagetoken", params.PageToken)
+	} else {
+		text := params.Query
+		if params.Cuisine != "" {
+			text = params.Cuisine + " " + text
+		}
+		query.Add("query", text)
+		query.Add("location", params.Location.String())
+		query.Add("type", "restaurant")
+		query.Add("radius", strconv.Itoa(params.Radius)) // in meters
+		if params.MinPrice != nil {
+			query.Add("minprice", strconv.Itoa(*params.MinPrice))
+		}
+		if params.MaxPrice != nil {
+			query.Add("maxprice", strconv.Itoa(*params.MaxPrice))
+		}
+		if params.OpenNow {
+			query.Add("opennow", "true")
+		}
+	}
+
+	var result googleSearchResponse
+	if err := g.getJSON(ctx, g.Endpoint, query, &result); err != nil {
+		return nil, err
+	}
+	// ZERO_RESULTS is an empty page, not an error.
+	if err := googleStatusError(result.Status, result.ErrorMessage); err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Places: make([]Place, 0, len(result.Results)), NextPageToken: result.NextPageToken}
+	for _, r := range result.Results {
+		page.Places = append(page.Places, r.toPlace())
+	}
+	return page, nil
+}
+
+func (g *GooglePlaces) Details(ctx context.Context, placeID string) (*PlaceDetails, error) {
+	query := url.Values{}
+	query.Add("place_id", placeID)
+	query.Add("fields", googleDetailsFields)
+
+	var result googleDetailsResponse
+	if err := g.getJSON(ctx, g.DetailsEndpoint, query, &result); err != nil {
+		return nil, err
+	}
+
+	switch result.Status {
+	case "OK":
+		return result.Result.toDetails(), nil
+	case "ZERO_RESULTS", "INVALID_REQUEST":
+		// Unknown or malformed place IDs.
+		return nil, ErrPlaceNotFound
+	default:
+		return nil, googleStatusError(result.Status, result.ErrorMessage)
+	}
+}
+
+func (g *GooglePlaces) Photo(ctx context.Context, ref string, maxWidth int) (*PhotoData, error) {
+	query := url.Values{}
+	query.Add("photo_reference", ref)
+	query.Add("maxwidth", strconv.Itoa(maxWidth))
+
+	// The photo API redirects to the image itself, which the client follows.
+	resp, err := g.get(ctx, g.PhotoEndpoint, query)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound:
+		return nil, ErrPhotoNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("google places photo API error: %s", resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("google places photo API returned %q", contentType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read photo: %w", err)
+	}
+	return &PhotoData{Data: data, ContentType: contentType}, nil
+}
+
+// get calls a Places endpoint with our API key. Failures to reach the API and
+// rate-limit or server error statuses come back as provider errors; other
+// statuses are left to the caller.
+func (g *GooglePlaces) get(ctx context.Context, endpoint string, query url.Values) (*http.Response, error) {
+	query.Set("key", g.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call Google Places API: %w", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Unwrap the url.Error, whose message would include the API key.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("%w: failed to call Google Places API: %v", ErrProviderUnavailable, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		closeBody(resp)
+		return nil, ErrRateLimited
+	case resp.StatusCode >= 500:
+		closeBody(resp)
+		return nil, fmt.Errorf("%w: google places API returned %s", ErrProviderUnavailable, resp.Status)
+	}
+	return resp, nil
+}
+
+// getJSON calls a Places JSON endpoint and decodes its response into v.
+func (g *GooglePlaces) getJSON(ctx context.Context, endpoint string, query url.Values, v interface{}) error {
+	resp, err := g.get(ctx, endpoint, query)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("google places API error: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			logger.Log.WithError(err).Error("failed to close response body")
+	return nil
+}
+
+// googleStatusError maps the status field of a Places response to an error.
+// OK and ZERO_RESULTS are not errors.
+func googleStatusError(status, message string) error {
+	switch status {
+	case "OK", "ZERO_RESULTS":
+		return nil
+	case "NOT_FOUND":
+		return ErrPlaceNotFound
+	case "OVER_QUERY_LIMIT":
+		return ErrRateLimited
+	case "UNKNOWN_ERROR":
+		return fmt.Errorf("%w: google places API error: %s", ErrProviderUnavailable, status)
+	default:
+		if message != "" {
+			return fmt.Errorf("google places API error: %s: %s", status, message)
 		}
-	}()
+		return fmt.Errorf("google places API error: %s", status)
+	}
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		logger.Log.WithError(err).Error("failed to close response body")
+	}
+}
 
-	var result GooglePlacesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+func (r googlePlace) toPlace() Place {
+	address := r.FormattedAddress
+	if address == "" {
+		address = r.Vicinity
 	}
+	place := Place{
+		Name:       r.Name,
+		Address:    address,
+		PlaceID:    r.PlaceID,
+		Rating:     r.Rating,
+		PriceLevel: r.PriceLevel,
+		Types:      r.Types,
+		Photos:     withPhotoURLs(r.Photos),
+	}
+	if r.OpeningHours != nil {
+		place.OpenNow = r.OpeningHours.OpenNow
+	}
+	if loc := r.Geometry.Location; loc != nil {
+		place.Location = &geo.Point{Lat: loc.Lat, Lng: loc.Lng}
+	}
+	return place
+}
 
-	if result.Status != "OK" {
-		return nil, fmt.Errorf("google places API error: %s", result.Status)
+func (r googlePlace) toDetails() *PlaceDetails {
+	details := &PlaceDetails{
+		Place:            r.toPlace(),
+		UserRatingsTotal: r.UserRatingsTotal,
+		Phone:            r.FormattedPhoneNumber,
+		Website:          r.Website,
+		ReviewSummary:    r.EditorialSummary.Overview,
+		UpdatedAt:        time.Now(),
+	}
+	if r.OpeningHours != nil {
+		details.Hours = r.OpeningHours.WeekdayText
 	}
+	if details.ReviewSummary == "" && len(r.Reviews) > 0 {
+		details.ReviewSummary = truncateText(r.Reviews[0].Text, maxReviewSummary)
+	}
+	return details
+}
 
-	return result.Results, nil
+// truncateText shortens s to at most max runes, cutting at a word boundary.
+func truncateText(s string, max int) string {
+	s = strings.TrimSpace(s)
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
 }
@@ -1,9 +1,16 @@
 package restaurant
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/turanoo/bitebattle/internal/auth"
+	"github.com/turanoo/bitebattle/internal/geocode"
+	"github.com/turanoo/bitebattle/pkg/geo"
 	"github.com/turanoo/bitebattle/pkg/logger"
 	"github.com/turanoo/bitebattle/pkg/utils"
 )
@@ -18,22 +25,200 @@ func NewHandler(service *Service) *Handler {
 
 func (h *Handler) SearchRestaurants(c *gin.Context) {
 	log := logger.FromContext(c)
-	query := c.Query("q")
-	if query == "" {
-		log.Warn("query parameter 'q' is required in SearchRestaurants")
-		utils.ErrorResponse(c, http.StatusBadRequest, "query parameter 'q' is required")
+
+	var params SearchParams
+	var resolved *geocode.Result
+	var err error
+	if cursor := c.Query("cursor"); cursor != "" {
+		params, err = DecodeCursor(cursor)
+	} else {
+		params, err = parseSearchParams(c)
+		if err == nil {
+			resolved, err = h.resolveSearchCenter(c, params.Origins)
+		}
+		if resolved != nil {
+			params.Location = resolved.Location
+		}
+	}
+	if err != nil {
+		log.WithError(err).Warn("Invalid restaurant search")
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.Service.Search(c.Request.Context(), params)
+	if errors.Is(err, ErrInvalidSearch) || errors.Is(err, ErrInvalidCursor) {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeProviderError(c, err, http.StatusInternalServerError, "failed to fetch restaurants")
 		return
 	}
+	resp.Location = resolved
+	if userID, err := auth.UserIDFromContext(c); err == nil {
+		h.Service.AddTeamRatings(c.Request.Context(), userID, resp.Results)
+	}
+
+	log.Infof("Restaurants search: query=%s, location=%s, found=%d", params.Query, params.Location, len(resp.Results))
+	c.JSON(http.StatusOK, resp)
+}
+
+// resolveSearchCenter resolves the location or near parameters. A group
+// search without either is centered between its origins.
+func (h *Handler) resolveSearchCenter(c *gin.Context, origins []geo.Point) (*geocode.Result, error) {
+	location, near := c.Query("location"), c.Query("near")
+	if location == "" && near == "" && len(origins) > 0 {
+		center := geo.Centroid(origins)
+		return &geocode.Result{Location: center, Name: center.String(), Kind: geocode.KindCoordinates}, nil
+	}
+	return h.Service.ResolveLocation(c.Request.Context(), location, near)
+}
+
+// parseSearchParams reads a new search from the query string. The location
+// is resolved separately from the location or near parameters.
+func parseSearchParams(c *gin.Context) (SearchParams, error) {
+	params := SearchParams{
+		Query:      c.Query("q"),
+		Radius:     DefaultSearchRadius,
+		Cuisine:    strings.TrimSpace(c.Query("cuisine")),
+		Sort:       c.Query("sort"),
+		OriginMode: c.Query("origin_mode"),
+		TravelMode: c.Query("travel_mode"),
+	}
+	if params.Query == "" {
+		return params, fmt.Errorf("%w: query parameter 'q' is required", ErrInvalidSearch)
+	}
 
-	location := c.DefaultQuery("location", "37.7749,-122.4194") // Default: SF
+	var err error
+	if v := c.Query("radius"); v != "" {
+		if params.Radius, err = strconv.Atoi(v); err != nil {
+			return params, fmt.Errorf("%w: radius must be an integer", ErrInvalidSearch)
+		}
+	}
+	if v := c.Query("min_rating"); v != "" {
+		if params.MinRating, err = strconv.ParseFloat(v, 64); err != nil {
+			return params, fmt.Errorf("%w: min_rating must be a number", ErrInvalidSearch)
+		}
+	}
+	if params.MinPrice, err = queryInt(c, "min_price"); err != nil {
+		return params, err
+	}
+	if params.MaxPrice, err = queryInt(c, "max_price"); err != nil {
+		return params, err
+	}
+	if v := c.Query("open_now"); v != "" {
+		if params.OpenNow, err = strconv.ParseBool(v); err != nil {
+			return params, fmt.Errorf("%w: open_now must be true or false", ErrInvalidSearch)
+		}
+	}
+	// Origins are separated by pipes, as in the Distance Matrix API.
+	if v := c.Query("origins"); v != "" {
+		for _, origin := range strings.Split(v, "|") {
+			point, err := geo.ParseLatLng(origin)
+			if err != nil {
+				return params, fmt.Errorf("%w: origins: %v", ErrInvalidSearch, err)
+			}
+			params.Origins = append(params.Origins, point)
+		}
+	}
+	return params, nil
+}
 
-	places, err := h.Service.SearchRestaurants(query, location, "10000")
+func queryInt(c *gin.Context, name string) (*int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
 	if err != nil {
-		log.WithError(err).Error("Failed to fetch restaurants")
-		utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch restaurants")
+		return nil, fmt.Errorf("%w: %s must be an integer", ErrInvalidSearch, name)
+	}
+	return &n, nil
+}
+
+func (h *Handler) GetDetails(c *gin.Context) {
+	placeID := c.Param("placeId")
+
+	cached, err := h.Service.GetDetails(c.Request.Context(), placeID)
+	if errors.Is(err, ErrPlaceNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, "restaurant not found")
+		return
+	}
+	if err != nil {
+		writeProviderError(c, err, http.StatusInternalServerError, "failed to fetch restaurant details")
+		return
+	}
+
+	// Details may be shared through the cache, so annotate a copy.
+	details := *cached
+	if userID, err := auth.UserIDFromContext(c); err == nil {
+		places := []Place{details.Place}
+		h.Service.AddTeamRatings(c.Request.Context(), userID, places)
+		details.Place = places[0]
+	}
+	c.JSON(http.StatusOK, details)
+}
+
+// GetPhoto proxies a provider photo, resized to fit the optional w and h
+// query parameters.
+func (h *Handler) GetPhoto(c *gin.Context) {
+	ref := c.Param("ref")
+
+	width, height := DefaultPhotoWidth, 0
+	var err error
+	if v := c.Query("w"); v != "" {
+		width, err = strconv.Atoi(v)
+	}
+	if v := c.Query("h"); err == nil && v != "" {
+		height, err = strconv.Atoi(v)
+		if c.Query("w") == "" {
+			width = 0
+		}
+	}
+	if err != nil || width < 0 || height < 0 || width > MaxPhotoSize || height > MaxPhotoSize || width+height == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("w and h must be between 1 and %d", MaxPhotoSize))
 		return
 	}
 
-	log.Infof("Restaurants search: query=%s, location=%s, found=%d", query, location, len(places))
-	c.JSON(http.StatusOK, places)
+	photo, err := h.Service.Photo(c.Request.Context(), ref, width, height)
+	if errors.Is(err, ErrPhotoNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, "photo not found")
+		return
+	}
+	if err != nil {
+		writeProviderError(c, err, http.StatusBadGateway, "failed to fetch photo")
+		return
+	}
+
+	// A reference always points at the same image, so it may be cached for
+	// a day, by shared caches too; each cached copy saves a provider call.
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("ETag", photo.ETag)
+	if c.GetHeader("If-None-Match") == photo.ETag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, photo.ContentType, photo.Data)
+}
+
+// writeProviderError reports a failed provider call: 429 when we are over the
+// provider's quota, 503 when it is unavailable, and status otherwise.
+func writeProviderError(c *gin.Context, err error, status int, message string) {
+	log := logger.FromContext(c).WithError(err)
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		log.Warn("Restaurant provider rate limited")
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "restaurant provider is busy, try again shortly")
+	case errors.Is(err, ErrProviderUnavailable):
+		log.Warn("Restaurant provider unavailable")
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "restaurant provider is unavailable, try again later")
+	default:
+		log.Error(message)
+		utils.ErrorResponse(c, status, message)
+	}
+}
+
+func (h *Handler) GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Service.CacheStats())
 }
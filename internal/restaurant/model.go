@@ -1,18 +1,64 @@
 package restaurant
 
-type GooglePlacesResponse struct {
-	Results []Place `json:"results"`
-	Status  string  `json:"status"`
-}
+import (
+	"time"
+
+	"github.com/turanoo/bitebattle/internal/geocode"
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
 
 type Place struct {
-	Name    string  `json:"name"`
-	Address string  `json:"address"`
-	PlaceID string  `json:"place_id"`
-	Rating  float64 `json:"rating,omitempty"`
-	Photos  []Photo `json:"photos,omitempty"`
+	Name       string     `json:"name"`
+	Address    string     `json:"address"`
+	PlaceID    string     `json:"place_id"`
+	Rating     float64    `json:"rating,omitempty"`
+	PriceLevel *int       `json:"price_level,omitempty"` // 0 (free) to 4 (very expensive)
+	OpenNow    *bool      `json:"open_now,omitempty"`    // nil when unknown
+	Types      []string   `json:"types,omitempty"`
+	Photos     []Photo    `json:"photos,omitempty"`
+	Location   *geo.Point `json:"location,omitempty"`
+	// DistanceMeters is the distance from the search center.
+	DistanceMeters *float64 `json:"distance_meters,omitempty"`
+	// OriginDistances are the distances from each origin of a multi-origin
+	// search, in the order the origins were given.
+	OriginDistances []float64 `json:"origin_distances_meters,omitempty"`
+	// TravelMinutes estimates the trip the place is ranked by at the speed
+	// of the search's travel mode.
+	TravelMinutes *float64 `json:"travel_minutes,omitempty"`
+	// TeamRating is how the caller's team rated their visits, when known.
+	TeamRating *TeamRating `json:"team_rating,omitempty"`
+}
+
+// TeamRating aggregates the visit ratings of a user and everyone they share
+// polls or matches with.
+type TeamRating struct {
+	Average     float64    `json:"average"` // 1-5, zero if no visit was rated
+	Ratings     int        `json:"ratings"`
+	Visits      int        `json:"visits"`
+	LastVisited *time.Time `json:"last_visited,omitempty"`
 }
 
 type Photo struct {
 	PhotoReference string `json:"photo_reference"`
+	URL            string `json:"url,omitempty"` // photo proxy path
+}
+
+// PlaceDetails is the full record for a single restaurant.
+type PlaceDetails struct {
+	Place
+	UserRatingsTotal int       `json:"user_ratings_total,omitempty"`
+	Phone            string    `json:"phone,omitempty"`
+	Website          string    `json:"website,omitempty"`
+	Hours            []string  `json:"hours,omitempty"` // one line per weekday, Monday first
+	ReviewSummary    string    `json:"review_summary,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// SearchResponse is one page of search results. NextCursor is empty on the
+// last page.
+type SearchResponse struct {
+	Results    []Place `json:"results"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	// Location is the resolved search center, set on the first page.
+	Location *geocode.Result `json:"location,omitempty"`
 }
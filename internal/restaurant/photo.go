@@ -0,0 +1,108 @@
+package restaurant
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+const (
+	DefaultPhotoWidth = 400
+	// MaxPhotoSize is the largest width or height served, matching the
+	// Places photo API limit.
+	MaxPhotoSize = 1600
+
+	DefaultPhotoCacheBytes = 64 << 20
+)
+
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// PhotoData is an encoded image.
+type PhotoData struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+}
+
+// PhotoURL is the path of the photo proxy for ref, which fetches the photo
+// with our API key so the key never reaches clients.
+func PhotoURL(ref string) string {
+	return fmt.Sprintf("/v1/restaurants/photos/%s?w=%d", url.PathEscape(ref), DefaultPhotoWidth)
+}
+
+// withPhotoURLs fills in the proxy URL of each photo.
+func withPhotoURLs(photos []Photo) []Photo {
+	for i := range photos {
+		photos[i].URL = PhotoURL(photos[i].PhotoReference)
+	}
+	return photos
+}
+
+func photoETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// PhotoCache keeps resized photos in memory up to MaxBytes, evicting the least
+// recently used first.
+type PhotoCache struct {
+	MaxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type photoCacheEntry struct {
+	key   string
+	photo *PhotoData
+}
+
+func NewPhotoCache(maxBytes int64) *PhotoCache {
+	if maxBytes <= 0 {
+		maxBytes = DefaultPhotoCacheBytes
+	}
+	return &PhotoCache{MaxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *PhotoCache) Get(key string) *PhotoData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*photoCacheEntry).photo
+}
+
+func (c *PhotoCache) Add(key string, photo *PhotoData) {
+	size := int64(len(photo.Data))
+	if size > c.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.size -= int64(len(el.Value.(*photoCacheEntry).photo.Data))
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&photoCacheEntry{key: key, photo: photo})
+	c.size += size
+
+	for c.size > c.MaxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*photoCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.photo.Data))
+	}
+}
@@ -0,0 +1,96 @@
+package restaurant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/geo"
+	"github.com/turanoo/bitebattle/pkg/httpclient"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+const (
+	ProviderGoogle  = "google"
+	ProviderFixture = "fixture"
+)
+
+// ErrPlaceNotFound is returned when a provider has no place with the given ID.
+var ErrPlaceNotFound = errors.New("place not found")
+
+// ErrRateLimited is returned when the provider rejects calls over quota.
+var ErrRateLimited = errors.New("restaurant provider rate limited")
+
+// ErrProviderUnavailable is returned when the provider is down, timing out or
+// failing repeatedly.
+var ErrProviderUnavailable = errors.New("restaurant provider unavailable")
+
+// SearchParams describes a text search around a location. Providers apply the
+// filters they support natively; the rest are applied by Service.Search.
+type SearchParams struct {
+	Query     string    `json:"q"`
+	Location  geo.Point `json:"loc"`
+	Radius    int       `json:"r"` // meters
+	MinRating float64   `json:"mr,omitempty"`
+	MinPrice  *int      `json:"minp,omitempty"` // price levels 0-4
+	MaxPrice  *int      `json:"maxp,omitempty"`
+	OpenNow   bool      `json:"open,omitempty"`
+	Cuisine   string    `json:"c,omitempty"`
+	// Sort orders results on each page, not across pages, since the
+	// provider pages its results; see SortBest and friends.
+	Sort string `json:"s,omitempty"`
+	// Origins are the starting points of a group; results are ranked by
+	// their distance from all of them, aggregated by OriginMode.
+	Origins    []geo.Point `json:"o,omitempty"`
+	OriginMode string      `json:"om,omitempty"`
+	// TravelMode sets the speed travel times are estimated at.
+	TravelMode string `json:"tm,omitempty"`
+	// PageToken continues a previous search from the provider's next page.
+	PageToken string `json:"pt,omitempty"`
+}
+
+// SearchPage is one page of provider results.
+type SearchPage struct {
+	Places        []Place
+	NextPageToken string
+}
+
+// Provider is a source of restaurant data.
+type Provider interface {
+	Search(ctx context.Context, params SearchParams) (*SearchPage, error)
+	Details(ctx context.Context, placeID string) (*PlaceDetails, error)
+	// Photo fetches the image behind a photo reference, at most maxWidth wide.
+	Photo(ctx context.Context, ref string, maxWidth int) (*PhotoData, error)
+}
+
+// NewProvider returns the provider selected in the restaurants config
+// section, defaulting to Google Places.
+func NewProvider(cfg *config.Config) Provider {
+	switch cfg.Restaurants.Provider {
+	case ProviderFixture:
+		return NewFixtureProvider(cfg.Restaurants.FixturePath)
+	case ProviderGoogle, "":
+		return newGooglePlacesFromConfig(cfg)
+	default:
+		logger.Warnf("Unknown restaurant provider %q, falling back to Google Places", cfg.Restaurants.Provider)
+		return newGooglePlacesFromConfig(cfg)
+	}
+}
+
+func newGooglePlacesFromConfig(cfg *config.Config) *GooglePlaces {
+	g := NewGooglePlaces(cfg.GooglePlaces.APIEndpoint, cfg.GooglePlaces.APIKey)
+	httpCfg := cfg.Restaurants.HTTP
+	g.Client = httpclient.New(httpclient.Options{
+		Timeout:          httpCfg.Timeout,
+		MaxRetries:       httpCfg.MaxRetries,
+		BreakerThreshold: httpCfg.BreakerThreshold,
+		BreakerCooldown:  httpCfg.BreakerCooldown,
+	})
+	if cfg.GooglePlaces.DetailsEndpoint != "" {
+		g.DetailsEndpoint = cfg.GooglePlaces.DetailsEndpoint
+	}
+	if cfg.GooglePlaces.PhotoEndpoint != "" {
+		g.PhotoEndpoint = cfg.GooglePlaces.PhotoEndpoint
+	}
+	return g
+}
@@ -0,0 +1,119 @@
+package restaurant
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultSearchRadius = 10000 // meters
+	MaxSearchRadius     = 50000 // the Places API limit
+	maxPriceLevel       = 4
+	maxCuisineLength    = 50
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Validate checks that the search parameters are within supported bounds.
+func (p SearchParams) Validate() error {
+	if !p.Location.Valid() {
+		return fmt.Errorf("%w: location is out of range", ErrInvalidSearch)
+	}
+	if p.Radius < 1 || p.Radius > MaxSearchRadius {
+		return fmt.Errorf("%w: radius must be between 1 and %d meters", ErrInvalidSearch, MaxSearchRadius)
+	}
+	if p.MinRating < 0 || p.MinRating > 5 {
+		return fmt.Errorf("%w: min_rating must be between 0 and 5", ErrInvalidSearch)
+	}
+	for _, price := range []*int{p.MinPrice, p.MaxPrice} {
+		if price != nil && (*price < 0 || *price > maxPriceLevel) {
+			return fmt.Errorf("%w: price levels must be between 0 and %d", ErrInvalidSearch, maxPriceLevel)
+		}
+	}
+	if p.MinPrice != nil && p.MaxPrice != nil && *p.MinPrice > *p.MaxPrice {
+		return fmt.Errorf("%w: min_price must not exceed max_price", ErrInvalidSearch)
+	}
+	if len(p.Cuisine) > maxCuisineLength {
+		return fmt.Errorf("%w: cuisine must be at most %d characters", ErrInvalidSearch, maxCuisineLength)
+	}
+	if !validSort(p.Sort) {
+		return fmt.Errorf("%w: sort must be one of %s, %s, %s or %s", ErrInvalidSearch, SortBest, SortDistance, SortRating, SortRelevance)
+	}
+	return p.validateOrigins()
+}
+
+// Matches reports whether place passes the rating, price, open-now and
+// cuisine filters. Places with an unknown price, opening state or types are
+// kept, since the provider already filtered on what it knows.
+func (p SearchParams) Matches(place Place) bool {
+	if p.MinRating > 0 && place.Rating < p.MinRating {
+		return false
+	}
+	if place.PriceLevel != nil {
+		if p.MinPrice != nil && *place.PriceLevel < *p.MinPrice {
+			return false
+		}
+		if p.MaxPrice != nil && *place.PriceLevel > *p.MaxPrice {
+			return false
+		}
+	}
+	if p.OpenNow && place.OpenNow != nil && !*place.OpenNow {
+		return false
+	}
+	if p.Cuisine != "" && len(place.Types) > 0 && !matchesCuisine(p.Cuisine, place.Types) {
+		return false
+	}
+	return true
+}
+
+// cuisineSuffixes are words a cuisine filter may carry that place types do
+// not, as in "thai food" or "korean restaurants".
+var cuisineSuffixes = map[string]bool{"food": true, "cuisine": true, "restaurant": true, "restaurants": true}
+
+// matchesCuisine reports whether one of types names cuisine, either plainly
+// ("thai") or as a Places type ("thai_restaurant").
+func matchesCuisine(cuisine string, types []string) bool {
+	words := strings.Fields(strings.ToLower(cuisine))
+	names := []string{strings.Join(words, "_")}
+	for len(words) > 1 && cuisineSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+		names = append(names, strings.Join(words, "_"))
+	}
+	for _, t := range types {
+		t = strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(t), "_restaurant"), "s")
+		for _, name := range names {
+			if t == strings.TrimSuffix(name, "s") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EncodeCursor returns an opaque cursor for the page after params, carrying
+// the provider's page token along with the filters of the original search.
+func EncodeCursor(params SearchParams, pageToken string) string {
+	params.PageToken = pageToken
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor restores the search a cursor continues.
+func DecodeCursor(cursor string) (SearchParams, error) {
+	var params SearchParams
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return params, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &params); err != nil || params.PageToken == "" {
+		return params, ErrInvalidCursor
+	}
+	return params, nil
+}
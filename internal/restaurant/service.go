@@ -1,21 +1,205 @@
 package restaurant
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/internal/geocode"
 	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/geo"
+	"github.com/turanoo/bitebattle/pkg/imaging"
+	"github.com/turanoo/bitebattle/pkg/logger"
+	"golang.org/x/sync/singleflight"
 )
 
+// TeamRatings looks up how a user's team rated restaurants they visited.
+type TeamRatings interface {
+	TeamRatings(ctx context.Context, userID uuid.UUID, restaurantIDs []string) (map[string]TeamRating, error)
+}
+
 type Service struct {
-	Endpoint string
-	APIKey   string
+	Provider Provider
+	Cache    *CachingProvider
+	Photos   *PhotoCache
+	Geocoder geocode.Geocoder
+	// Store is optional; without it details are not persisted.
+	Store *Store
+	// Ratings is optional; without it results carry no team rating.
+	Ratings TeamRatings
+
+	photoGroup singleflight.Group
+}
+
+func NewService(db *sql.DB, cfg *config.Config, ratings TeamRatings) *Service {
+	provider := NewProvider(cfg)
+	cacheCfg := cfg.Restaurants.Cache
+	service := &Service{
+		Provider: provider,
+		Cache:    NewCachingProvider(provider, cacheCfg.TTL, cacheCfg.StaleTTL, cacheCfg.MaxEntries),
+		Photos:   NewPhotoCache(cacheCfg.PhotoBytes),
+		Geocoder: geocode.NewGazetteer(),
+		Ratings:  ratings,
+	}
+	if db != nil {
+		service.Store = NewStore(db)
+	}
+	return service
+}
+
+// SearchRestaurants returns the first page of results for a text search
+// around a location, given as "lat,lng" or free text such as a city.
+func (s *Service) SearchRestaurants(ctx context.Context, query, location, radius string) ([]Place, error) {
+	resolved, err := s.ResolveLocation(ctx, "", location)
+	if err != nil {
+		return nil, err
+	}
+	meters, err := strconv.Atoi(radius)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid radius %q", ErrInvalidSearch, radius)
+	}
+	resp, err := s.Search(ctx, SearchParams{Query: query, Location: resolved.Location, Radius: meters})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// ResolveLocation turns either a "lat,lng" location or free text near into
+// coordinates. Exactly one of them is expected.
+func (s *Service) ResolveLocation(ctx context.Context, location, near string) (*geocode.Result, error) {
+	switch {
+	case location != "" && near != "":
+		return nil, fmt.Errorf("%w: use either location or near, not both", ErrInvalidSearch)
+	case near != "":
+		result, err := s.Geocoder.Geocode(ctx, near)
+		if errors.Is(err, geocode.ErrNotFound) || errors.Is(err, geocode.ErrInvalidQuery) {
+			return nil, fmt.Errorf("%w: %v: %q", ErrInvalidSearch, err, near)
+		}
+		return result, err
+	case location != "":
+		point, err := geo.ParseLatLng(location)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		return &geocode.Result{Location: point, Name: point.String(), Kind: geocode.KindCoordinates}, nil
+	default:
+		return nil, fmt.Errorf("%w: location or near is required", ErrInvalidSearch)
+	}
+}
+
+// Search runs a validated search and applies any filters the provider could
+// not. Results are annotated with distances and sorted within the page. The
+// response cursor continues the same search with the same filters.
+func (s *Service) Search(ctx context.Context, params SearchParams) (*SearchResponse, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	page, err := s.Cache.Search(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SearchResponse{Results: make([]Place, 0, len(page.Places))}
+	for _, place := range page.Places {
+		if params.Matches(place) {
+			resp.Results = append(resp.Results, place)
+		}
+	}
+	params.addDistances(resp.Results)
+	params.sortPlaces(resp.Results)
+	if page.NextPageToken != "" {
+		resp.NextCursor = EncodeCursor(params, page.NextPageToken)
+	}
+	return resp, nil
+}
+
+// AddTeamRatings sets the team rating of every place the user's team has
+// visited. Ratings are a nice-to-have, so failures are logged and ignored.
+func (s *Service) AddTeamRatings(ctx context.Context, userID uuid.UUID, places []Place) {
+	if s.Ratings == nil || len(places) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(places))
+	for _, p := range places {
+		ids = append(ids, p.PlaceID)
+	}
+
+	ratings, err := s.Ratings.TeamRatings(ctx, userID, ids)
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to load team ratings")
+		return
+	}
+	for i := range places {
+		if r, ok := ratings[places[i].PlaceID]; ok {
+			places[i].TeamRating = &r
+		}
+	}
+}
+
+// GetDetails fetches full details for a place from the provider and refreshes
+// the stored copy. If the provider is unavailable the stored copy is returned.
+func (s *Service) GetDetails(ctx context.Context, placeID string) (*PlaceDetails, error) {
+	details, err := s.Cache.Details(ctx, placeID)
+	if err == nil {
+		if s.Store != nil {
+			if err := s.Store.Save(ctx, details); err != nil {
+				logger.Log.WithError(err).Warnf("Failed to store details for place %s", placeID)
+			}
+		}
+		return details, nil
+	}
+	if errors.Is(err, ErrPlaceNotFound) || s.Store == nil {
+		return nil, err
+	}
+
+	stored, storeErr := s.Store.Get(ctx, placeID)
+	if storeErr != nil {
+		return nil, err
+	}
+	logger.Log.WithError(err).Warnf("Serving stored details for place %s", placeID)
+	return stored, nil
 }
 
-func NewService(cfg *config.Config) *Service {
-	return &Service{
-		Endpoint: cfg.GooglePlaces.APIEndpoint,
-		APIKey:   cfg.GooglePlaces.APIKey,
+// Photo returns the photo behind ref fitted within width x height (zero is
+// unconstrained). Resized photos are kept in memory, and concurrent requests
+// for the same photo share one upstream fetch.
+func (s *Service) Photo(ctx context.Context, ref string, width, height int) (*PhotoData, error) {
+	key := fmt.Sprintf("%s|%d|%d", ref, width, height)
+	if photo := s.Photos.Get(key); photo != nil {
+		return photo, nil
+	}
+
+	v, err, _ := s.photoGroup.Do(key, func() (interface{}, error) {
+		fetchWidth := width
+		if fetchWidth == 0 {
+			fetchWidth = MaxPhotoSize
+		}
+		raw, err := s.Provider.Photo(context.WithoutCancel(ctx), ref, fetchWidth)
+		if err != nil {
+			return nil, err
+		}
+
+		data, contentType, err := imaging.FitBytes(raw.Data, width, height)
+		if err != nil {
+			// Formats we can't decode are passed through at the provider's size.
+			logger.Log.WithError(err).Warnf("Serving photo %s without resizing", ref)
+			data, contentType = raw.Data, raw.ContentType
+		}
+		photo := &PhotoData{Data: data, ContentType: contentType, ETag: photoETag(data)}
+		s.Photos.Add(key, photo)
+		return photo, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return v.(*PhotoData), nil
 }
 
-func (s *Service) SearchRestaurants(query, location, radius string) ([]Place, error) {
-	return s.fetchFromGooglePlaces(query, location, radius)
+func (s *Service) CacheStats() CacheStats {
+	return s.Cache.Stats()
 }
@@ -0,0 +1,104 @@
+package restaurant
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+// Store keeps a normalized copy of restaurant details in the restaurants
+// table so other features can show them without calling the provider.
+type Store struct {
+	DB *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db}
+}
+
+// Save inserts or refreshes the stored copy of d. OpenNow is not stored since
+// it is only meaningful at the time it was fetched.
+func (s *Store) Save(ctx context.Context, d *PlaceDetails) error {
+	var lat, lng sql.NullFloat64
+	if d.Location != nil {
+		lat = sql.NullFloat64{Float64: d.Location.Lat, Valid: true}
+		lng = sql.NullFloat64{Float64: d.Location.Lng, Valid: true}
+	}
+	var priceLevel sql.NullInt64
+	if d.PriceLevel != nil {
+		priceLevel = sql.NullInt64{Int64: int64(*d.PriceLevel), Valid: true}
+	}
+	photoRef := ""
+	if len(d.Photos) > 0 {
+		photoRef = d.Photos[0].PhotoReference
+	}
+	// pq sends nil slices as NULL, which the NOT NULL array columns reject.
+	types, hours := d.Types, d.Hours
+	if types == nil {
+		types = []string{}
+	}
+	if hours == nil {
+		hours = []string{}
+	}
+
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO restaurants (place_id, name, address, lat, lng, rating, user_ratings_total, price_level,
+			phone, website, types, hours, review_summary, photo_reference, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (place_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			address = EXCLUDED.address,
+			lat = EXCLUDED.lat,
+			lng = EXCLUDED.lng,
+			rating = EXCLUDED.rating,
+			user_ratings_total = EXCLUDED.user_ratings_total,
+			price_level = EXCLUDED.price_level,
+			phone = EXCLUDED.phone,
+			website = EXCLUDED.website,
+			types = EXCLUDED.types,
+			hours = EXCLUDED.hours,
+			review_summary = EXCLUDED.review_summary,
+			photo_reference = EXCLUDED.photo_reference,
+			updated_at = EXCLUDED.updated_at
+	`, d.PlaceID, d.Name, d.Address, lat, lng, d.Rating, d.UserRatingsTotal, priceLevel,
+		d.Phone, d.Website, pq.Array(types), pq.Array(hours), d.ReviewSummary, photoRef, d.UpdatedAt)
+	return err
+}
+
+// Get returns the stored copy of a place, or ErrPlaceNotFound.
+func (s *Store) Get(ctx context.Context, placeID string) (*PlaceDetails, error) {
+	var d PlaceDetails
+	var lat, lng, rating sql.NullFloat64
+	var priceLevel sql.NullInt64
+	var photoRef string
+
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT place_id, name, address, lat, lng, rating, user_ratings_total, price_level,
+			phone, website, types, hours, review_summary, photo_reference, updated_at
+		FROM restaurants
+		WHERE place_id = $1
+	`, placeID).Scan(&d.PlaceID, &d.Name, &d.Address, &lat, &lng, &rating, &d.UserRatingsTotal, &priceLevel,
+		&d.Phone, &d.Website, pq.Array(&d.Types), pq.Array(&d.Hours), &d.ReviewSummary, &photoRef, &d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lat.Valid && lng.Valid {
+		d.Location = &geo.Point{Lat: lat.Float64, Lng: lng.Float64}
+	}
+	d.Rating = rating.Float64
+	if priceLevel.Valid {
+		level := int(priceLevel.Int64)
+		d.PriceLevel = &level
+	}
+	if photoRef != "" {
+		d.Photos = withPhotoURLs([]Photo{{PhotoReference: photoRef}})
+	}
+	return &d, nil
+}
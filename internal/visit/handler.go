@@ -0,0 +1,176 @@
+package visit
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/internal/auth"
+	"github.com/turanoo/bitebattle/pkg/logger"
+	"github.com/turanoo/bitebattle/pkg/utils"
+)
+
+type Handler struct {
+	Service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{Service: service}
+}
+
+func (h *Handler) CreateVisit(c *gin.Context) {
+	log := logger.FromContext(c)
+	var req CreateVisitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in CreateVisit token")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	v := NewVisit{
+		RestaurantID:   req.RestaurantID,
+		RestaurantName: req.RestaurantName,
+		VisitedOn:      time.Now(),
+		Rating:         req.Rating,
+		Notes:          req.Notes,
+	}
+	if req.VisitedOn != "" {
+		v.VisitedOn, _ = time.Parse(DateLayout, req.VisitedOn) // validated by binding
+	}
+	if req.PollID != "" {
+		pollID := uuid.MustParse(req.PollID)
+		v.PollID = &pollID
+	}
+	if req.MatchID != "" {
+		matchID := uuid.MustParse(req.MatchID)
+		v.MatchID = &matchID
+	}
+
+	visit, err := h.Service.CreateVisit(userID, v)
+	if err != nil {
+		writeVisitError(c, err, "could not record visit")
+		return
+	}
+	c.JSON(http.StatusCreated, visit)
+}
+
+// GetVisits lists the caller's visits, optionally filtered by restaurant_id.
+func (h *Handler) GetVisits(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in GetVisits token")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	visits, err := h.Service.GetVisits(userID, c.Query("restaurant_id"))
+	if err != nil {
+		writeVisitError(c, err, "could not fetch visits")
+		return
+	}
+	c.JSON(http.StatusOK, visits)
+}
+
+func (h *Handler) UpdateVisit(c *gin.Context) {
+	log := logger.FromContext(c)
+	var req UpdateVisitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, utils.FormatValidationError(err))
+		return
+	}
+
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in UpdateVisit token")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	visitID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid visit ID")
+		return
+	}
+
+	u := VisitUpdate{Rating: req.Rating, ClearRating: req.ClearRating, Notes: req.Notes}
+	if req.VisitedOn != "" {
+		visitedOn, _ := time.Parse(DateLayout, req.VisitedOn) // validated by binding
+		u.VisitedOn = &visitedOn
+	}
+
+	visit, err := h.Service.UpdateVisit(userID, visitID, u)
+	if err != nil {
+		writeVisitError(c, err, "could not update visit")
+		return
+	}
+	c.JSON(http.StatusOK, visit)
+}
+
+func (h *Handler) DeleteVisit(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in DeleteVisit token")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	visitID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid visit ID")
+		return
+	}
+
+	if err := h.Service.DeleteVisit(userID, visitID); err != nil {
+		writeVisitError(c, err, "could not delete visit")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetTeamRating returns how the caller's team rated a restaurant.
+func (h *Handler) GetTeamRating(c *gin.Context) {
+	log := logger.FromContext(c)
+	userID, err := auth.UserIDFromContext(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user id in GetTeamRating token")
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	restaurantID := c.Param("restaurantId")
+	ratings, err := h.Service.TeamRatings(c.Request.Context(), userID, []string{restaurantID})
+	if err != nil {
+		writeVisitError(c, err, "could not fetch team rating")
+		return
+	}
+	rating, ok := ratings[restaurantID]
+	if !ok {
+		utils.ErrorResponse(c, http.StatusNotFound, "Nobody on your team has visited this restaurant.")
+		return
+	}
+	c.JSON(http.StatusOK, rating)
+}
+
+func writeVisitError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrVisitNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Visit not found.")
+	case errors.Is(err, ErrPollNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Poll not found.")
+	case errors.Is(err, ErrMatchNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Match not found.")
+	case errors.Is(err, ErrVisitInFuture):
+		utils.ErrorResponse(c, http.StatusBadRequest, "Visit date cannot be in the future.")
+	default:
+		logger.FromContext(c).WithError(err).Error(fallback)
+		utils.ErrorResponse(c, http.StatusInternalServerError, fallback)
+	}
+}
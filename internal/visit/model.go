@@ -0,0 +1,65 @@
+package visit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DateLayout is the format of visit dates.
+const DateLayout = "2006-01-02"
+
+type CreateVisitRequest struct {
+	RestaurantID   string `json:"restaurant_id" binding:"required,max=255"`
+	RestaurantName string `json:"restaurant_name" binding:"required,max=200"`
+	// VisitedOn defaults to today.
+	VisitedOn string `json:"visited_on" binding:"omitempty,datetime=2006-01-02"`
+	PollID    string `json:"poll_id" binding:"omitempty,uuid"`
+	MatchID   string `json:"match_id" binding:"omitempty,uuid"`
+	Rating    *int   `json:"rating" binding:"omitempty,min=1,max=5"`
+	Notes     string `json:"notes" binding:"max=2000"`
+}
+
+// UpdateVisitRequest changes only the fields that are set. An empty Notes
+// clears the notes, and ClearRating removes the rating.
+type UpdateVisitRequest struct {
+	VisitedOn   string  `json:"visited_on" binding:"omitempty,datetime=2006-01-02"`
+	Rating      *int    `json:"rating" binding:"omitempty,min=1,max=5"`
+	ClearRating bool    `json:"clear_rating" binding:"excluded_with=Rating"`
+	Notes       *string `json:"notes" binding:"omitempty,max=2000"`
+}
+
+// NewVisit is a visit to record. PollID and MatchID link the visit to the
+// poll or match that picked the restaurant.
+type NewVisit struct {
+	RestaurantID   string
+	RestaurantName string
+	VisitedOn      time.Time
+	PollID         *uuid.UUID
+	MatchID        *uuid.UUID
+	Rating         *int
+	Notes          string
+}
+
+// VisitUpdate leaves nil fields as they are. ClearRating removes the rating
+// and takes precedence over Rating.
+type VisitUpdate struct {
+	VisitedOn   *time.Time
+	Rating      *int
+	ClearRating bool
+	Notes       *string
+}
+
+type Visit struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	RestaurantID   string     `json:"restaurant_id"`
+	RestaurantName string     `json:"restaurant_name"`
+	VisitedOn      string     `json:"visited_on"` // YYYY-MM-DD
+	PollID         *uuid.UUID `json:"poll_id,omitempty"`
+	MatchID        *uuid.UUID `json:"match_id,omitempty"`
+	Rating         *int       `json:"rating,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
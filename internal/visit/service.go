@@ -0,0 +1,248 @@
+package visit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/turanoo/bitebattle/internal/restaurant"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+var ErrVisitNotFound = errors.New("visit not found")
+var ErrPollNotFound = errors.New("poll not found")
+var ErrMatchNotFound = errors.New("match not found")
+var ErrVisitInFuture = errors.New("visit date is in the future")
+
+// teamCTE selects the user in $1 and everyone they share a poll or an
+// accepted head-to-head match with.
+const teamCTE = `
+	WITH team AS (
+		SELECT $1::uuid AS user_id
+		UNION
+		SELECT p.created_by FROM polls p JOIN polls_members m ON m.poll_id = p.id WHERE m.user_id = $1
+		UNION
+		SELECT m.user_id FROM polls p JOIN polls_members m ON m.poll_id = p.id WHERE p.created_by = $1
+		UNION
+		SELECT m2.user_id FROM polls_members m1 JOIN polls_members m2 ON m2.poll_id = m1.poll_id WHERE m1.user_id = $1
+		UNION
+		SELECT p2.user_id FROM head2head_participants p1
+		JOIN head2head_participants p2 ON p2.match_id = p1.match_id AND p2.status = 'accepted'
+		WHERE p1.user_id = $1 AND p1.status = 'accepted'
+	)`
+
+type Service struct {
+	DB *sql.DB
+}
+
+func NewService(db *sql.DB) *Service {
+	return &Service{DB: db}
+}
+
+func (s *Service) CreateVisit(userID uuid.UUID, v NewVisit) (*Visit, error) {
+	if v.VisitedOn.After(time.Now().AddDate(0, 0, 1)) {
+		return nil, ErrVisitInFuture
+	}
+	if v.PollID != nil {
+		if ok, err := s.inPoll(userID, *v.PollID); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrPollNotFound
+		}
+	}
+	if v.MatchID != nil {
+		if ok, err := s.inMatch(userID, *v.MatchID); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrMatchNotFound
+		}
+	}
+
+	now := time.Now()
+	visit := &Visit{
+		ID:             uuid.New(),
+		UserID:         userID,
+		RestaurantID:   v.RestaurantID,
+		RestaurantName: v.RestaurantName,
+		VisitedOn:      v.VisitedOn.Format(DateLayout),
+		PollID:         v.PollID,
+		MatchID:        v.MatchID,
+		Rating:         v.Rating,
+		Notes:          v.Notes,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	_, err := s.DB.Exec(`
+		INSERT INTO visits (id, user_id, restaurant_id, restaurant_name, visited_on, poll_id, match_id, rating, notes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, visit.ID, userID, v.RestaurantID, v.RestaurantName, visit.VisitedOn, v.PollID, v.MatchID, v.Rating, v.Notes, now, now)
+	if err != nil {
+		return nil, err
+	}
+	return visit, nil
+}
+
+// GetVisits returns the user's visits, newest first, optionally only those to
+// one restaurant.
+func (s *Service) GetVisits(userID uuid.UUID, restaurantID string) ([]Visit, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, restaurant_id, restaurant_name, visited_on, poll_id, match_id, rating, notes, created_at, updated_at
+		FROM visits
+		WHERE user_id = $1 AND ($2 = '' OR restaurant_id = $2)
+		ORDER BY visited_on DESC, created_at DESC
+	`, userID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	visits := []Visit{}
+	for rows.Next() {
+		v, err := scanVisit(rows)
+		if err != nil {
+			return nil, err
+		}
+		visits = append(visits, *v)
+	}
+	return visits, rows.Err()
+}
+
+func (s *Service) GetVisit(userID, visitID uuid.UUID) (*Visit, error) {
+	row := s.DB.QueryRow(`
+		SELECT id, user_id, restaurant_id, restaurant_name, visited_on, poll_id, match_id, rating, notes, created_at, updated_at
+		FROM visits
+		WHERE id = $1 AND user_id = $2
+	`, visitID, userID)
+	v, err := scanVisit(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVisitNotFound
+	}
+	return v, err
+}
+
+func (s *Service) UpdateVisit(userID, visitID uuid.UUID, u VisitUpdate) (*Visit, error) {
+	if u.VisitedOn != nil && u.VisitedOn.After(time.Now().AddDate(0, 0, 1)) {
+		return nil, ErrVisitInFuture
+	}
+	var visitedOn *string
+	if u.VisitedOn != nil {
+		date := u.VisitedOn.Format(DateLayout)
+		visitedOn = &date
+	}
+
+	res, err := s.DB.Exec(`
+		UPDATE visits SET
+			visited_on = COALESCE($1::date, visited_on),
+			rating = CASE WHEN $7 THEN NULL ELSE COALESCE($2, rating) END,
+			notes = COALESCE($3, notes),
+			updated_at = $4
+		WHERE id = $5 AND user_id = $6
+	`, visitedOn, u.Rating, u.Notes, time.Now(), visitID, userID, u.ClearRating)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrVisitNotFound
+	}
+	return s.GetVisit(userID, visitID)
+}
+
+func (s *Service) DeleteVisit(userID, visitID uuid.UUID) error {
+	res, err := s.DB.Exec(`DELETE FROM visits WHERE id = $1 AND user_id = $2`, visitID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrVisitNotFound
+	}
+	return nil
+}
+
+// TeamRatings aggregates the visits of the user's team to each restaurant.
+// Restaurants nobody on the team visited are left out.
+func (s *Service) TeamRatings(ctx context.Context, userID uuid.UUID, restaurantIDs []string) (map[string]restaurant.TeamRating, error) {
+	ratings := make(map[string]restaurant.TeamRating)
+	if len(restaurantIDs) == 0 {
+		return ratings, nil
+	}
+
+	rows, err := s.DB.QueryContext(ctx, teamCTE+`
+		SELECT v.restaurant_id, COALESCE(AVG(v.rating), 0), COUNT(v.rating), COUNT(*), MAX(v.visited_on)
+		FROM visits v
+		JOIN team t ON t.user_id = v.user_id
+		WHERE v.restaurant_id = ANY($2)
+		GROUP BY v.restaurant_id
+	`, userID, pq.Array(restaurantIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Log.WithError(err).Error("failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var id string
+		var r restaurant.TeamRating
+		var last time.Time
+		if err := rows.Scan(&id, &r.Average, &r.Ratings, &r.Visits, &last); err != nil {
+			return nil, err
+		}
+		r.LastVisited = &last
+		ratings[id] = r
+	}
+	return ratings, rows.Err()
+}
+
+func (s *Service) inPoll(userID, pollID uuid.UUID) (bool, error) {
+	var ok bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM polls WHERE id = $1 AND created_by = $2)
+			OR EXISTS (SELECT 1 FROM polls_members WHERE poll_id = $1 AND user_id = $2)
+	`, pollID, userID).Scan(&ok)
+	return ok, err
+}
+
+func (s *Service) inMatch(userID, matchID uuid.UUID) (bool, error) {
+	var ok bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM head2head_participants WHERE match_id = $1 AND user_id = $2 AND status = 'accepted')
+	`, matchID, userID).Scan(&ok)
+	return ok, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanVisit(row scanner) (*Visit, error) {
+	var v Visit
+	var visitedOn time.Time
+	var pollID, matchID uuid.NullUUID
+	var rating sql.NullInt64
+	err := row.Scan(&v.ID, &v.UserID, &v.RestaurantID, &v.RestaurantName, &visitedOn,
+		&pollID, &matchID, &rating, &v.Notes, &v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	v.VisitedOn = visitedOn.Format(DateLayout)
+	if pollID.Valid {
+		v.PollID = &pollID.UUID
+	}
+	if matchID.Valid {
+		v.MatchID = &matchID.UUID
+	}
+	if rating.Valid {
+		r := int(rating.Int64)
+		v.Rating = &r
+	}
+	return &v, nil
+}
@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS head2head_swipes_match_user_restaurant_idx;
+
+ALTER TABLE head2head_matches
+    DROP COLUMN consensus_k,
+    DROP COLUMN consensus,
+    ADD COLUMN invitee_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+UPDATE head2head_matches m
+SET invitee_id = (
+    SELECT p.user_id FROM head2head_participants p
+    WHERE p.match_id = m.id AND p.user_id <> m.inviter_id
+    ORDER BY p.created_at
+    LIMIT 1
+);
+
+DELETE FROM head2head_matches WHERE invitee_id IS NULL;
+ALTER TABLE head2head_matches ALTER COLUMN invitee_id SET NOT NULL;
+
+DROP TABLE IF EXISTS head2head_participants;
@@ -0,0 +1,34 @@
+CREATE TABLE head2head_participants (
+    match_id UUID NOT NULL REFERENCES head2head_matches(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('invited', 'accepted', 'declined')),
+    joined_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (match_id, user_id)
+);
+
+INSERT INTO head2head_participants (match_id, user_id, status, joined_at, created_at)
+SELECT id, inviter_id, 'accepted', created_at, created_at FROM head2head_matches;
+
+INSERT INTO head2head_participants (match_id, user_id, status, joined_at, created_at)
+SELECT id, invitee_id,
+    CASE WHEN status = 'pending' THEN 'invited' ELSE 'accepted' END,
+    CASE WHEN status = 'pending' THEN NULL ELSE updated_at END,
+    created_at
+FROM head2head_matches
+ON CONFLICT (match_id, user_id) DO NOTHING;
+
+ALTER TABLE head2head_matches
+    DROP COLUMN invitee_id,
+    ADD COLUMN consensus TEXT NOT NULL DEFAULT 'unanimous' CHECK (consensus IN ('unanimous', 'majority', 'k_of_n')),
+    ADD COLUMN consensus_k INT CHECK (consensus_k IS NULL OR consensus_k > 0);
+
+DELETE FROM head2head_swipes a
+USING head2head_swipes b
+WHERE a.match_id = b.match_id
+  AND a.user_id = b.user_id
+  AND a.restaurant_id = b.restaurant_id
+  AND (a.created_at, a.id) < (b.created_at, b.id);
+
+CREATE UNIQUE INDEX head2head_swipes_match_user_restaurant_idx
+    ON head2head_swipes (match_id, user_id, restaurant_id);
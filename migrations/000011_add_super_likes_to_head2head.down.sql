@@ -0,0 +1,6 @@
+ALTER TABLE head2head_swipes
+    DROP CONSTRAINT IF EXISTS head2head_swipes_super_like_liked,
+    DROP COLUMN IF EXISTS super_like;
+
+ALTER TABLE head2head_matches
+    DROP COLUMN IF EXISTS super_like_budget;
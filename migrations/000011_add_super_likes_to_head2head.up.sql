@@ -0,0 +1,6 @@
+ALTER TABLE head2head_matches
+    ADD COLUMN super_like_budget INT NOT NULL DEFAULT 3 CHECK (super_like_budget >= 0);
+
+ALTER TABLE head2head_swipes
+    ADD COLUMN super_like BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD CONSTRAINT head2head_swipes_super_like_liked CHECK (NOT super_like OR liked);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS head2head_invites;
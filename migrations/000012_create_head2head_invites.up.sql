@@ -0,0 +1,11 @@
+CREATE TABLE head2head_invites (
+    token TEXT PRIMARY KEY,
+    match_id UUID NOT NULL REFERENCES head2head_matches(id) ON DELETE CASCADE,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    claimed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    claimed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX head2head_invites_match_id_idx ON head2head_invites (match_id);
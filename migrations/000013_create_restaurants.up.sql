@@ -0,0 +1,17 @@
+CREATE TABLE restaurants (
+    place_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    lat DOUBLE PRECISION,
+    lng DOUBLE PRECISION,
+    rating DOUBLE PRECISION,
+    user_ratings_total INT NOT NULL DEFAULT 0,
+    price_level SMALLINT CHECK (price_level BETWEEN 0 AND 4),
+    phone TEXT NOT NULL DEFAULT '',
+    website TEXT NOT NULL DEFAULT '',
+    types TEXT[] NOT NULL DEFAULT '{}',
+    hours TEXT[] NOT NULL DEFAULT '{}',
+    review_summary TEXT NOT NULL DEFAULT '',
+    photo_reference TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
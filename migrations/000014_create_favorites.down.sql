@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS favorite_list_items;
+DROP TABLE IF EXISTS favorite_lists;
+DROP TABLE IF EXISTS favorite_restaurants;
@@ -0,0 +1,26 @@
+CREATE TABLE favorite_restaurants (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    image_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, restaurant_id)
+);
+
+CREATE TABLE favorite_lists (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE favorite_list_items (
+    list_id UUID NOT NULL REFERENCES favorite_lists(id) ON DELETE CASCADE,
+    restaurant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    image_url TEXT NOT NULL DEFAULT '',
+    added_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, restaurant_id)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE visits (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id TEXT NOT NULL,
+    restaurant_name TEXT NOT NULL,
+    visited_on DATE NOT NULL,
+    poll_id UUID REFERENCES polls(id) ON DELETE SET NULL,
+    match_id UUID REFERENCES head2head_matches(id) ON DELETE SET NULL,
+    rating SMALLINT CHECK (rating BETWEEN 1 AND 5),
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX visits_user_id_idx ON visits (user_id, visited_on DESC);
+CREATE INDEX visits_restaurant_id_idx ON visits (restaurant_id);
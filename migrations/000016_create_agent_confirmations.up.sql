@@ -0,0 +1,11 @@
+CREATE TABLE agent_confirmations (
+    token TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tool TEXT NOT NULL,
+    args JSONB NOT NULL,
+    message TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX agent_confirmations_user_id_idx ON agent_confirmations (user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS agent_session_turns;
+DROP TABLE IF EXISTS agent_sessions;
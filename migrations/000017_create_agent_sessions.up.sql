@@ -0,0 +1,22 @@
+CREATE TABLE agent_sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    summary TEXT NOT NULL DEFAULT '',
+    poll_id UUID REFERENCES polls(id) ON DELETE SET NULL,
+    match_id UUID REFERENCES head2head_matches(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX agent_sessions_user_id_idx ON agent_sessions (user_id);
+
+CREATE TABLE agent_session_turns (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES agent_sessions(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('user', 'assistant')),
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX agent_session_turns_session_id_idx ON agent_session_turns (session_id, created_at);
@@ -0,0 +1,18 @@
+CREATE TABLE agent_commands (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID REFERENCES agent_sessions(id) ON DELETE SET NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('command', 'confirmation')),
+    command TEXT NOT NULL,
+    intent JSONB NOT NULL DEFAULT '[]',
+    steps JSONB NOT NULL DEFAULT '[]',
+    action TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX agent_commands_user_id_idx ON agent_commands (user_id, created_at DESC);
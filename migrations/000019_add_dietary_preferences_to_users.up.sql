@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN dietary_preferences TEXT[] NOT NULL DEFAULT '{}';
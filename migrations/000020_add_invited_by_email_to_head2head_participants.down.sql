@@ -0,0 +1,2 @@
+ALTER TABLE head2head_participants
+    DROP COLUMN IF EXISTS invited_by_email;
@@ -0,0 +1,2 @@
+ALTER TABLE head2head_participants
+    ADD COLUMN invited_by_email BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE agent_confirmations
+    DROP COLUMN IF EXISTS claimed_at;
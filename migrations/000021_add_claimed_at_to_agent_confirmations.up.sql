@@ -0,0 +1,2 @@
+ALTER TABLE agent_confirmations
+    ADD COLUMN claimed_at TIMESTAMP;
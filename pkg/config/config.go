@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
@@ -40,12 +41,59 @@ type Config struct {
 	GooglePlaces struct {
 		APIKey      string `yaml:"api_key"`
 		APIEndpoint string `yaml:"api_endpoint"`
+		// DetailsEndpoint defaults to the details API next to APIEndpoint.
+		DetailsEndpoint string `yaml:"details_endpoint"`
+		// PhotoEndpoint defaults to the photo API next to APIEndpoint.
+		PhotoEndpoint string `yaml:"photo_endpoint"`
 	} `yaml:"google_places"`
-	Vertex struct {
-		ProjectID string `yaml:"project_id"`
-		Location  string `yaml:"location"`
-		Model     string `yaml:"model"`
-	} `yaml:"vertex"`
+	Restaurants struct {
+		Provider    string `yaml:"provider"`     // google (default) or fixture
+		FixturePath string `yaml:"fixture_path"` // JSON or GeoJSON dataset for the fixture provider
+		Cache       struct {
+			TTL        time.Duration `yaml:"ttl"`         // how long search results are fresh
+			StaleTTL   time.Duration `yaml:"stale_ttl"`   // how long past ttl results may be served if the provider fails
+			MaxEntries int           `yaml:"max_entries"` // cached searches kept in memory
+			PhotoBytes int64         `yaml:"photo_bytes"` // memory for resized photos
+		} `yaml:"cache"`
+		HTTP struct {
+			Timeout          time.Duration `yaml:"timeout"`           // per provider call attempt
+			MaxRetries       int           `yaml:"max_retries"`       // -1 disables retries
+			BreakerThreshold int           `yaml:"breaker_threshold"` // failed calls in a row that stop calls to the provider
+			BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // how long calls stay stopped
+		} `yaml:"http"`
+	} `yaml:"restaurants"`
+	Agent struct {
+		Backend string `yaml:"backend"` // vertex (default), openai or rules
+		// MaxSteps caps the model turns spent on one command.
+		MaxSteps int `yaml:"max_steps"`
+		// SessionTokenBudget is roughly how much session history, in
+		// tokens, is kept before older turns are summarized.
+		SessionTokenBudget int `yaml:"session_token_budget"`
+		// DailyCommandLimit and DailyTokenLimit are per-user quotas of
+		// commands and model tokens, reset at midnight UTC.
+		DailyCommandLimit int `yaml:"daily_command_limit"`
+		DailyTokenLimit   int `yaml:"daily_token_limit"`
+		Vertex            struct {
+			ProjectID string `yaml:"project_id"`
+			Location  string `yaml:"location"`
+			Model     string `yaml:"model"`
+			// Credentials is auto (default), metadata, adc or token. Auto
+			// uses AuthToken when set and Application Default Credentials
+			// otherwise.
+			Credentials     string        `yaml:"credentials"`
+			CredentialsFile string        `yaml:"credentials_file"` // service account key for adc, optional
+			AuthToken       string        `yaml:"auth_token"`       // static access token, for development
+			Timeout         time.Duration `yaml:"timeout"`
+		} `yaml:"vertex"`
+		// OpenAI is any server with an OpenAI-compatible chat completions
+		// API, such as a local model server.
+		OpenAI struct {
+			BaseURL string        `yaml:"base_url"` // e.g. http://localhost:11434/v1
+			Model   string        `yaml:"model"`
+			APIKey  string        `yaml:"api_key"` // optional for local servers
+			Timeout time.Duration `yaml:"timeout"`
+		} `yaml:"openai"`
+	} `yaml:"agent"`
 }
 
 func LoadConfig(ctx context.Context, configDir string) (*Config, error) {
@@ -157,18 +205,34 @@ func resolveGCPSecrets(ctx context.Context, cfg *Config) error {
 	if err != nil {
 		errList = append(errList, fmt.Errorf("GooglePlaces.APIEndpoint: %w", err))
 	}
-	// Vertex
-	cfg.Vertex.ProjectID, err = resolve(cfg.Vertex.ProjectID)
+	cfg.GooglePlaces.DetailsEndpoint, err = resolve(cfg.GooglePlaces.DetailsEndpoint)
 	if err != nil {
-		errList = append(errList, fmt.Errorf("Vertex.ProjectID: %w", err))
+		errList = append(errList, fmt.Errorf("GooglePlaces.DetailsEndpoint: %w", err))
 	}
-	cfg.Vertex.Location, err = resolve(cfg.Vertex.Location)
+	cfg.GooglePlaces.PhotoEndpoint, err = resolve(cfg.GooglePlaces.PhotoEndpoint)
 	if err != nil {
-		errList = append(errList, fmt.Errorf("Vertex.Location: %w", err))
+		errList = append(errList, fmt.Errorf("GooglePlaces.PhotoEndpoint: %w", err))
 	}
-	cfg.Vertex.Model, err = resolve(cfg.Vertex.Model)
+	// Agent
+	cfg.Agent.Vertex.ProjectID, err = resolve(cfg.Agent.Vertex.ProjectID)
 	if err != nil {
-		errList = append(errList, fmt.Errorf("Vertex.Model: %w", err))
+		errList = append(errList, fmt.Errorf("Agent.Vertex.ProjectID: %w", err))
+	}
+	cfg.Agent.Vertex.Location, err = resolve(cfg.Agent.Vertex.Location)
+	if err != nil {
+		errList = append(errList, fmt.Errorf("Agent.Vertex.Location: %w", err))
+	}
+	cfg.Agent.Vertex.Model, err = resolve(cfg.Agent.Vertex.Model)
+	if err != nil {
+		errList = append(errList, fmt.Errorf("Agent.Vertex.Model: %w", err))
+	}
+	cfg.Agent.Vertex.AuthToken, err = resolve(cfg.Agent.Vertex.AuthToken)
+	if err != nil {
+		errList = append(errList, fmt.Errorf("Agent.Vertex.AuthToken: %w", err))
+	}
+	cfg.Agent.OpenAI.APIKey, err = resolve(cfg.Agent.OpenAI.APIKey)
+	if err != nil {
+		errList = append(errList, fmt.Errorf("Agent.OpenAI.APIKey: %w", err))
 	}
 
 	if len(errList) > 0 {
@@ -0,0 +1,81 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusMeters is the mean Earth radius used for great-circle distances.
+const earthRadiusMeters = 6371008.8
+
+var ErrInvalidLatLng = errors.New(`location must be "lat,lng" with latitude in [-90, 90] and longitude in [-180, 180]`)
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// ParseLatLng parses a "lat,lng" string and checks that it is in range.
+func ParseLatLng(s string) (Point, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return Point{}, ErrInvalidLatLng
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return Point{}, ErrInvalidLatLng
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return Point{}, ErrInvalidLatLng
+	}
+	p := Point{Lat: lat, Lng: lng}
+	if !p.Valid() {
+		return Point{}, ErrInvalidLatLng
+	}
+	return p, nil
+}
+
+// Valid reports whether the point lies within latitude/longitude bounds.
+func (p Point) Valid() bool {
+	return !math.IsNaN(p.Lat) && !math.IsNaN(p.Lng) &&
+		p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// String formats the point as "lat,lng", the form the Places API expects.
+func (p Point) String() string {
+	return fmt.Sprintf("%s,%s",
+		strconv.FormatFloat(p.Lat, 'f', -1, 64),
+		strconv.FormatFloat(p.Lng, 'f', -1, 64))
+}
+
+// Centroid returns the average of points, which is close enough to their
+// geographic midpoint at city scale. It returns the zero Point for no points.
+func Centroid(points []Point) Point {
+	var c Point
+	if len(points) == 0 {
+		return c
+	}
+	for _, p := range points {
+		c.Lat += p.Lat
+		c.Lng += p.Lng
+	}
+	c.Lat /= float64(len(points))
+	c.Lng /= float64(len(points))
+	return c
+}
+
+// DistanceMeters returns the haversine distance between two points.
+func DistanceMeters(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,253 @@
+// Package httpclient provides an HTTP client for calling upstream APIs that
+// bounds every attempt with a timeout, retries transient failures with
+// jittered backoff, and stops calling an upstream that keeps failing.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxRetries       = 2
+	DefaultBaseDelay        = 200 * time.Millisecond
+	DefaultMaxDelay         = 2 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the upstream while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Options configures a client. Zero values use the defaults above; a
+// negative MaxRetries disables retries.
+type Options struct {
+	// Timeout bounds each attempt, including reading the body.
+	Timeout    time.Duration
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	// BreakerThreshold is how many failed calls in a row open the circuit.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit stays open before one call is
+	// let through to probe the upstream.
+	BreakerCooldown time.Duration
+}
+
+// New returns an http.Client whose transport is a Transport over
+// http.DefaultTransport.
+func New(opts Options) *http.Client {
+	return &http.Client{Transport: NewTransport(http.DefaultTransport, opts)}
+}
+
+// Transport is an http.RoundTripper adding timeouts, retries and a circuit
+// breaker to Base. Only idempotent requests without a body are retried.
+type Transport struct {
+	Base    http.RoundTripper
+	opts    Options
+	breaker breaker
+}
+
+func NewTransport(base http.RoundTripper, opts Options) *Transport {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	} else if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultMaxDelay
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return &Transport{
+		Base:    base,
+		opts:    opts,
+		breaker: breaker{threshold: opts.BreakerThreshold, cooldown: opts.BreakerCooldown},
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow(time.Now()) {
+		return nil, ErrCircuitOpen
+	}
+
+	retries := t.opts.MaxRetries
+	if !retryable(req) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+		if req.Context().Err() != nil {
+			// The caller gave up, which says nothing about the upstream.
+			t.breaker.release()
+			return resp, err
+		}
+		if attempt == retries || !shouldRetry(resp, err) {
+			t.breaker.record(time.Now(), failed(resp, err))
+			return resp, err
+		}
+
+		delay := t.backoff(attempt, resp)
+		if resp != nil {
+			// Drain so the connection can be reused.
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
+			t.breaker.release()
+			return nil, err
+		}
+	}
+}
+
+// attempt makes one call bounded by the timeout. The deadline stays in force
+// until the response body is closed.
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.Timeout)
+	resp, err := t.Base.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns a random delay up to an exponentially growing cap, or the
+// upstream's Retry-After if it asks for longer.
+func (t *Transport) backoff(attempt int, resp *http.Response) time.Duration {
+	ceiling := t.opts.BaseDelay << attempt
+	if ceiling <= 0 || ceiling > t.opts.MaxDelay {
+		ceiling = t.opts.MaxDelay
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling)) + 1)
+
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if after := time.Duration(secs) * time.Second; after > delay {
+				delay = min(after, t.opts.MaxDelay)
+			}
+		}
+	}
+	return delay
+}
+
+func retryable(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) && req.Body == nil
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return RetryableStatus(resp.StatusCode)
+}
+
+// RetryableStatus reports whether a response with this status is worth
+// retrying.
+func RetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return code == http.StatusInternalServerError
+}
+
+// failed reports whether a call counts against the upstream's health. Rate
+// limiting and client errors say nothing about whether it is up.
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// breaker opens after threshold failed calls in a row. Once cooldown has
+// passed it lets a single call through: success closes it again, failure
+// keeps it open for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends a probe without a verdict.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) record(now time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,91 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// Register decoders used by image.Decode.
+	_ "image/gif"
+)
+
+const jpegQuality = 85
+
+// Fit scales img down so that it fits within maxWidth x maxHeight, keeping its
+// aspect ratio. A bound of zero is unconstrained. Images are never scaled up.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if maxWidth > 0 && w > maxWidth {
+		scale = float64(maxWidth) / float64(w)
+	}
+	if maxHeight > 0 && float64(h)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(h)
+	}
+	if scale >= 1 {
+		return img
+	}
+	return resize(img, max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5)))
+}
+
+// resize downsamples img to width x height by averaging the source pixels
+// each destination pixel covers.
+func resize(img image.Image, width, height int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// FitBytes decodes an image, fits it within the bounds and re-encodes it as
+// JPEG, or PNG if the source was PNG. It returns the encoded bytes and their
+// content type.
+func FitBytes(data []byte, maxWidth, maxHeight int) ([]byte, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	img = Fit(img, maxWidth, maxHeight)
+
+	var buf bytes.Buffer
+	if format == "png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
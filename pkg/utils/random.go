@@ -1,6 +1,8 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"encoding/base64"
 	"math/rand"
 )
 
@@ -13,3 +15,13 @@ func GenerateRandomString(length int) string {
 	}
 	return string(b)
 }
+
+// GenerateSecureToken returns a URL-safe token built from n bytes of
+// cryptographically secure randomness.
+func GenerateSecureToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
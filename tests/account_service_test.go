@@ -1,42 +1,18 @@
 package tests
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"testing"
 
-	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/turanoo/bitebattle/internal/account"
-	"github.com/turanoo/bitebattle/pkg/utils"
 )
 
-func setupAccountTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		t.Fatalf("failed to open test db: %v", err)
-	}
-	_, err = db.Exec(`
-		CREATE TABLE users (
-			id TEXT PRIMARY KEY,
-			email TEXT NOT NULL,
-			name TEXT NOT NULL,
-			password_hash TEXT NOT NULL
-		);
-	`)
-	if err != nil {
-		t.Fatalf("failed to create users table: %v", err)
-	}
-	return db
-}
-
 func TestGetUserProfile(t *testing.T) {
-	db := setupAccountTestDB(t)
-	service := account.NewService(db)
-	id := uuid.New()
-	_, err := db.Exec(`INSERT INTO users (id, email, name, password_hash) VALUES (?, ?, ?, ?)`, id.String(), "test@a.com", "Test", "hash")
-	if err != nil {
-		t.Fatalf("insert user: %v", err)
-	}
+	db := newTestDB(t, usersTable)
+	service := &account.Service{DB: db}
+	id := insertUser(t, db, "Test")
+
 	profile, err := service.GetUserProfile(id)
 	if err != nil {
 		t.Fatalf("GetUserProfile failed: %v", err)
@@ -44,76 +20,45 @@ func TestGetUserProfile(t *testing.T) {
 	if profile.Name != "Test" {
 		t.Errorf("expected name 'Test', got %s", profile.Name)
 	}
+	if len(profile.DietaryPreferences) != 0 {
+		t.Errorf("expected no dietary preferences, got %v", profile.DietaryPreferences)
+	}
 }
 
-func TestUpdateUserProfile_NameAndEmail(t *testing.T) {
-	db := setupAccountTestDB(t)
-	service := account.NewService(db)
-	id := uuid.New()
-	_, err := db.Exec(`INSERT INTO users (id, email, name, password_hash) VALUES (?, ?, ?, ?)`, id.String(), "old@a.com", "OldName", "hash")
-	if err != nil {
-		t.Fatalf("insert user: %v", err)
-	}
-	newName := "NewName"
-	newEmail := "new@a.com"
-	err = service.UpdateUserProfile(id, &newName, &newEmail, nil, nil)
-	if err != nil {
-		t.Fatalf("UpdateUserProfile failed: %v", err)
-	}
-	row := db.QueryRow(`SELECT name, email FROM users WHERE id = ?`, id.String())
-	var gotName, gotEmail string
-	err = row.Scan(&gotName, &gotEmail)
+func TestUpdateProfile_NameAndEmail(t *testing.T) {
+	db := newTestDB(t, usersTable)
+	service := &account.Service{DB: db}
+	id := insertUser(t, db, "OldName")
+
+	err := service.UpdateProfile(context.Background(), id, "NewName", "new@a.com", []string{account.DietVegan})
 	if err != nil {
-		t.Fatalf("scan: %v", err)
+		t.Fatalf("UpdateProfile failed: %v", err)
 	}
-	if gotName != newName || gotEmail != newEmail {
-		t.Errorf("expected %s/%s, got %s/%s", newName, newEmail, gotName, gotEmail)
+	// nil diets leave the dietary preferences as they are.
+	if err := service.UpdateProfile(context.Background(), id, "NewName", "new@a.com", nil); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
 	}
-}
 
-func TestUpdateUserProfile_Password(t *testing.T) {
-	db := setupAccountTestDB(t)
-	service := account.NewService(db)
-	id := uuid.New()
-	oldHash, _ := utils.HashPassword("oldpass")
-	_, err := db.Exec(`INSERT INTO users (id, email, name, password_hash) VALUES (?, ?, ?, ?)`, id.String(), "a@b.com", "Name", oldHash)
-	if err != nil {
-		t.Fatalf("insert user: %v", err)
-	}
-	cur := "oldpass"
-	newp := "newpass"
-	err = service.UpdateUserProfile(id, nil, nil, &cur, &newp)
+	profile, err := service.GetUserProfile(id)
 	if err != nil {
-		t.Fatalf("UpdateUserProfile failed: %v", err)
+		t.Fatalf("GetUserProfile failed: %v", err)
 	}
-	row := db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, id.String())
-	var gotHash string
-	err = row.Scan(&gotHash)
-	if err != nil {
-		t.Fatalf("scan: %v", err)
+	if profile.Name != "NewName" || profile.Email != "new@a.com" {
+		t.Errorf("expected NewName/new@a.com, got %s/%s", profile.Name, profile.Email)
 	}
-	if err := utils.CheckPasswordHash(gotHash, newp); err != nil {
-		t.Errorf("password hash not updated correctly")
+	if len(profile.DietaryPreferences) != 1 || profile.DietaryPreferences[0] != account.DietVegan {
+		t.Errorf("expected [vegan], got %v", profile.DietaryPreferences)
 	}
 }
 
-func TestUpdateUserProfile_Errors(t *testing.T) {
-	db := setupAccountTestDB(t)
-	service := account.NewService(db)
-	id := uuid.New()
-	_, err := db.Exec(`INSERT INTO users (id, email, name, password_hash) VALUES (?, ?, ?, ?)`, id.String(), "a@b.com", "Name", "hash")
-	if err != nil {
-		t.Fatalf("insert user: %v", err)
-	}
-	// No fields
-	err = service.UpdateUserProfile(id, nil, nil, nil, nil)
-	if err == nil {
-		t.Error("expected error for no fields")
-	}
-	// Only one password field
-	cur := "x"
-	err = service.UpdateUserProfile(id, nil, nil, &cur, nil)
-	if err == nil {
-		t.Error("expected error for only one password field")
+func TestUpdateProfile_EmailTaken(t *testing.T) {
+	db := newTestDB(t, usersTable)
+	service := &account.Service{DB: db}
+	id := insertUser(t, db, "Name")
+	insertUser(t, db, "Other")
+
+	err := service.UpdateProfile(context.Background(), id, "Name", "other@example.com", nil)
+	if !errors.Is(err, account.ErrEmailExists) {
+		t.Errorf("expected ErrEmailExists, got %v", err)
 	}
 }
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/turanoo/bitebattle/internal/agentic"
+	"github.com/turanoo/bitebattle/internal/agentic/eval"
+)
+
+func replyWith(name, args string) agentic.FakeStep {
+	return agentic.FakeStep{Reply: &agentic.Message{ToolCalls: []agentic.ToolCall{{ID: "call_1", Name: name, Args: json.RawMessage(args)}}}}
+}
+
+func TestEvaluateScoresFieldsAndLocationError(t *testing.T) {
+	cases := []eval.Case{
+		{Command: "ramen near Austin", Tool: agentic.ToolCreatePoll, Args: map[string]interface{}{"food": "ramen", "location": "30.2672,-97.7431", "radius": 10000.0}},
+		{Command: "pizza in Chicago", Tool: agentic.ToolCreatePoll, Args: map[string]interface{}{"food": "pizza", "location": "41.8781,-87.6298"}},
+		{Command: "add Lucali and Joe's to lunch", Tool: agentic.ToolAddOptions, Args: map[string]interface{}{"poll": "lunch", "restaurants": []interface{}{"Lucali", "Joe's"}}},
+		{Command: "close lunch", Tool: agentic.ToolClosePoll, Args: map[string]interface{}{"poll": "lunch"}},
+	}
+	model := agentic.NewFakeModel(
+		// About 1.1 km north of the expected location.
+		replyWith(agentic.ToolCreatePoll, `{"food": "Ramen", "location": "30.2772,-97.7431", "radius": 10000}`),
+		// About 90 km off.
+		replyWith(agentic.ToolCreatePoll, `{"food": "pizza", "location": "42.6881,-87.6298", "radius": 10000}`),
+		replyWith(agentic.ToolAddOptions, `{"poll": "lunch", "restaurants": ["Joe's", "lucali"]}`),
+		replyWith(agentic.ToolSummarizePoll, `{"poll": "lunch"}`),
+	)
+
+	report := eval.Evaluate(context.Background(), "fake", model, cases, 5)
+	if report.Cases != 4 || report.ExactMatches != 2 {
+		t.Errorf("expected 2 of 4 exact matches, got %d of %d: %+v", report.ExactMatches, report.Cases, report.Results)
+	}
+	want := map[string][2]int{"tool": {3, 4}, "valid": {4, 4}, "food": {2, 2}, "location": {1, 2}, "radius": {1, 1}, "poll": {1, 2}, "restaurants": {1, 1}}
+	for field, w := range want {
+		s := report.Fields[field]
+		if s == nil || s.Correct != w[0] || s.Total != w[1] {
+			t.Errorf("%s: expected %d of %d correct, got %+v", field, w[0], w[1], s)
+		}
+	}
+	if report.Location.Count != 2 || math.Abs(report.Location.MaxKM-90) > 1 || math.Abs(report.Location.MedianKM-45.6) > 1 {
+		t.Errorf("unexpected location error %+v", report.Location)
+	}
+}
+
+func TestEvaluateCountsMissingLocations(t *testing.T) {
+	cases := []eval.Case{{Command: "dumplings in Atlantis", Tool: agentic.ToolCreatePoll, Args: map[string]interface{}{"location": "40.7128,-74.0060"}}}
+	model := agentic.NewFakeModel(replyWith(agentic.ToolCreatePoll, `{"food": "dumplings", "location": "", "radius": 10000}`))
+
+	report := eval.Evaluate(context.Background(), "fake", model, cases, 0)
+	if report.Location.Missing != 1 || report.Location.Count != 0 || report.Fields["location"].Correct != 0 {
+		t.Errorf("expected a missing location, got %+v", report.Location)
+	}
+	if report.Fields["valid"].Correct != 0 || report.Results[0].Error == "" {
+		t.Errorf("expected the invalid call reported, got %+v", report.Results[0])
+	}
+}
+
+func TestCompareFindsRegressions(t *testing.T) {
+	base := &eval.Report{Cases: 10, ExactMatches: 9, Fields: map[string]*eval.Score{
+		"tool": {Accuracy: 1}, "food": {Accuracy: 0.9},
+	}}
+	head := &eval.Report{Cases: 10, ExactMatches: 9, Fields: map[string]*eval.Score{
+		"tool": {Accuracy: 1}, "food": {Accuracy: 0.8}, "radius": {Accuracy: 1},
+	}}
+
+	deltas := eval.Compare(base, head)
+	if len(deltas) != 4 || deltas[0].Field != "exact_match" {
+		t.Fatalf("expected exact match and three fields, got %+v", deltas)
+	}
+	regressions := eval.Regressions(deltas)
+	if len(regressions) != 1 || regressions[0].Field != "food" || math.Abs(regressions[0].Change()+0.1) > 1e-9 {
+		t.Errorf("expected only food to regress, got %+v", regressions)
+	}
+}
+
+func TestRuleParserPassesEvalCorpus(t *testing.T) {
+	cases, err := eval.LoadCorpus("../cmd/agent-eval/corpus.json")
+	if err != nil {
+		t.Fatalf("failed to load corpus: %v", err)
+	}
+	report := eval.Evaluate(context.Background(), agentic.BackendRules, agentic.NewRuleParser(nil), cases, 0)
+	if rate := report.ExactMatchRate(); rate < 0.9 {
+		t.Errorf("expected at least 90%% exact matches, got %.1f%%: %+v", 100*rate, report.Results)
+	}
+	if report.Fields["tool"].Accuracy < 1 {
+		t.Errorf("expected every tool right, got %+v", report.Fields["tool"])
+	}
+}
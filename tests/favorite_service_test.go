@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/internal/favorite"
+	"github.com/turanoo/bitebattle/internal/poll"
+)
+
+func newFavoriteService(t *testing.T) (*favorite.Service, *poll.Service, uuid.UUID) {
+	db := newTestDB(t, usersTable, pollsTables, favoritesTables)
+	polls := poll.NewService(db, nil)
+	return favorite.NewService(db, polls), polls, insertUser(t, db, "Ana")
+}
+
+func TestFavorites(t *testing.T) {
+	service, _, userID := newFavoriteService(t)
+
+	if _, err := service.SaveRestaurant(userID, "a", "Alpha", ""); err != nil {
+		t.Fatalf("SaveRestaurant failed: %v", err)
+	}
+	// Saving again updates the favorite instead of failing.
+	if _, err := service.SaveRestaurant(userID, "a", "Alpha Bistro", "/img/a"); err != nil {
+		t.Fatalf("SaveRestaurant failed: %v", err)
+	}
+	if _, err := service.SaveRestaurant(userID, "b", "Bravo", ""); err != nil {
+		t.Fatalf("SaveRestaurant failed: %v", err)
+	}
+
+	favorites, err := service.GetFavorites(userID)
+	if err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+	if len(favorites) != 2 {
+		t.Fatalf("expected 2 favorites, got %d", len(favorites))
+	}
+	for _, f := range favorites {
+		if f.RestaurantID == "a" && (f.Name != "Alpha Bistro" || f.ImageURL != "/img/a") {
+			t.Errorf("expected the favorite to be updated, got %+v", f)
+		}
+	}
+
+	if err := service.RemoveFavorite(userID, "a"); err != nil {
+		t.Fatalf("RemoveFavorite failed: %v", err)
+	}
+	if err := service.RemoveFavorite(userID, "a"); !errors.Is(err, favorite.ErrFavoriteNotFound) {
+		t.Errorf("expected ErrFavoriteNotFound, got %v", err)
+	}
+}
+
+func TestLists(t *testing.T) {
+	service, _, userID := newFavoriteService(t)
+
+	list, err := service.CreateList(userID, "Date night")
+	if err != nil {
+		t.Fatalf("CreateList failed: %v", err)
+	}
+	if _, err := service.CreateList(userID, "Date night"); !errors.Is(err, favorite.ErrListNameTaken) {
+		t.Errorf("expected ErrListNameTaken, got %v", err)
+	}
+	other, err := service.CreateList(userID, "Lunch")
+	if err != nil {
+		t.Fatalf("CreateList failed: %v", err)
+	}
+	if _, err := service.RenameList(userID, other.ID, "Date night"); !errors.Is(err, favorite.ErrListNameTaken) {
+		t.Errorf("expected ErrListNameTaken on rename, got %v", err)
+	}
+	if _, err := service.RenameList(userID, other.ID, "Quick lunch"); err != nil {
+		t.Fatalf("RenameList failed: %v", err)
+	}
+
+	if _, err := service.AddToList(userID, list.ID, "a", "Alpha", ""); err != nil {
+		t.Fatalf("AddToList failed: %v", err)
+	}
+	if _, err := service.AddToList(userID, list.ID, "b", "Bravo", ""); err != nil {
+		t.Fatalf("AddToList failed: %v", err)
+	}
+	if err := service.RemoveFromList(userID, list.ID, "a"); err != nil {
+		t.Fatalf("RemoveFromList failed: %v", err)
+	}
+	if err := service.RemoveFromList(userID, list.ID, "a"); !errors.Is(err, favorite.ErrFavoriteNotFound) {
+		t.Errorf("expected ErrFavoriteNotFound, got %v", err)
+	}
+
+	got, err := service.GetList(userID, list.ID)
+	if err != nil {
+		t.Fatalf("GetList failed: %v", err)
+	}
+	if len(got.Restaurants) != 1 || got.Restaurants[0].RestaurantID != "b" {
+		t.Errorf("expected only Bravo in the list, got %+v", got.Restaurants)
+	}
+
+	lists, err := service.GetLists(userID)
+	if err != nil {
+		t.Fatalf("GetLists failed: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Errorf("expected 2 lists, got %d", len(lists))
+	}
+
+	// Lists are private to their owner.
+	if _, err := service.GetList(uuid.New(), list.ID); !errors.Is(err, favorite.ErrListNotFound) {
+		t.Errorf("expected ErrListNotFound for another user, got %v", err)
+	}
+	if err := service.DeleteList(userID, list.ID); err != nil {
+		t.Fatalf("DeleteList failed: %v", err)
+	}
+	if _, err := service.GetList(userID, list.ID); !errors.Is(err, favorite.ErrListNotFound) {
+		t.Errorf("expected ErrListNotFound after delete, got %v", err)
+	}
+}
+
+func TestAddToListFull(t *testing.T) {
+	service, _, userID := newFavoriteService(t)
+	list, err := service.CreateList(userID, "Everything")
+	if err != nil {
+		t.Fatalf("CreateList failed: %v", err)
+	}
+	for i := 0; i < favorite.MaxListItems; i++ {
+		if _, err := service.AddToList(userID, list.ID, fmt.Sprint(i), fmt.Sprint("Restaurant ", i), ""); err != nil {
+			t.Fatalf("AddToList %d failed: %v", i, err)
+		}
+	}
+	if _, err := service.AddToList(userID, list.ID, "one-more", "One more", ""); !errors.Is(err, favorite.ErrListFull) {
+		t.Errorf("expected ErrListFull, got %v", err)
+	}
+}
+
+func TestAddListToPoll(t *testing.T) {
+	service, polls, userID := newFavoriteService(t)
+	list, err := service.CreateList(userID, "Pizza")
+	if err != nil {
+		t.Fatalf("CreateList failed: %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, err := service.AddToList(userID, list.ID, id, "Restaurant "+id, ""); err != nil {
+			t.Fatalf("AddToList failed: %v", err)
+		}
+	}
+
+	p, err := polls.CreatePoll("Friday", userID)
+	if err != nil {
+		t.Fatalf("CreatePoll failed: %v", err)
+	}
+	if _, err := polls.AddOption(p.ID, "a", "Restaurant a", "", ""); err != nil {
+		t.Fatalf("AddOption failed: %v", err)
+	}
+
+	result, err := service.AddListToPoll(userID, list.ID, p.ID)
+	if err != nil {
+		t.Fatalf("AddListToPoll failed: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0].RestaurantID != "b" {
+		t.Errorf("expected only b to be added, got %+v", result.Added)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "a" {
+		t.Errorf("expected a to be skipped, got %v", result.Skipped)
+	}
+
+	if _, err := service.AddListToPoll(uuid.New(), list.ID, p.ID); !errors.Is(err, favorite.ErrListNotFound) {
+		t.Errorf("expected ErrListNotFound for another user's list, got %v", err)
+	}
+
+	closed, err := polls.CreatePoll("Closed", userID)
+	if err != nil {
+		t.Fatalf("CreatePoll failed: %v", err)
+	}
+	if _, err := polls.ClosePoll(closed.ID, userID); err != nil {
+		t.Fatalf("ClosePoll failed: %v", err)
+	}
+	if _, err := service.AddListToPoll(userID, list.ID, closed.ID); !errors.Is(err, poll.ErrPollClosed) {
+		t.Errorf("expected ErrPollClosed, got %v", err)
+	}
+}
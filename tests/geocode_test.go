@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/turanoo/bitebattle/internal/geocode"
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+func TestGazetteerGeocode(t *testing.T) {
+	g := geocode.NewGazetteer()
+	cases := []struct {
+		text string
+		want geo.Point
+		kind string
+	}{
+		{"Austin", geo.Point{Lat: 30.2672, Lng: -97.7431}, geocode.KindCity},
+		{"austin, mn", geo.Point{Lat: 43.6666, Lng: -92.9746}, geocode.KindCity},
+		{"Portland, Maine", geo.Point{Lat: 43.6591, Lng: -70.2568}, geocode.KindCity},
+		{"San Francisco CA", geo.Point{Lat: 37.7749, Lng: -122.4194}, geocode.KindCity},
+		{"Seattle, Washington", geo.Point{Lat: 47.6062, Lng: -122.3321}, geocode.KindCity},
+		{"94107", geo.Point{Lat: 37.7621, Lng: -122.3971}, geocode.KindZip},
+		{"500 Boston Ave, Austin, TX", geo.Point{Lat: 30.2672, Lng: -97.7431}, geocode.KindAddress},
+		{"37.7749, -122.4194", geo.Point{Lat: 37.7749, Lng: -122.4194}, geocode.KindCoordinates},
+	}
+	for _, tc := range cases {
+		res, err := g.Geocode(context.Background(), tc.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.text, err)
+			continue
+		}
+		if math.Abs(res.Location.Lat-tc.want.Lat) > 1e-4 || math.Abs(res.Location.Lng-tc.want.Lng) > 1e-4 {
+			t.Errorf("%q: expected %v, got %v (%s)", tc.text, tc.want, res.Location, res.Name)
+		}
+		if res.Kind != tc.kind {
+			t.Errorf("%q: expected kind %s, got %s", tc.text, tc.kind, res.Kind)
+		}
+	}
+}
+
+func TestGazetteerRejectsUnknownAndInvalid(t *testing.T) {
+	g := geocode.NewGazetteer()
+	if _, err := g.Geocode(context.Background(), "Atlantis"); !errors.Is(err, geocode.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	for _, text := range []string{"", "   ", "line\nbreak"} {
+		if _, err := g.Geocode(context.Background(), text); !errors.Is(err, geocode.ErrInvalidQuery) {
+			t.Errorf("%q: expected ErrInvalidQuery, got %v", text, err)
+		}
+	}
+}
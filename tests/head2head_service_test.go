@@ -1,5 +1,469 @@
 package tests
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/turanoo/bitebattle/internal/head2head"
+	"github.com/turanoo/bitebattle/internal/notification"
+	"github.com/turanoo/bitebattle/internal/restaurant"
+	"github.com/turanoo/bitebattle/internal/user"
 )
+
+func newHead2HeadService(t *testing.T) (*head2head.Service, *sql.DB) {
+	db := newTestDB(t, usersTable, notificationsTable, head2headTables, restaurantsTable)
+	notifier := notification.NewNotifier(notification.NewService(db, notification.NewHub()))
+	return head2head.NewService(db, nil, notifier, user.NewService(db)), db
+}
+
+// startMatch creates an active match between the players, with the first as
+// the inviter, and records their swipes: restaurant ID to whether each
+// player, in order, liked it.
+func startMatch(t *testing.T, service *head2head.Service, players []uuid.UUID, categories []string, swipes map[string][]bool) *head2head.Match {
+	t.Helper()
+	match, err := service.CreateMatch(players[0], players[1:], head2head.MatchOptions{Categories: categories})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+	for _, p := range players[1:] {
+		if err := service.AcceptMatch(match.ID, p); err != nil {
+			t.Fatalf("AcceptMatch failed: %v", err)
+		}
+	}
+	for restaurantID, likes := range swipes {
+		for i, liked := range likes {
+			if _, err := service.SubmitSwipe(match.ID, players[i], restaurantID, "Restaurant "+restaurantID, liked, false); err != nil {
+				t.Fatalf("SubmitSwipe failed: %v", err)
+			}
+		}
+	}
+	return match
+}
+
+func matchStatus(t *testing.T, db *sql.DB, matchID uuid.UUID) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow(`SELECT status FROM head2head_matches WHERE id = $1`, matchID).Scan(&status); err != nil {
+		t.Fatalf("failed to read match status: %v", err)
+	}
+	return status
+}
+
+func TestRequiredLikes(t *testing.T) {
+	cases := []struct {
+		consensus string
+		k         int
+		players   int
+		want      int
+	}{
+		{head2head.ConsensusUnanimous, 0, 2, 2},
+		{head2head.ConsensusUnanimous, 0, 5, 5},
+		{head2head.ConsensusMajority, 0, 4, 3},
+		{head2head.ConsensusMajority, 0, 5, 3},
+		{head2head.ConsensusKOfN, 2, 6, 2},
+		{head2head.ConsensusKOfN, 6, 3, 3},
+	}
+	for _, tc := range cases {
+		got := head2head.RequiredLikes(tc.consensus, tc.k, tc.players)
+		if got != tc.want {
+			t.Errorf("RequiredLikes(%s, %d, %d) = %d, want %d", tc.consensus, tc.k, tc.players, got, tc.want)
+		}
+	}
+}
+
+func TestRankResultsWeightsSuperLikes(t *testing.T) {
+	results := head2head.RankResults([]head2head.RestaurantResult{
+		{RestaurantID: "a", RestaurantName: "Alpha", Likes: 2},
+		{RestaurantID: "b", RestaurantName: "Bravo", Likes: 1, SuperLikes: 1},
+		{RestaurantID: "c", RestaurantName: "Charlie", Likes: 1, Dislikes: 1},
+	}, 2)
+
+	if results[0].RestaurantID != "b" || results[0].Score != 3 {
+		t.Errorf("expected super-liked restaurant first with score 3, got %+v", results[0])
+	}
+	if !results[1].Consensus || results[1].RestaurantID != "a" {
+		t.Errorf("expected Alpha to reach consensus, got %+v", results[1])
+	}
+	if results[2].Score != 0 {
+		t.Errorf("expected like and dislike to cancel out, got %d", results[2].Score)
+	}
+}
+
+func TestBestCompromise(t *testing.T) {
+	results := head2head.RankResults([]head2head.RestaurantResult{
+		{RestaurantID: "a", RestaurantName: "Alpha", Likes: 2, SuperLikes: 1, Dislikes: 2},
+		{RestaurantID: "b", RestaurantName: "Bravo", Likes: 1, Dislikes: 0},
+		{RestaurantID: "c", RestaurantName: "Charlie", Likes: 0, Dislikes: 0},
+	}, 3)
+
+	best := head2head.BestCompromise(results)
+	if best == nil || best.RestaurantID != "b" {
+		t.Fatalf("expected Bravo as the compromise, got %+v", best)
+	}
+
+	if head2head.BestCompromise(nil) != nil {
+		t.Error("expected no compromise without likes")
+	}
+}
+
+func TestDeclineMatch(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	inviter := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+	cat := insertUser(t, db, "Cat")
+
+	match, err := service.CreateMatch(inviter, []uuid.UUID{ben, cat}, head2head.MatchOptions{Categories: []string{"pizza"}})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+
+	if err := service.DeclineMatch(match.ID, ben); err != nil {
+		t.Fatalf("DeclineMatch failed: %v", err)
+	}
+	if err := service.AcceptMatch(match.ID, ben); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected a declined player not to be able to accept, got %v", err)
+	}
+	if err := service.DeclineMatch(match.ID, inviter); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the inviter not to be able to decline, got %v", err)
+	}
+	if status := matchStatus(t, db, match.ID); status != "pending" {
+		t.Errorf("expected the match to wait for Cat, got %s", status)
+	}
+
+	if err := service.DeclineMatch(match.ID, cat); err != nil {
+		t.Fatalf("DeclineMatch failed: %v", err)
+	}
+	if status := matchStatus(t, db, match.ID); status != "cancelled" {
+		t.Errorf("expected the match to be cancelled once everyone declined, got %s", status)
+	}
+
+	got, err := service.GetMatch(match.ID, inviter)
+	if err != nil {
+		t.Fatalf("GetMatch failed: %v", err)
+	}
+	for _, p := range got.Participants {
+		if p.UserID != inviter && p.Status != head2head.ParticipantDeclined {
+			t.Errorf("expected %s to have declined, got %s", p.UserID, p.Status)
+		}
+	}
+}
+
+func TestSubmitSwipeSpendsSuperLikeBudget(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	inviter := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+
+	match, err := service.CreateMatch(inviter, []uuid.UUID{ben}, head2head.MatchOptions{Categories: []string{"pizza"}, SuperLikeBudget: 1})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+	if err := service.AcceptMatch(match.ID, ben); err != nil {
+		t.Fatalf("AcceptMatch failed: %v", err)
+	}
+
+	swipe, err := service.SubmitSwipe(match.ID, ben, "a", "Alpha", false, true)
+	if err != nil {
+		t.Fatalf("SubmitSwipe failed: %v", err)
+	}
+	if !swipe.Liked || !swipe.SuperLike {
+		t.Errorf("expected a super-like to count as a like, got %+v", swipe.Swipe)
+	}
+	// Super-liking the same restaurant again replaces the swipe rather than
+	// spending more of the budget.
+	if _, err := service.SubmitSwipe(match.ID, ben, "a", "Alpha", true, true); err != nil {
+		t.Errorf("expected to be able to repeat a super-like, got %v", err)
+	}
+	if _, err := service.SubmitSwipe(match.ID, ben, "b", "Bravo", true, true); !errors.Is(err, head2head.ErrSuperLikeBudgetExceeded) {
+		t.Errorf("expected ErrSuperLikeBudgetExceeded, got %v", err)
+	}
+	if _, err := service.SubmitSwipe(match.ID, ben, "b", "Bravo", true, false); err != nil {
+		t.Errorf("expected a plain like to need no budget, got %v", err)
+	}
+}
+
+func TestGetPairStats(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	ana := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+	cat := insertUser(t, db, "Cat")
+	pair := []uuid.UUID{ana, ben}
+	if _, err := db.Exec(`INSERT INTO restaurants (place_id, name, types) VALUES
+		('a', 'Alpha', '{pizza_restaurant,restaurant,food}'), ('c', 'Charlie', '{sushi_restaurant,japanese_restaurant}')`); err != nil {
+		t.Fatalf("failed to store restaurants: %v", err)
+	}
+
+	startMatch(t, service, pair, []string{"pizza"}, map[string][]bool{
+		"a": {true, true},
+		"b": {true, true},
+		"c": {true, false},
+	})
+	startMatch(t, service, pair, []string{"pizza", "sushi"}, map[string][]bool{
+		"a": {true, true},
+		"c": {true, true},
+	})
+	// Ben never joined this one, so it only counts for Ana and Cat.
+	pending, err := service.CreateMatch(ana, []uuid.UUID{ben, cat}, head2head.MatchOptions{Categories: []string{"tacos"}})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+	if err := service.AcceptMatch(pending.ID, cat); err != nil {
+		t.Fatalf("AcceptMatch failed: %v", err)
+	}
+
+	stats, err := service.GetPairStats(ana, ben)
+	if err != nil {
+		t.Fatalf("GetPairStats failed: %v", err)
+	}
+	if stats.MatchesPlayed != 2 || stats.MutualLikes != 4 {
+		t.Errorf("expected 2 matches and 4 mutual likes, got %d and %d", stats.MatchesPlayed, stats.MutualLikes)
+	}
+	// Bravo has no stored types, so it takes the pizza match's category;
+	// Charlie counts for its own cuisines rather than pizza.
+	want := []head2head.CuisineCount{{Cuisine: "pizza", MutualLikes: 3}, {Cuisine: "japanese", MutualLikes: 1}, {Cuisine: "sushi", MutualLikes: 1}}
+	if !reflect.DeepEqual(stats.TopCuisines, want) {
+		t.Errorf("expected top cuisines %v, got %v", want, stats.TopCuisines)
+	}
+	// Bravo came up once and Charlie was disliked once, so only Alpha counts.
+	if len(stats.AlwaysAgree) != 1 || stats.AlwaysAgree[0].RestaurantID != "a" || stats.AlwaysAgree[0].Matches != 2 {
+		t.Errorf("expected to always agree on a in 2 matches, got %+v", stats.AlwaysAgree)
+	}
+
+	withCat, err := service.GetPairStats(ana, cat)
+	if err != nil {
+		t.Fatalf("GetPairStats failed: %v", err)
+	}
+	if withCat.MatchesPlayed != 1 || withCat.MutualLikes != 0 || len(withCat.AlwaysAgree) != 0 {
+		t.Errorf("expected one match and no swipes with Cat, got %+v", withCat)
+	}
+
+	if _, err := service.GetPairStats(ana, ana); !errors.Is(err, head2head.ErrSelfStats) {
+		t.Errorf("expected ErrSelfStats for a user's stats with themselves, got %v", err)
+	}
+}
+
+func TestRematch(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	ana := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+	cat := insertUser(t, db, "Cat")
+	dan := insertUser(t, db, "Dan")
+
+	original, err := service.CreateMatch(ana, []uuid.UUID{ben, cat, dan}, head2head.MatchOptions{
+		Categories:      []string{"pizza"},
+		Consensus:       head2head.ConsensusKOfN,
+		ConsensusK:      2,
+		SuperLikeBudget: 1,
+	})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+	if err := service.AcceptMatch(original.ID, ben); err != nil {
+		t.Fatalf("AcceptMatch failed: %v", err)
+	}
+	if err := service.DeclineMatch(original.ID, dan); err != nil {
+		t.Fatalf("DeclineMatch failed: %v", err)
+	}
+
+	if _, err := service.Rematch(original.ID, cat, nil); !errors.Is(err, head2head.ErrNotParticipant) {
+		t.Errorf("expected a player who never joined not to start a rematch, got %v", err)
+	}
+	if _, err := service.Rematch(original.ID, dan, nil); !errors.Is(err, head2head.ErrNotParticipant) {
+		t.Errorf("expected a player who declined not to start a rematch, got %v", err)
+	}
+
+	rematch, err := service.Rematch(original.ID, ben, []string{"sushi"})
+	if err != nil {
+		t.Fatalf("Rematch failed: %v", err)
+	}
+	if rematch.ID == original.ID || rematch.InviterID != ben || rematch.Status != "pending" {
+		t.Errorf("expected a new pending match from Ben, got %+v", rematch)
+	}
+	if rematch.Consensus != head2head.ConsensusKOfN || rematch.ConsensusK != 2 || rematch.SuperLikeBudget != 1 {
+		t.Errorf("expected the original rules, got %s/%d/%d", rematch.Consensus, rematch.ConsensusK, rematch.SuperLikeBudget)
+	}
+	if len(rematch.Categories) != 1 || rematch.Categories[0] != "sushi" {
+		t.Errorf("expected the new categories, got %v", rematch.Categories)
+	}
+	statuses := map[uuid.UUID]string{}
+	for _, p := range rematch.Participants {
+		statuses[p.UserID] = p.Status
+	}
+	want := map[uuid.UUID]string{ben: head2head.ParticipantAccepted, ana: head2head.ParticipantInvited, cat: head2head.ParticipantInvited}
+	if len(statuses) != len(want) {
+		t.Errorf("expected Dan to be left out, got %v", statuses)
+	}
+	for id, status := range want {
+		if statuses[id] != status {
+			t.Errorf("expected %s to be %s, got %q", id, status, statuses[id])
+		}
+	}
+}
+
+func TestInviteByEmail(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	ana := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+
+	ids, err := service.ResolveInviteeEmails(context.Background(), []string{"ben@example.com", " nobody@example.com "})
+	if err != nil {
+		t.Fatalf("ResolveInviteeEmails failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != ben {
+		t.Fatalf("expected only Ben to be resolved, got %v", ids)
+	}
+
+	match, err := service.CreateMatch(ana, nil, head2head.MatchOptions{Categories: []string{"pizza"}, InviteLink: true, EmailInvitees: ids})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+	if match.Invite == nil || match.Invite.MatchID != match.ID {
+		t.Fatalf("expected an invite link for the match, got %+v", match.Invite)
+	}
+	preview, err := service.PreviewInvite(match.Invite.Token)
+	if err != nil {
+		t.Fatalf("PreviewInvite failed: %v", err)
+	}
+	if preview.InviterName != "Ana" || preview.Players != 1 {
+		t.Errorf("expected Ana's match with 1 player, got %+v", preview)
+	}
+
+	// Ana can't tell Ben has an account until he joins; Ben sees his invite.
+	if len(match.Participants) != 1 {
+		t.Errorf("expected Ben hidden from the new match, got %+v", match.Participants)
+	}
+	if got, err := service.GetMatch(match.ID, ana); err != nil || len(got.Participants) != 1 {
+		t.Errorf("expected Ben hidden from Ana, got %+v, %v", got, err)
+	}
+	if got, err := service.GetMatch(match.ID, ben); err != nil || len(got.Participants) != 2 {
+		t.Errorf("expected Ben to see his invite, got %+v, %v", got, err)
+	}
+	if err := service.AcceptMatch(match.ID, ben); err != nil {
+		t.Fatalf("AcceptMatch failed: %v", err)
+	}
+	if got, err := service.GetMatch(match.ID, ana); err != nil || len(got.Participants) != 2 {
+		t.Errorf("expected Ben shown once he joined, got %+v, %v", got, err)
+	}
+
+	// Nobody registered: the match still starts, with only the link.
+	match, err = service.CreateMatch(ana, nil, head2head.MatchOptions{Categories: []string{"pizza"}, InviteLink: true})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+	if match.Invite == nil || len(match.Participants) != 1 {
+		t.Errorf("expected a link-only match, got %+v", match)
+	}
+}
+
+func TestClaimInviteRespectsPlayerCap(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	ana := insertUser(t, db, "Ana")
+	var invitees []uuid.UUID
+	for i := 1; i < head2head.MaxPlayers; i++ {
+		invitees = append(invitees, insertUser(t, db, fmt.Sprint("Player", i)))
+	}
+	match, err := service.CreateMatch(ana, invitees, head2head.MatchOptions{Categories: []string{"pizza"}, InviteLink: true})
+	if err != nil {
+		t.Fatalf("CreateMatch failed: %v", err)
+	}
+
+	// Once a player declines, their seat goes to someone with the link.
+	if err := service.DeclineMatch(match.ID, invitees[0]); err != nil {
+		t.Fatalf("DeclineMatch failed: %v", err)
+	}
+	if _, err := service.ClaimInvite(match.Invite.Token, insertUser(t, db, "Zed")); err != nil {
+		t.Fatalf("ClaimInvite failed: %v", err)
+	}
+
+	invite, err := service.CreateInvite(match.ID, ana)
+	if err != nil {
+		t.Fatalf("CreateInvite failed: %v", err)
+	}
+	if _, err := service.ClaimInvite(invite.Token, invitees[0]); !errors.Is(err, head2head.ErrTooManyPlayers) {
+		t.Errorf("expected the declined player to find the match full, got %v", err)
+	}
+	// Invited players still have their seat.
+	if _, err := service.ClaimInvite(invite.Token, invitees[1]); err != nil {
+		t.Errorf("expected an invited player to claim the link, got %v", err)
+	}
+}
+
+func TestResultsCarryStoredRestaurantDetails(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	ana := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+	price := 1
+	err := restaurant.NewStore(db).Save(context.Background(), &restaurant.PlaceDetails{
+		Place:     restaurant.Place{PlaceID: "a", Name: "Alpha", Address: "1 Main St", PriceLevel: &price, Types: []string{"pizza"}},
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	match := startMatch(t, service, []uuid.UUID{ana, ben}, []string{"pizza"}, map[string][]bool{"b": {true, true}})
+	if _, err := service.SubmitSwipe(match.ID, ana, "a", "Alpha", true, false); err != nil {
+		t.Fatalf("SubmitSwipe failed: %v", err)
+	}
+	swipe, err := service.SubmitSwipe(match.ID, ben, "a", "Alpha", true, false)
+	if err != nil {
+		t.Fatalf("SubmitSwipe failed: %v", err)
+	}
+	if !swipe.IsMatch || swipe.Match.Restaurant == nil || swipe.Match.Restaurant.Address != "1 Main St" {
+		t.Errorf("expected the match card to carry the stored details, got %+v", swipe.Match)
+	}
+
+	results, err := service.GetResults(match.ID, ana)
+	if err != nil {
+		t.Fatalf("GetResults failed: %v", err)
+	}
+	for _, r := range results.Restaurants {
+		switch r.RestaurantID {
+		case "a":
+			if r.Restaurant == nil || *r.Restaurant.PriceLevel != 1 || len(r.Restaurant.Types) != 1 {
+				t.Errorf("expected the stored details of Alpha, got %+v", r.Restaurant)
+			}
+		case "b":
+			if r.Restaurant != nil {
+				t.Errorf("expected no details for a restaurant never stored, got %+v", r.Restaurant)
+			}
+		}
+	}
+}
+
+func TestConsensusNotifiesOnce(t *testing.T) {
+	service, db := newHead2HeadService(t)
+	ana := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+	cat := insertUser(t, db, "Cat")
+	match := startMatch(t, service, []uuid.UUID{ana, ben, cat}, []string{"pizza"}, map[string][]bool{"a": {true, true}})
+
+	result, err := service.SubmitSwipe(match.ID, cat, "a", "Alpha", true, false)
+	if err != nil {
+		t.Fatalf("SubmitSwipe failed: %v", err)
+	}
+	if !result.IsMatch || result.Match.Likes != 3 {
+		t.Errorf("expected the last like to reach consensus, got %+v", result)
+	}
+	again, err := service.SubmitSwipe(match.ID, cat, "a", "Alpha", true, false)
+	if err != nil {
+		t.Fatalf("SubmitSwipe failed: %v", err)
+	}
+	if again.IsMatch {
+		t.Error("expected repeating a like not to reach consensus again")
+	}
+
+	var sent int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE message LIKE 'It''s a match!%'`).Scan(&sent); err != nil {
+		t.Fatalf("failed to count notifications: %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("expected Ana and Ben to be notified once each, got %d notifications", sent)
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/turanoo/bitebattle/pkg/httpclient"
+)
+
+func newFlakyServer(failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return srv, &calls
+}
+
+func TestClientRetriesTransientFailures(t *testing.T) {
+	srv, calls := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client := httpclient.New(httpclient.Options{MaxRetries: 2, BaseDelay: time.Millisecond})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("expected success on the third call, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	srv, calls := newFlakyServer(1, http.StatusBadRequest)
+	defer srv.Close()
+
+	client := httpclient.New(httpclient.Options{MaxRetries: 2, BaseDelay: time.Millisecond})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || calls.Load() != 1 {
+		t.Errorf("expected a single 400, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestClientTimesOutSlowCalls(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	client := httpclient.New(httpclient.Options{Timeout: 20 * time.Millisecond, MaxRetries: -1})
+	start := time.Now()
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the call to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	srv, calls := newFlakyServer(3, http.StatusInternalServerError)
+	defer srv.Close()
+
+	client := httpclient.New(httpclient.Options{
+		MaxRetries: -1, BreakerThreshold: 3, BreakerCooldown: 50 * time.Millisecond,
+	})
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected no call while the circuit is open, got %d calls", calls.Load())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the probe to go through, got %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the probe to succeed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,448 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/turanoo/bitebattle/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// pgSQLiteDriver runs the services' Postgres queries against SQLite. It
+// rewrites the bits of Postgres syntax the services use, and reports unique
+// violations as *pq.Error so that services see the errors they would in
+// production.
+const pgSQLiteDriver = "sqlite3_pg"
+
+func init() {
+	sql.Register(pgSQLiteDriver, &pgDriver{sqlite: &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("now", func() string {
+				return time.Now().Format(sqlite3.SQLiteTimestampFormats[0])
+			}, false); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("pg_advisory_xact_lock", func(int64) int64 { return 0 }, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("hashtext", func(s string) int64 { return int64(len(s)) }, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("pg_array", pgArrayToJSON, true)
+		},
+	}})
+}
+
+// SQLite versions of the tables in migrations/, for newTestDB.
+const (
+	usersTable = `CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		email TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		password_hash TEXT NOT NULL,
+		phone_number TEXT UNIQUE,
+		profile_pic_url TEXT,
+		bio TEXT,
+		last_login_at TEXT,
+		dietary_preferences TEXT NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+	pollsTables = `CREATE TABLE polls (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		invite_code TEXT UNIQUE NOT NULL,
+		created_by TEXT NOT NULL REFERENCES users(id),
+		is_active BOOLEAN DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE polls_members (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		poll_id TEXT NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (poll_id, user_id)
+	);
+	CREATE TABLE poll_options (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		poll_id TEXT NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		restaurant_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		image_url TEXT,
+		menu_url TEXT,
+		UNIQUE (poll_id, restaurant_id)
+	);
+	CREATE TABLE poll_votes (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		poll_id TEXT NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		option_id TEXT NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (poll_id, user_id, option_id)
+	)`
+	notificationsTable = `CREATE TABLE notifications (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		message TEXT NOT NULL,
+		read BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL
+	)`
+	head2headTables = `CREATE TABLE head2head_matches (
+		id TEXT PRIMARY KEY,
+		inviter_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		status TEXT NOT NULL CHECK (status IN ('pending', 'active', 'completed', 'cancelled')),
+		categories TEXT NOT NULL,
+		consensus TEXT NOT NULL DEFAULT 'unanimous',
+		consensus_k INT,
+		super_like_budget INT NOT NULL DEFAULT 3 CHECK (super_like_budget >= 0),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE head2head_participants (
+		match_id TEXT NOT NULL REFERENCES head2head_matches(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		status TEXT NOT NULL CHECK (status IN ('invited', 'accepted', 'declined')),
+		joined_at TIMESTAMP,
+		invited_by_email BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (match_id, user_id)
+	);
+	CREATE TABLE head2head_swipes (
+		id TEXT PRIMARY KEY,
+		match_id TEXT NOT NULL REFERENCES head2head_matches(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		restaurant_id TEXT NOT NULL,
+		restaurant_name TEXT NOT NULL,
+		liked BOOLEAN NOT NULL,
+		super_like BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (match_id, user_id, restaurant_id)
+	);
+	CREATE TABLE head2head_invites (
+		token TEXT PRIMARY KEY,
+		match_id TEXT NOT NULL REFERENCES head2head_matches(id) ON DELETE CASCADE,
+		created_by TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL,
+		claimed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		claimed_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	restaurantsTable = `CREATE TABLE restaurants (
+		place_id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		address TEXT NOT NULL DEFAULT '',
+		lat DOUBLE PRECISION,
+		lng DOUBLE PRECISION,
+		rating DOUBLE PRECISION,
+		user_ratings_total INTEGER NOT NULL DEFAULT 0,
+		price_level INTEGER CHECK (price_level BETWEEN 0 AND 4),
+		phone TEXT NOT NULL DEFAULT '',
+		website TEXT NOT NULL DEFAULT '',
+		types TEXT NOT NULL DEFAULT '{}',
+		hours TEXT NOT NULL DEFAULT '{}',
+		review_summary TEXT NOT NULL DEFAULT '',
+		photo_reference TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	favoritesTables = `CREATE TABLE favorite_restaurants (
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		restaurant_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		image_url TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, restaurant_id)
+	);
+	CREATE TABLE favorite_lists (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	);
+	CREATE TABLE favorite_list_items (
+		list_id TEXT NOT NULL REFERENCES favorite_lists(id) ON DELETE CASCADE,
+		restaurant_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		image_url TEXT NOT NULL DEFAULT '',
+		added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (list_id, restaurant_id)
+	)`
+	visitsTable = `CREATE TABLE visits (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		restaurant_id TEXT NOT NULL,
+		restaurant_name TEXT NOT NULL,
+		visited_on DATE NOT NULL,
+		poll_id TEXT REFERENCES polls(id) ON DELETE SET NULL,
+		match_id TEXT REFERENCES head2head_matches(id) ON DELETE SET NULL,
+		rating SMALLINT CHECK (rating BETWEEN 1 AND 5),
+		notes TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	agentTables = `CREATE TABLE agent_confirmations (
+		token TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		tool TEXT NOT NULL,
+		args TEXT NOT NULL,
+		message TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		claimed_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE agent_sessions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		summary TEXT NOT NULL DEFAULT '',
+		poll_id TEXT REFERENCES polls(id) ON DELETE SET NULL,
+		match_id TEXT REFERENCES head2head_matches(id) ON DELETE SET NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE agent_session_turns (
+		id TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL REFERENCES agent_sessions(id) ON DELETE CASCADE,
+		role TEXT NOT NULL CHECK (role IN ('user', 'assistant')),
+		content TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE agent_commands (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		session_id TEXT REFERENCES agent_sessions(id) ON DELETE SET NULL,
+		kind TEXT NOT NULL CHECK (kind IN ('command', 'confirmation')),
+		command TEXT NOT NULL,
+		intent TEXT NOT NULL DEFAULT '[]',
+		steps TEXT NOT NULL DEFAULT '[]',
+		action TEXT NOT NULL DEFAULT '',
+		outcome TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+)
+
+// newTestDB opens an empty database in the test's temp dir and runs the
+// schema statements against it.
+func newTestDB(t *testing.T, schema ...string) *sql.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"
+	db, err := sql.Open(pgSQLiteDriver, dsn)
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close test db: %v", err)
+		}
+	})
+	// Statements are prepared one at a time, so run them one by one.
+	for _, tables := range schema {
+		for _, stmt := range strings.Split(tables, ";") {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("failed to create schema: %v\n%s", err, stmt)
+			}
+		}
+	}
+	return db
+}
+
+// insertUser adds a user named name and returns their ID.
+func insertUser(t *testing.T, db *sql.DB, name string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	_, err := db.Exec(`INSERT INTO users (id, email, name, password_hash) VALUES ($1, $2, $3, 'hash')`,
+		id, strings.ToLower(name)+"@example.com", name)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return id
+}
+
+var pgRewrites = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`(?is)DELETE FROM (\w+) (\w+)\s+USING (\w+) (\w+)\s+WHERE (.*)$`), "DELETE FROM $1 AS $2 WHERE EXISTS (SELECT 1 FROM $3 $4 WHERE $5)"},
+	{regexp.MustCompile(`(?i)UPDATE (\w+) (\w+)\s+SET `), "UPDATE $1 AS $2 SET "},
+	{regexp.MustCompile(`\$(\d+)`), "?$1"},
+	{regexp.MustCompile(`::\w+(\[\])?`), ""},
+	{regexp.MustCompile(`(?i)=\s*ANY\((\?\d+)\)`), "IN (SELECT value FROM json_each(pg_array($1)))"},
+	{regexp.MustCompile(`(?i)FOR (UPDATE|SHARE)( OF \w+)?`), ""},
+	{regexp.MustCompile(`(?i)\bILIKE\b`), "LIKE"},
+}
+
+func rewritePostgres(query string) string {
+	for _, r := range pgRewrites {
+		query = r.pattern.ReplaceAllString(query, r.replace)
+	}
+	return query
+}
+
+// pgArrayToJSON turns a Postgres array literal such as {a,"b c"} into a JSON
+// array for json_each.
+func pgArrayToJSON(literal string) (string, error) {
+	literal = strings.TrimSpace(literal)
+	if !strings.HasPrefix(literal, "{") || !strings.HasSuffix(literal, "}") {
+		return "", fmt.Errorf("not an array literal: %q", literal)
+	}
+	items := []string{}
+	var item strings.Builder
+	quoted, escaped, started := false, false, false
+	for _, r := range literal[1 : len(literal)-1] {
+		switch {
+		case escaped:
+			item.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case r == ',' && !quoted:
+			items = append(items, item.String())
+			item.Reset()
+			started = false
+		default:
+			item.WriteRune(r)
+			started = true
+		}
+	}
+	if started || len(items) > 0 {
+		items = append(items, item.String())
+	}
+	b, err := json.Marshal(items)
+	return string(b), err
+}
+
+func pgError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+		return &pq.Error{Code: "23505", Message: sqliteErr.Error()}
+	}
+	return err
+}
+
+type pgDriver struct {
+	sqlite *sqlite3.SQLiteDriver
+}
+
+func (d *pgDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.sqlite.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// pgConn deliberately implements neither Execer nor Queryer, so that every
+// query goes through Prepare and gets rewritten.
+type pgConn struct {
+	conn *sqlite3.SQLiteConn
+}
+
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *pgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.conn.PrepareContext(ctx, rewritePostgres(query))
+	if err != nil {
+		return nil, err
+	}
+	return &pgStmt{stmt.(*sqlite3.SQLiteStmt)}, nil
+}
+
+func (c *pgConn) Close() error { return c.conn.Close() }
+
+func (c *pgConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *pgConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.BeginTx(ctx, opts)
+}
+
+type pgStmt struct {
+	stmt *sqlite3.SQLiteStmt
+}
+
+func (s *pgStmt) Close() error  { return s.stmt.Close() }
+func (s *pgStmt) NumInput() int { return s.stmt.NumInput() }
+
+func (s *pgStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.stmt.Exec(args)
+	return res, pgError(err)
+}
+
+func (s *pgStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.stmt.Query(args)
+	if err != nil {
+		return nil, pgError(err)
+	}
+	return &pgRows{rows.(*sqlite3.SQLiteRows)}, nil
+}
+
+func (s *pgStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	res, err := s.stmt.ExecContext(ctx, args)
+	return res, pgError(err)
+}
+
+func (s *pgStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.stmt.QueryContext(ctx, args)
+	if err != nil {
+		return nil, pgError(err)
+	}
+	return &pgRows{rows.(*sqlite3.SQLiteRows)}, nil
+}
+
+// pgRows parses timestamps in computed columns, such as MAX(visited_on),
+// which SQLite returns as text because they have no declared type.
+type pgRows struct {
+	rows *sqlite3.SQLiteRows
+}
+
+func (r *pgRows) Columns() []string { return r.rows.Columns() }
+func (r *pgRows) Close() error      { return r.rows.Close() }
+
+func (r *pgRows) Next(dest []driver.Value) error {
+	if err := r.rows.Next(dest); err != nil {
+		return pgError(err)
+	}
+	for i, v := range dest {
+		s, ok := v.(string)
+		if !ok || r.rows.ColumnTypeDatabaseTypeName(i) != "" {
+			continue
+		}
+		for _, layout := range sqlite3.SQLiteTimestampFormats {
+			if t, err := time.Parse(layout, s); err == nil {
+				dest[i] = t
+				break
+			}
+		}
+	}
+	return nil
+}
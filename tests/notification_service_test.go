@@ -1,5 +1,48 @@
 package tests
 
 import (
+	"testing"
+
+	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/turanoo/bitebattle/internal/notification"
 )
+
+func TestHubPublishesToSubscribedUser(t *testing.T) {
+	hub := notification.NewHub()
+	userID := uuid.New()
+	otherID := uuid.New()
+
+	events, unsubscribe := hub.Subscribe(userID)
+	defer unsubscribe()
+	otherEvents, unsubscribeOther := hub.Subscribe(otherID)
+	defer unsubscribeOther()
+
+	hub.Publish(notification.Notification{ID: uuid.New(), UserID: userID, Message: "It's a match!"})
+
+	select {
+	case n := <-events:
+		if n.Message != "It's a match!" {
+			t.Errorf("unexpected message %q", n.Message)
+		}
+	default:
+		t.Fatal("expected notification for subscribed user")
+	}
+
+	select {
+	case n := <-otherEvents:
+		t.Errorf("unexpected notification for other user: %+v", n)
+	default:
+	}
+}
+
+func TestHubUnsubscribeClosesChannel(t *testing.T) {
+	hub := notification.NewHub()
+	events, unsubscribe := hub.Subscribe(uuid.New())
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("expected channel to be closed after unsubscribe")
+	}
+}
@@ -1,22 +1,598 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	_ "image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/turanoo/bitebattle/internal/restaurant"
+	"github.com/turanoo/bitebattle/pkg/config"
+	"github.com/turanoo/bitebattle/pkg/geo"
+	"github.com/turanoo/bitebattle/pkg/httpclient"
 )
 
+const restaurantFixturePath = "../fixtures/restaurants.geojson"
+
+func newFixtureRestaurantService() *restaurant.Service {
+	cfg := &config.Config{}
+	cfg.Restaurants.Provider = restaurant.ProviderFixture
+	cfg.Restaurants.FixturePath = restaurantFixturePath
+	return restaurant.NewService(nil, cfg, nil)
+}
+
 func TestNewService(t *testing.T) {
-	svc := restaurant.NewService()
+	svc := newFixtureRestaurantService()
 	if svc == nil {
 		t.Fatal("expected non-nil service")
 	}
+	if _, ok := svc.Provider.(*restaurant.FixtureProvider); !ok {
+		t.Fatalf("expected fixture provider, got %T", svc.Provider)
+	}
 }
 
 func TestSearchRestaurants(t *testing.T) {
-	svc := restaurant.NewService()
-	_, err := svc.SearchRestaurants("pizza", "37.7749,-122.4194", "1000")
-	if err == nil {
-		t.Error("expected error due to missing Google Places API key")
+	svc := newFixtureRestaurantService()
+	places, err := svc.SearchRestaurants(context.Background(), "pizza", "37.7749,-122.4194", "5000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(places) == 0 {
+		t.Fatal("expected pizza places in San Francisco")
+	}
+	for _, p := range places {
+		if p.PlaceID == "" || p.Name == "" {
+			t.Errorf("expected place id and name, got %+v", p)
+		}
+	}
+	for _, p := range places {
+		if p.Location == nil || p.DistanceMeters == nil || *p.DistanceMeters > 5000 {
+			t.Errorf("expected coordinates and a distance within the radius, got %+v", p)
+		}
+	}
+	// Golden Gate Slice is rated 4.5 and about half as far as North Beach
+	// Trattoria at 4.6, so the blended score puts it first.
+	if places[0].PlaceID != "fixture-sf-001" {
+		t.Errorf("expected the closer of two similarly rated places first, got %s", places[0].Name)
+	}
+}
+
+func TestSearchSortByDistance(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	resp, err := svc.Search(context.Background(), restaurant.SearchParams{
+		Query: "restaurant", Location: geo.Point{Lat: 37.7749, Lng: -122.4194}, Radius: 20000, Sort: restaurant.SortDistance,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Results) < 2 {
+		t.Fatal("expected several places in San Francisco")
+	}
+	for i := 1; i < len(resp.Results); i++ {
+		if *resp.Results[i].DistanceMeters < *resp.Results[i-1].DistanceMeters {
+			t.Errorf("expected results sorted by distance, got %v before %v", *resp.Results[i-1].DistanceMeters, *resp.Results[i].DistanceMeters)
+		}
+	}
+}
+
+func TestSearchTravelTimes(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	center := geo.Point{Lat: 37.7749, Lng: -122.4194}
+	minutes := map[string]map[string]float64{}
+	for _, mode := range []string{restaurant.TravelWalking, restaurant.TravelDriving} {
+		resp, err := svc.Search(context.Background(), restaurant.SearchParams{
+			Query: "restaurant", Location: center, Radius: 20000, TravelMode: mode,
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		minutes[mode] = map[string]float64{}
+		for _, p := range resp.Results {
+			if p.TravelMinutes == nil {
+				t.Fatalf("%s: expected a travel time for %s", mode, p.Name)
+			}
+			minutes[mode][p.PlaceID] = *p.TravelMinutes
+			if mode == restaurant.TravelWalking && *p.TravelMinutes != math.Ceil(*p.DistanceMeters/80) {
+				t.Errorf("expected %s to take %v minutes on foot, got %v", p.Name, math.Ceil(*p.DistanceMeters/80), *p.TravelMinutes)
+			}
+		}
+	}
+	for id, walk := range minutes[restaurant.TravelWalking] {
+		if drive := minutes[restaurant.TravelDriving][id]; drive > walk {
+			t.Errorf("expected driving to %s to be no slower than walking, got %v and %v minutes", id, drive, walk)
+		}
+	}
+
+	_, err := svc.Search(context.Background(), restaurant.SearchParams{Query: "pizza", Location: center, Radius: 1000, TravelMode: "teleport"})
+	if !errors.Is(err, restaurant.ErrInvalidSearch) {
+		t.Errorf("expected ErrInvalidSearch for an unknown travel mode, got %v", err)
+	}
+}
+
+func TestSearchMultipleOrigins(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	origins := []geo.Point{{Lat: 37.8003, Lng: -122.4102}, {Lat: 37.7523, Lng: -122.4184}}
+
+	aggregate := map[string]func([]float64) float64{
+		restaurant.OriginModeMinMax: func(ds []float64) float64 { return math.Max(ds[0], ds[1]) },
+		restaurant.OriginModeTotal:  func(ds []float64) float64 { return ds[0] + ds[1] },
+	}
+	for mode, agg := range aggregate {
+		resp, err := svc.Search(context.Background(), restaurant.SearchParams{
+			Query: "restaurant", Location: geo.Centroid(origins), Radius: 20000,
+			Sort: restaurant.SortDistance, Origins: origins, OriginMode: mode,
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		for i, p := range resp.Results {
+			if len(p.OriginDistances) != len(origins) {
+				t.Fatalf("%s: expected a distance per origin, got %v", mode, p.OriginDistances)
+			}
+			if i > 0 && agg(p.OriginDistances) < agg(resp.Results[i-1].OriginDistances) {
+				t.Errorf("%s: %s ranked after %s despite a shorter group distance", mode, p.Name, resp.Results[i-1].Name)
+			}
+		}
+	}
+
+	tooMany := make([]geo.Point, restaurant.MaxOrigins+1)
+	_, err := svc.Search(context.Background(), restaurant.SearchParams{
+		Query: "restaurant", Location: origins[0], Radius: 1000, Origins: tooMany,
+	})
+	if !errors.Is(err, restaurant.ErrInvalidSearch) {
+		t.Errorf("expected ErrInvalidSearch for too many origins, got %v", err)
+	}
+}
+
+func TestSearchRestaurantsNearCity(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	places, err := svc.SearchRestaurants(context.Background(), "tacos", "Austin, TX", "5000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(places) == 0 || places[0].PlaceID != "fixture-au-001" {
+		t.Errorf("expected Austin tacos, got %+v", places)
+	}
+
+	if _, err := svc.ResolveLocation(context.Background(), "", ""); !errors.Is(err, restaurant.ErrInvalidSearch) {
+		t.Errorf("expected a missing location to be rejected, got %v", err)
+	}
+	if _, err := svc.ResolveLocation(context.Background(), "91,0", ""); !errors.Is(err, restaurant.ErrInvalidSearch) {
+		t.Errorf("expected an out of range location to be rejected, got %v", err)
+	}
+}
+
+func TestFixtureProviderRadius(t *testing.T) {
+	provider := restaurant.NewFixtureProvider(restaurantFixturePath)
+	center := geo.Point{Lat: 30.2672, Lng: -97.7431} // Austin
+
+	near, err := provider.Search(context.Background(), restaurant.SearchParams{Query: "tacos", Location: center, Radius: 2000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(near.Places) != 1 || near.Places[0].PlaceID != "fixture-au-001" {
+		t.Fatalf("expected only the downtown Austin taco place, got %+v", near.Places)
+	}
+
+	wide, err := provider.Search(context.Background(), restaurant.SearchParams{Query: "tacos", Location: center, Radius: 3000000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(wide.Places) <= len(near.Places) {
+		t.Errorf("expected a wider radius to find more tacos, got %d", len(wide.Places))
+	}
+}
+
+func TestSearchRestaurantsInvalidLocation(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	if _, err := svc.SearchRestaurants(context.Background(), "pizza", "not-a-location", "1000"); err == nil {
+		t.Error("expected error for invalid location")
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	center := geo.Point{Lat: 37.7749, Lng: -122.4194}
+	maxPrice := 1
+
+	resp, err := svc.Search(context.Background(), restaurant.SearchParams{
+		Query: "restaurants", Location: center, Radius: 20000, MinRating: 4.5, MaxPrice: &maxPrice,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Results) == 0 {
+		t.Fatal("expected cheap, well rated places in San Francisco")
+	}
+	for _, p := range resp.Results {
+		if p.Rating < 4.5 || p.PriceLevel == nil || *p.PriceLevel > maxPrice {
+			t.Errorf("expected rating >= 4.5 and price <= %d, got %+v", maxPrice, p)
+		}
+	}
+
+	if _, err := svc.Search(context.Background(), restaurant.SearchParams{Query: "pizza", Location: center, Radius: 60000}); !errors.Is(err, restaurant.ErrInvalidSearch) {
+		t.Errorf("expected ErrInvalidSearch for an oversized radius, got %v", err)
+	}
+}
+
+func TestSearchParamsMatchCuisine(t *testing.T) {
+	italian := restaurant.Place{Name: "Trattoria", Types: []string{"italian_restaurant", "restaurant", "food"}}
+	tacos := restaurant.Place{Name: "Taqueria", Types: []string{"mexican", "tacos", "restaurant"}}
+	untyped := restaurant.Place{Name: "Mystery Diner"}
+	cases := []struct {
+		cuisine string
+		place   restaurant.Place
+		want    bool
+	}{
+		{"italian", italian, true},
+		{"Italian food", italian, true},
+		{"thai", italian, false},
+		{"taco", tacos, true},
+		{"Mexican restaurants", tacos, true},
+		{"sushi", tacos, false},
+		{"sushi", untyped, true},
+	}
+	for _, tc := range cases {
+		params := restaurant.SearchParams{Cuisine: tc.cuisine}
+		if got := params.Matches(tc.place); got != tc.want {
+			t.Errorf("cuisine %q on %s: expected %v, got %v", tc.cuisine, tc.place.Name, tc.want, got)
+		}
+	}
+}
+
+func TestFixtureProviderPagination(t *testing.T) {
+	provider := restaurant.NewFixtureProvider(restaurantFixturePath)
+	params := restaurant.SearchParams{Query: "restaurants"}
+
+	first, err := provider.Search(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.NextPageToken == "" {
+		t.Fatal("expected the whole dataset to span more than one page")
+	}
+
+	params.PageToken = first.NextPageToken
+	second, err := provider.Search(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(second.Places) == 0 || second.NextPageToken != "" {
+		t.Fatalf("expected a final second page, got %d places and token %q", len(second.Places), second.NextPageToken)
+	}
+	seen := map[string]bool{}
+	for _, p := range append(first.Places, second.Places...) {
+		if seen[p.PlaceID] {
+			t.Errorf("place %s returned on both pages", p.PlaceID)
+		}
+		seen[p.PlaceID] = true
+	}
+}
+
+func TestSearchCursorKeepsFilters(t *testing.T) {
+	upstream := &pagingProvider{}
+	svc := &restaurant.Service{Cache: restaurant.NewCachingProvider(upstream, time.Minute, time.Hour, 10)}
+	params := restaurant.SearchParams{Query: "thai", Location: geo.Point{Lat: 37.77, Lng: -122.42}, Radius: 2000, MinRating: 4}
+
+	resp, err := svc.Search(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.NextCursor == "" {
+		t.Fatalf("expected the low rated place filtered out and a cursor, got %+v", resp)
+	}
+
+	next, err := restaurant.DecodeCursor(resp.NextCursor)
+	if err != nil {
+		t.Fatalf("unexpected cursor error: %v", err)
+	}
+	if next.PageToken != "page-2" || next.Query != "thai" || next.MinRating != 4 {
+		t.Errorf("expected cursor to carry the page token and filters, got %+v", next)
+	}
+
+	if _, err := restaurant.DecodeCursor("not-a-cursor"); !errors.Is(err, restaurant.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+// pagingProvider returns two places, one of them below a 4 star rating, and
+// a next page token on the first page.
+type pagingProvider struct{}
+
+func (pagingProvider) Search(ctx context.Context, params restaurant.SearchParams) (*restaurant.SearchPage, error) {
+	page := &restaurant.SearchPage{Places: []restaurant.Place{
+		{PlaceID: "good", Name: "Good Thai", Rating: 4.6},
+		{PlaceID: "meh", Name: "Meh Thai", Rating: 3.1},
+	}}
+	if params.PageToken == "" {
+		page.NextPageToken = "page-2"
+	}
+	return page, nil
+}
+
+func (pagingProvider) Photo(ctx context.Context, ref string, maxWidth int) (*restaurant.PhotoData, error) {
+	return nil, restaurant.ErrPhotoNotFound
+}
+
+func (pagingProvider) Details(ctx context.Context, placeID string) (*restaurant.PlaceDetails, error) {
+	return nil, restaurant.ErrPlaceNotFound
+}
+
+func TestGetDetails(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	details, err := svc.GetDetails(context.Background(), "fixture-sf-001")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if details.Name != "Golden Gate Slice" || details.Phone == "" || details.Website == "" {
+		t.Errorf("expected contact details, got %+v", details)
+	}
+	if details.Location == nil || details.PriceLevel == nil || len(details.Types) == 0 {
+		t.Errorf("expected location, price level and types, got %+v", details)
+	}
+	if len(details.Hours) != 7 || details.OpenNow == nil {
+		t.Errorf("expected a week of hours and open-now, got %v / %v", details.Hours, details.OpenNow)
+	}
+
+	if _, err := svc.GetDetails(context.Background(), "no-such-place"); !errors.Is(err, restaurant.ErrPlaceNotFound) {
+		t.Errorf("expected ErrPlaceNotFound, got %v", err)
+	}
+}
+
+func TestFixtureProviderOpenNow(t *testing.T) {
+	provider := restaurant.NewFixtureProvider(restaurantFixturePath)
+	cases := []struct {
+		at   time.Time
+		open bool
+	}{
+		{time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC), true},   // Monday lunch
+		{time.Date(2025, 6, 2, 23, 30, 0, 0, time.UTC), false}, // Monday after close
+		{time.Date(2025, 6, 3, 9, 0, 0, 0, time.UTC), false},   // Tuesday before open
+	}
+	for _, tc := range cases {
+		provider.Now = func() time.Time { return tc.at }
+		details, err := provider.Details(context.Background(), "fixture-sf-001")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if details.OpenNow == nil || *details.OpenNow != tc.open {
+			t.Errorf("at %v: expected open=%v, got %v", tc.at, tc.open, details.OpenNow)
+		}
+	}
+}
+
+func TestPhotoIsResized(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	ref := "fixture-photo-sf-001"
+
+	photo, err := svc.Photo(context.Background(), ref, 200, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(photo.Data))
+	if err != nil {
+		t.Fatalf("expected a decodable image: %v", err)
+	}
+	if format != "png" || photo.ContentType != "image/png" {
+		t.Errorf("expected png, got %s / %s", format, photo.ContentType)
+	}
+	if cfg.Width > 200 || cfg.Height > 100 {
+		t.Errorf("expected the photo to fit 200x100, got %dx%d", cfg.Width, cfg.Height)
+	}
+	if photo.ETag == "" {
+		t.Error("expected an ETag")
+	}
+
+	again, err := svc.Photo(context.Background(), ref, 200, 100)
+	if err != nil || again != photo {
+		t.Errorf("expected the resized photo to be served from the cache, got %v", err)
+	}
+
+	if _, err := svc.Photo(context.Background(), "unknown-ref", 200, 0); !errors.Is(err, restaurant.ErrPhotoNotFound) {
+		t.Errorf("expected ErrPhotoNotFound, got %v", err)
+	}
+}
+
+func TestPhotoCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := restaurant.NewPhotoCache(10)
+	cache.Add("a", &restaurant.PhotoData{Data: make([]byte, 4)})
+	cache.Add("b", &restaurant.PhotoData{Data: make([]byte, 4)})
+	cache.Get("a")
+	cache.Add("c", &restaurant.PhotoData{Data: make([]byte, 4)})
+
+	if cache.Get("b") != nil {
+		t.Error("expected the least recently used photo to be evicted")
+	}
+	if cache.Get("a") == nil || cache.Get("c") == nil {
+		t.Error("expected recently used photos to stay cached")
+	}
+}
+
+func TestSearchResultsUsePhotoProxy(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	places, err := svc.SearchRestaurants(context.Background(), "pizza", "37.7749,-122.4194", "5000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range places {
+		for _, photo := range p.Photos {
+			if !strings.HasPrefix(photo.URL, "/v1/restaurants/photos/") {
+				t.Errorf("expected a proxy URL, got %q", photo.URL)
+			}
+		}
+	}
+}
+
+type stubTeamRatings map[string]restaurant.TeamRating
+
+func (s stubTeamRatings) TeamRatings(ctx context.Context, userID uuid.UUID, restaurantIDs []string) (map[string]restaurant.TeamRating, error) {
+	return s, nil
+}
+
+func TestAddTeamRatings(t *testing.T) {
+	svc := newFixtureRestaurantService()
+	svc.Ratings = stubTeamRatings{"a": {Average: 4.5, Ratings: 2, Visits: 3}}
+
+	places := []restaurant.Place{{PlaceID: "a"}, {PlaceID: "b"}}
+	svc.AddTeamRatings(context.Background(), uuid.New(), places)
+	if places[0].TeamRating == nil || places[0].TeamRating.Average != 4.5 || places[0].TeamRating.Visits != 3 {
+		t.Errorf("expected team rating on visited place, got %+v", places[0].TeamRating)
+	}
+	if places[1].TeamRating != nil {
+		t.Errorf("expected no team rating on unvisited place, got %+v", places[1].TeamRating)
+	}
+}
+
+type countingProvider struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+	delay time.Duration
+}
+
+func (p *countingProvider) Search(ctx context.Context, params restaurant.SearchParams) (*restaurant.SearchPage, error) {
+	time.Sleep(p.delay)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &restaurant.SearchPage{Places: []restaurant.Place{{PlaceID: "p1", Name: params.Query}}}, nil
+}
+
+func (p *countingProvider) Photo(ctx context.Context, ref string, maxWidth int) (*restaurant.PhotoData, error) {
+	return nil, restaurant.ErrPhotoNotFound
+}
+
+func (p *countingProvider) Details(ctx context.Context, placeID string) (*restaurant.PlaceDetails, error) {
+	time.Sleep(p.delay)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &restaurant.PlaceDetails{Place: restaurant.Place{PlaceID: placeID}}, nil
+}
+
+func TestCachingProviderNormalizesKeys(t *testing.T) {
+	upstream := &countingProvider{}
+	cache := restaurant.NewCachingProvider(upstream, time.Minute, time.Hour, 10)
+
+	first := restaurant.SearchParams{Query: "Sushi  Bar", Location: geo.Point{Lat: 37.77491, Lng: -122.41942}, Radius: 4950}
+	second := restaurant.SearchParams{Query: "sushi bar", Location: geo.Point{Lat: 37.77489, Lng: -122.41938}, Radius: 5000}
+
+	if _, err := cache.Search(context.Background(), first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := cache.Search(context.Background(), second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %+v", stats)
+	}
+}
+
+func TestCachingProviderServesStaleOnError(t *testing.T) {
+	upstream := &countingProvider{}
+	cache := restaurant.NewCachingProvider(upstream, time.Millisecond, time.Hour, 10)
+	params := restaurant.SearchParams{Query: "ramen", Location: geo.Point{Lat: 30.27, Lng: -97.74}, Radius: 1000}
+
+	if _, err := cache.Search(context.Background(), params); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	upstream.err = errors.New("upstream down")
+
+	page, err := cache.Search(context.Background(), params)
+	if err != nil {
+		t.Fatalf("expected stale results, got error: %v", err)
+	}
+	if len(page.Places) != 1 {
+		t.Errorf("expected stale places, got %+v", page.Places)
+	}
+	if stats := cache.Stats(); stats.StaleServed != 1 || stats.UpstreamErrors != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachingProviderCoalescesConcurrentSearches(t *testing.T) {
+	upstream := &countingProvider{delay: 50 * time.Millisecond}
+	cache := restaurant.NewCachingProvider(upstream, time.Minute, time.Hour, 10)
+	params := restaurant.SearchParams{Query: "tacos", Location: geo.Point{Lat: 32.71, Lng: -117.16}, Radius: 1000}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Search(context.Background(), params); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if upstream.calls != 1 {
+		t.Errorf("expected concurrent searches to share 1 upstream call, got %d", upstream.calls)
+	}
+}
+
+func TestGooglePlacesStatusErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"over quota", http.StatusOK, `{"status":"OVER_QUERY_LIMIT"}`, restaurant.ErrRateLimited},
+		{"rate limited", http.StatusTooManyRequests, ``, restaurant.ErrRateLimited},
+		{"server error", http.StatusBadGateway, ``, restaurant.ErrProviderUnavailable},
+		{"unknown error", http.StatusOK, `{"status":"UNKNOWN_ERROR"}`, restaurant.ErrProviderUnavailable},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			_, _ = w.Write([]byte(tc.body))
+		}))
+		g := restaurant.NewGooglePlaces(srv.URL+"/textsearch/json", "key")
+		g.Client = httpclient.New(httpclient.Options{MaxRetries: -1})
+
+		_, err := g.Search(context.Background(), restaurant.SearchParams{Query: "pizza", Radius: 1000})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestGooglePlacesZeroResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ZERO_RESULTS","results":[]}`))
+	}))
+	defer srv.Close()
+
+	g := restaurant.NewGooglePlaces(srv.URL+"/textsearch/json", "key")
+	page, err := g.Search(context.Background(), restaurant.SearchParams{Query: "pizza", Radius: 1000})
+	if err != nil {
+		t.Fatalf("expected no error for zero results, got %v", err)
+	}
+	if len(page.Places) != 0 {
+		t.Errorf("expected an empty page, got %d places", len(page.Places))
 	}
 }
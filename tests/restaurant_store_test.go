@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/turanoo/bitebattle/internal/restaurant"
+	"github.com/turanoo/bitebattle/pkg/geo"
+)
+
+func TestStoreSaveAndGet(t *testing.T) {
+	store := restaurant.NewStore(newTestDB(t, restaurantsTable))
+	ctx := context.Background()
+	price := 2
+
+	// A place without types or opening hours is stored with empty lists.
+	details := &restaurant.PlaceDetails{
+		Place: restaurant.Place{
+			PlaceID: "alpha", Name: "Alpha", Address: "1 Main St", Rating: 4.5, PriceLevel: &price,
+			Location: &geo.Point{Lat: 30.27, Lng: -97.74},
+		},
+		UpdatedAt: time.Now(),
+	}
+	if err := store.Save(ctx, details); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	got, err := store.Get(ctx, "alpha")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Name != "Alpha" || got.Rating != 4.5 || got.PriceLevel == nil || *got.PriceLevel != 2 || got.Location == nil || got.Location.Lat != 30.27 {
+		t.Errorf("unexpected stored details %+v", got)
+	}
+	if len(got.Types) != 0 || len(got.Hours) != 0 {
+		t.Errorf("expected no types or hours, got %v and %v", got.Types, got.Hours)
+	}
+
+	// Saving again refreshes the stored copy.
+	details.Types = []string{"restaurant", "pizza"}
+	details.Hours = []string{"Monday: 11 AM – 10 PM"}
+	details.PriceLevel = nil
+	if err := store.Save(ctx, details); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	got, err = store.Get(ctx, "alpha")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Types, details.Types) || !reflect.DeepEqual(got.Hours, details.Hours) || got.PriceLevel != nil {
+		t.Errorf("expected the stored copy refreshed, got %+v", got)
+	}
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, restaurant.ErrPlaceNotFound) {
+		t.Errorf("expected ErrPlaceNotFound, got %v", err)
+	}
+}
@@ -2,36 +2,13 @@ package tests
 
 import (
 	"context"
-	"database/sql"
 	"testing"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/turanoo/bitebattle/internal/user"
 )
 
-func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		t.Fatalf("failed to open test db: %v", err)
-	}
-	_, err = db.Exec(`
-		CREATE TABLE users (
-			id TEXT PRIMARY KEY,
-			email TEXT NOT NULL,
-			name TEXT NOT NULL,
-			password_hash TEXT NOT NULL,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
-		);
-	`)
-	if err != nil {
-		t.Fatalf("failed to create users table: %v", err)
-	}
-	return db
-}
-
 func TestCreateAndGetUser(t *testing.T) {
-	db := setupTestDB(t)
+	db := newTestDB(t, usersTable)
 	service := user.NewService(db)
 	ctx := context.Background()
 
@@ -57,7 +34,7 @@ func TestCreateAndGetUser(t *testing.T) {
 }
 
 func TestGetUserByEmail(t *testing.T) {
-	db := setupTestDB(t)
+	db := newTestDB(t, usersTable)
 	service := user.NewService(db)
 	ctx := context.Background()
 
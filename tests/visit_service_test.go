@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/turanoo/bitebattle/internal/poll"
+	"github.com/turanoo/bitebattle/internal/visit"
+)
+
+func intPtr(n int) *int { return &n }
+
+func visitDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(visit.DateLayout, s)
+	if err != nil {
+		t.Fatalf("bad date %q: %v", s, err)
+	}
+	return d
+}
+
+func TestVisits(t *testing.T) {
+	db := newTestDB(t, usersTable, pollsTables, head2headTables, visitsTable)
+	service := visit.NewService(db)
+	userID := insertUser(t, db, "Ana")
+
+	first, err := service.CreateVisit(userID, visit.NewVisit{
+		RestaurantID: "a", RestaurantName: "Alpha", VisitedOn: visitDate(t, "2025-03-01"), Rating: intPtr(4), Notes: "Great crust",
+	})
+	if err != nil {
+		t.Fatalf("CreateVisit failed: %v", err)
+	}
+	if _, err := service.CreateVisit(userID, visit.NewVisit{RestaurantID: "b", RestaurantName: "Bravo", VisitedOn: visitDate(t, "2025-03-05")}); err != nil {
+		t.Fatalf("CreateVisit failed: %v", err)
+	}
+	if _, err := service.CreateVisit(userID, visit.NewVisit{RestaurantID: "a", RestaurantName: "Alpha", VisitedOn: time.Now().AddDate(0, 0, 3)}); !errors.Is(err, visit.ErrVisitInFuture) {
+		t.Errorf("expected ErrVisitInFuture, got %v", err)
+	}
+	pollID := uuid.New()
+	if _, err := service.CreateVisit(userID, visit.NewVisit{RestaurantID: "a", RestaurantName: "Alpha", VisitedOn: visitDate(t, "2025-03-01"), PollID: &pollID}); !errors.Is(err, visit.ErrPollNotFound) {
+		t.Errorf("expected ErrPollNotFound for a poll the user is not in, got %v", err)
+	}
+
+	visits, err := service.GetVisits(userID, "")
+	if err != nil {
+		t.Fatalf("GetVisits failed: %v", err)
+	}
+	if len(visits) != 2 || visits[0].RestaurantID != "b" {
+		t.Fatalf("expected 2 visits, newest first, got %+v", visits)
+	}
+	visits, err = service.GetVisits(userID, "a")
+	if err != nil {
+		t.Fatalf("GetVisits failed: %v", err)
+	}
+	if len(visits) != 1 || visits[0].VisitedOn != "2025-03-01" || *visits[0].Rating != 4 {
+		t.Errorf("expected the visit to Alpha, got %+v", visits)
+	}
+
+	// Absent fields are left alone.
+	visitedOn := visitDate(t, "2025-03-02")
+	updated, err := service.UpdateVisit(userID, first.ID, visit.VisitUpdate{VisitedOn: &visitedOn})
+	if err != nil {
+		t.Fatalf("UpdateVisit failed: %v", err)
+	}
+	if updated.VisitedOn != "2025-03-02" || updated.Rating == nil || *updated.Rating != 4 || updated.Notes != "Great crust" {
+		t.Errorf("expected only the date to change, got %+v", updated)
+	}
+
+	empty := ""
+	updated, err = service.UpdateVisit(userID, first.ID, visit.VisitUpdate{ClearRating: true, Notes: &empty})
+	if err != nil {
+		t.Fatalf("UpdateVisit failed: %v", err)
+	}
+	if updated.Rating != nil || updated.Notes != "" {
+		t.Errorf("expected the rating and notes to be cleared, got rating %v and notes %q", updated.Rating, updated.Notes)
+	}
+
+	if _, err := service.UpdateVisit(uuid.New(), first.ID, visit.VisitUpdate{Rating: intPtr(1)}); !errors.Is(err, visit.ErrVisitNotFound) {
+		t.Errorf("expected ErrVisitNotFound for another user, got %v", err)
+	}
+	if err := service.DeleteVisit(userID, first.ID); err != nil {
+		t.Fatalf("DeleteVisit failed: %v", err)
+	}
+	if _, err := service.GetVisit(userID, first.ID); !errors.Is(err, visit.ErrVisitNotFound) {
+		t.Errorf("expected ErrVisitNotFound after delete, got %v", err)
+	}
+}
+
+func TestTeamRatings(t *testing.T) {
+	db := newTestDB(t, usersTable, pollsTables, head2headTables, visitsTable)
+	service := visit.NewService(db)
+	polls := poll.NewService(db, nil)
+	ana := insertUser(t, db, "Ana")
+	ben := insertUser(t, db, "Ben")
+	stranger := insertUser(t, db, "Stranger")
+
+	p, err := polls.CreatePoll("Friday", ana)
+	if err != nil {
+		t.Fatalf("CreatePoll failed: %v", err)
+	}
+	if _, err := polls.JoinPoll(p.InviteCode, ben); err != nil {
+		t.Fatalf("JoinPoll failed: %v", err)
+	}
+
+	visits := []struct {
+		user      uuid.UUID
+		id        string
+		visitedOn string
+		rating    *int
+	}{
+		{ana, "a", "2025-03-01", intPtr(5)},
+		{ben, "a", "2025-04-10", intPtr(3)},
+		{ben, "a", "2025-04-12", nil},
+		{stranger, "a", "2025-05-01", intPtr(1)},
+		{stranger, "b", "2025-05-01", intPtr(1)},
+	}
+	for _, v := range visits {
+		_, err := service.CreateVisit(v.user, visit.NewVisit{RestaurantID: v.id, RestaurantName: "Restaurant " + v.id, VisitedOn: visitDate(t, v.visitedOn), Rating: v.rating})
+		if err != nil {
+			t.Fatalf("CreateVisit failed: %v", err)
+		}
+	}
+
+	ratings, err := service.TeamRatings(context.Background(), ana, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("TeamRatings failed: %v", err)
+	}
+	if len(ratings) != 1 {
+		t.Fatalf("expected only Alpha to have team visits, got %v", ratings)
+	}
+	a := ratings["a"]
+	if a.Average != 4 || a.Ratings != 2 || a.Visits != 3 {
+		t.Errorf("expected an average of 4 from 2 ratings over 3 visits, got %+v", a)
+	}
+	if a.LastVisited == nil || a.LastVisited.Format(visit.DateLayout) != "2025-04-12" {
+		t.Errorf("expected the last team visit on 2025-04-12, got %v", a.LastVisited)
+	}
+
+	ratings, err = service.TeamRatings(context.Background(), stranger, []string{"a"})
+	if err != nil {
+		t.Fatalf("TeamRatings failed: %v", err)
+	}
+	if ratings["a"].Visits != 1 {
+		t.Errorf("expected the stranger's team to be only themselves, got %+v", ratings["a"])
+	}
+}